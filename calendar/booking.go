@@ -0,0 +1,106 @@
+package calendar
+
+import (
+	"sort"
+	"time"
+)
+
+// SlotOptions controls BookableSlots
+type SlotOptions struct {
+	Duration time.Duration
+	// Availability lists the weekly windows slots may fall in, as times of
+	// day in Location
+	Availability []WorkingHours
+	Location     *time.Location
+	// WindowStart and WindowEnd bound the search
+	WindowStart time.Time
+	WindowEnd   time.Time
+	// Busy holds the owner's busy times
+	Busy []Interval
+	// BufferBefore and BufferAfter are the free time a slot needs around it
+	BufferBefore time.Duration
+	BufferAfter  time.Duration
+	// MinNotice is how far from Now the earliest slot may start
+	MinNotice time.Duration
+	// MaxPerDay limits the bookings per day in Location; 0 means no limit
+	MaxPerDay int
+	// Booked counts the existing bookings per day, keyed by YYYY-MM-DD in Location
+	Booked map[string]int
+	// Step is the granularity of slot start times; defaults to the
+	// duration, but at most 30 minutes
+	Step time.Duration
+	// Now is the current time; defaults to time.Now()
+	Now time.Time
+}
+
+// BookableSlots lists the slots a guest can book, in order: within an
+// availability window, clear of busy times by the buffers, and on a day
+// that isn't fully booked yet. Slots start on Step boundaries from the
+// start of their window.
+func BookableSlots(opts SlotOptions) []Interval {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Step <= 0 {
+		opts.Step = opts.Duration
+		if opts.Step > 30*time.Minute {
+			opts.Step = 30 * time.Minute
+		}
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Duration <= 0 || !opts.WindowEnd.After(opts.WindowStart) {
+		return nil
+	}
+
+	busy := MergeIntervals(opts.Busy)
+	earliest := maxTime(opts.WindowStart, opts.Now.Add(opts.MinNotice))
+
+	var slots []Interval
+	first := opts.WindowStart.In(opts.Location)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, opts.Location)
+	for ; day.Before(opts.WindowEnd); day = day.AddDate(0, 0, 1) {
+		if opts.MaxPerDay > 0 && opts.Booked[day.Format("2006-01-02")] >= opts.MaxPerDay {
+			continue
+		}
+
+		// Windows may overlap, so each start is offered once
+		offered := map[int64]bool{}
+		for _, window := range opts.Availability {
+			if !worksOn(window, day.Weekday()) {
+				continue
+			}
+			// Wall-clock times, so windows keep their hours across DST changes
+			windowStart := time.Date(day.Year(), day.Month(), day.Day(), 0, int(window.Start.Minutes()), 0, 0, opts.Location)
+			windowEnd := time.Date(day.Year(), day.Month(), day.Day(), 0, int(window.End.Minutes()), 0, 0, opts.Location)
+
+			for start := windowStart; !start.Add(opts.Duration).After(windowEnd); start = start.Add(opts.Step) {
+				slot := Interval{Start: start, End: start.Add(opts.Duration)}
+				if slot.Start.Before(earliest) || slot.End.After(opts.WindowEnd) {
+					continue
+				}
+				padded := Interval{Start: slot.Start.Add(-opts.BufferBefore), End: slot.End.Add(opts.BufferAfter)}
+				if offered[slot.Start.Unix()] || overlapsAny(padded, busy) {
+					continue
+				}
+				offered[slot.Start.Unix()] = true
+				slots = append(slots, slot)
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Start.Before(slots[j].Start)
+	})
+	return slots
+}
+
+func worksOn(hours WorkingHours, day time.Weekday) bool {
+	for _, d := range hours.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
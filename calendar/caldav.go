@@ -0,0 +1,643 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"goauthDemo/ical"
+	"goauthDemo/internal/netguard"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const caldavTimeLayout = "20060102T150405Z"
+
+// CalDAVProvider talks to a CalDAV calendar collection (Nextcloud, Radicale,
+// ...) over plain HTTP. Recurring events are expanded by the server; their
+// instances can be read but only the whole series can be changed.
+type CalDAVProvider struct {
+	client      *http.Client
+	calendarURL string
+	username    string
+	password    string
+	owner       string
+}
+
+// NewCalDAVProvider creates a provider for the calendar collection at
+// calendarURL, authenticating with HTTP basic auth. The URL is user
+// supplied, so connections to non-public addresses are refused.
+func NewCalDAVProvider(calendarURL, username, password, ownerEmail string) *CalDAVProvider {
+	if !strings.HasSuffix(calendarURL, "/") {
+		calendarURL += "/"
+	}
+	return &CalDAVProvider{
+		client:      netguard.NewClient(30 * time.Second),
+		calendarURL: calendarURL,
+		username:    username,
+		password:    password,
+		owner:       ownerEmail,
+	}
+}
+
+// multistatus is the subset of a WebDAV multistatus response we read
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ETag         string `xml:"DAV: getetag"`
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// caldavObject is one calendar resource returned by a REPORT
+type caldavObject struct {
+	href   string
+	etag   string
+	events []*calendar.Event
+	// unreadable counts the components that couldn't be decoded
+	unreadable int
+}
+
+func (p *CalDAVProvider) request(ctx context.Context, method, target string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return p.client.Do(req)
+}
+
+// caldavError tags a failed CalDAV response with the matching provider
+// error. The response body is left out: it comes from a server the user
+// picked and may end up in API responses.
+func caldavError(resp *http.Response) error {
+	err := fmt.Errorf("caldav server responded with %d", resp.StatusCode)
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrForbidden, err)
+	case http.StatusBadRequest, http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnsupportedMediaType:
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+	return err
+}
+
+// CheckConnection verifies the collection exists and the credentials work
+func (p *CalDAVProvider) CheckConnection(ctx context.Context) error {
+	body := `<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`
+	resp, err := p.request(ctx, "PROPFIND", p.calendarURL, strings.NewReader(body), map[string]string{
+		"Depth":        "0",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return fmt.Errorf("unable to reach CalDAV server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return fmt.Errorf("unable to open CalDAV calendar: %w", caldavError(resp))
+	}
+	return nil
+}
+
+// calendarCollections is the multistatus of a PROPFIND for calendar
+// collections and their names
+type calendarCollections struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+				} `xml:"DAV: resourcetype"`
+				DisplayName string `xml:"DAV: displayname"`
+				Description string `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+				Color       string `xml:"http://apple.com/ns/ical/ calendar-color"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// ListCalendars lists the calendar collections next to the configured one,
+// which is usually the user's calendar home. IDs are collection paths.
+// When the home can't be read only the configured calendar is returned.
+func (p *CalDAVProvider) ListCalendars(ctx context.Context) ([]*CalendarInfo, error) {
+	own, err := url.Parse(p.calendarURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve calendars: %v", err)
+	}
+	primary := &CalendarInfo{ID: own.Path, Name: path.Base(own.Path), Primary: true, AccessRole: "owner"}
+
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:a="http://apple.com/ns/ical/">
+  <d:prop><d:resourcetype/><d:displayname/><c:calendar-description/><a:calendar-color/></d:prop>
+</d:propfind>`
+	resp, err := p.request(ctx, "PROPFIND", p.resolve("../"), strings.NewReader(body), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve calendars: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		log.Printf("Unable to read CalDAV calendar home, listing only %s: %v", p.calendarURL, caldavError(resp))
+		return []*CalendarInfo{primary}, nil
+	}
+
+	var result calendarCollections
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("unable to retrieve calendars: invalid multistatus response: %v", err)
+	}
+
+	calendars := []*CalendarInfo{primary}
+	for _, response := range result.Responses {
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200") || propstat.Prop.ResourceType.Calendar == nil {
+				continue
+			}
+			collection, err := url.Parse(p.resolve(response.Href))
+			if err != nil {
+				continue
+			}
+			info := primary
+			if strings.TrimSuffix(collection.Path, "/") != strings.TrimSuffix(own.Path, "/") {
+				info = &CalendarInfo{ID: collection.Path, AccessRole: "writer"}
+				calendars = append(calendars, info)
+			}
+			info.Name = propstat.Prop.DisplayName
+			if info.Name == "" {
+				info.Name = path.Base(collection.Path)
+			}
+			info.Description = propstat.Prop.Description
+			info.Color = propstat.Prop.Color
+		}
+	}
+	return calendars, nil
+}
+
+// WithCalendar returns a provider for another collection from
+// ListCalendars, using the same credentials. Only listed collections are
+// accepted so the credentials never go to another server.
+func (p *CalDAVProvider) WithCalendar(ctx context.Context, calendarID string) (CalendarProvider, error) {
+	if calendarID == PrimaryCalendar {
+		return p, nil
+	}
+
+	calendars, err := p.ListCalendars(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open calendar %q: %w", calendarID, err)
+	}
+	for _, info := range calendars {
+		if info.ID != calendarID {
+			continue
+		}
+		if info.Primary {
+			return p, nil
+		}
+		other := NewCalDAVProvider(p.resolve(info.ID), p.username, p.password, p.owner)
+		other.client = p.client
+		return other, nil
+	}
+	return nil, fmt.Errorf("unable to open calendar %q: %w", calendarID, ErrNotFound)
+}
+
+// report runs a calendar-query REPORT with the given filter and returns
+// the matching calendar objects
+func (p *CalDAVProvider) report(ctx context.Context, calendarData, filter string) ([]caldavObject, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/>` + calendarData + `</d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">` + filter + `</c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`
+
+	resp, err := p.request(ctx, "REPORT", p.calendarURL, strings.NewReader(body), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, caldavError(resp)
+	}
+
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid multistatus response: %v", err)
+	}
+
+	var objects []caldavObject
+	for _, response := range result.Responses {
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200") || propstat.Prop.CalendarData == "" {
+				continue
+			}
+			events, skipped, err := ical.DecodeLenient(strings.NewReader(propstat.Prop.CalendarData))
+			if err != nil {
+				return nil, fmt.Errorf("invalid calendar data in %s: %v", response.Href, err)
+			}
+			for _, event := range skipped {
+				log.Printf("Skipping unreadable event %s in %s: %v", event.UID, response.Href, event.Err)
+			}
+			objects = append(objects, caldavObject{
+				href:       p.resolve(response.Href),
+				etag:       propstat.Prop.ETag,
+				events:     events,
+				unreadable: len(skipped),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// resolve turns an href from a multistatus response into an absolute URL
+func (p *CalDAVProvider) resolve(href string) string {
+	base, err := url.Parse(p.calendarURL)
+	if err != nil {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// ListEvents runs a time-range REPORT, letting the server expand recurring
+// events into instances within the window
+func (p *CalDAVProvider) ListEvents(ctx context.Context, opts ListOptions) (*EventPage, error) {
+	// Expansion needs both ends of the window
+	timeMin, timeMax := opts.TimeMin, opts.TimeMax
+	if timeMin.IsZero() {
+		timeMin = time.Now()
+	}
+	if timeMax.IsZero() {
+		timeMax = timeMin.AddDate(0, 0, 7)
+	}
+	start := timeMin.UTC().Format(caldavTimeLayout)
+	end := timeMax.UTC().Format(caldavTimeLayout)
+
+	objects, err := p.report(ctx,
+		fmt.Sprintf(`<c:calendar-data><c:expand start="%s" end="%s"/></c:calendar-data>`, start, end),
+		fmt.Sprintf(`<c:time-range start="%s" end="%s"/>`, start, end),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve events: %w", err)
+	}
+
+	var events []*calendar.Event
+	for _, object := range objects {
+		for _, event := range object.events {
+			if event.Status == "cancelled" {
+				continue
+			}
+			p.assignID(event)
+			events = append(events, event)
+		}
+	}
+
+	// CalDAV has no paging of its own
+	sortEvents(events)
+	return paginate(events, opts)
+}
+
+// assignID uses the UID as event ID, suffixed with the recurrence ID for
+// expanded instances, mirroring Google's instance IDs
+func (p *CalDAVProvider) assignID(event *calendar.Event) {
+	event.Id = event.ICalUID
+	if event.OriginalStartTime != nil {
+		if start, err := ParseEventDateTime(event.OriginalStartTime); err == nil {
+			event.RecurringEventId = event.ICalUID
+			event.Id = InstanceID(event.ICalUID, start)
+		}
+	}
+	// Expanded instances carry no RRULE of their own
+	if event.RecurringEventId != "" {
+		event.Recurrence = nil
+	}
+}
+
+// find locates the calendar object holding the event with the given UID.
+// The server's text-match is a substring match, so the objects it returns
+// are narrowed down to the one with exactly that UID.
+func (p *CalDAVProvider) find(ctx context.Context, uid string) (*caldavObject, error) {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(uid))
+
+	objects, err := p.report(ctx,
+		`<c:calendar-data/>`,
+		`<c:prop-filter name="UID"><c:text-match collation="i;octet">`+escaped.String()+`</c:text-match></c:prop-filter>`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		for _, event := range objects[i].events {
+			if event.ICalUID == uid {
+				return &objects[i], nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetEvent returns an event, or the matching instance of a recurring series
+func (p *CalDAVProvider) GetEvent(ctx context.Context, eventID string) (*calendar.Event, error) {
+	uid, originalStart, isInstance := parseInstanceID(eventID)
+	object, err := p.find(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve event: %w", err)
+	}
+
+	var master *calendar.Event
+	for _, event := range object.events {
+		p.assignID(event)
+		if event.Id == eventID {
+			return event, nil
+		}
+		if event.Id == uid && IsRecurring(event) {
+			master = event
+		}
+	}
+
+	// Unchanged instances aren't stored separately, so derive them from the series
+	if isInstance && master != nil {
+		if instance, ok := InstanceOf(master, originalStart); ok {
+			return instance, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to retrieve event: %w", ErrNotFound)
+}
+
+// FindByICalUID returns the event stored under the given UID
+func (p *CalDAVProvider) FindByICalUID(ctx context.Context, uid string) (*calendar.Event, error) {
+	object, err := p.find(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve event: %w", err)
+	}
+	for _, event := range object.events {
+		p.assignID(event)
+		if event.Id == uid && event.Status != "cancelled" {
+			return event, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to retrieve event: %w", ErrNotFound)
+}
+
+// ListInstances lists the window and keeps the instances of the given series
+func (p *CalDAVProvider) ListInstances(ctx context.Context, eventID string, opts ListOptions) (*EventPage, error) {
+	if _, err := p.find(ctx, eventID); err != nil {
+		return nil, fmt.Errorf("unable to retrieve instances: %w", err)
+	}
+
+	all, err := p.ListEvents(ctx, ListOptions{TimeMin: opts.TimeMin, TimeMax: opts.TimeMax})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve instances: %w", err)
+	}
+
+	var instances []*calendar.Event
+	for _, event := range all.Items {
+		if event.RecurringEventId == eventID {
+			instances = append(instances, event)
+		}
+	}
+	return paginate(instances, opts)
+}
+
+// put writes a calendar object holding the given components
+func (p *CalDAVProvider) put(ctx context.Context, target string, events []*calendar.Event, headers map[string]string) error {
+	var body bytes.Buffer
+	if err := ical.Encode(&body, events); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+
+	headers["Content-Type"] = "text/calendar; charset=utf-8"
+	resp, err := p.request(ctx, http.MethodPut, target, &body, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return caldavError(resp)
+	}
+	return nil
+}
+
+// CreateEvent PUTs a new calendar object named after the event's UID
+func (p *CalDAVProvider) CreateEvent(ctx context.Context, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	if requestsConference(event) {
+		return nil, fmt.Errorf("unable to create event: %w: Google Meet conferences", ErrNotSupported)
+	}
+	if err := validateEvent(event); err != nil {
+		return nil, fmt.Errorf("unable to create event: %w", err)
+	}
+
+	stored := copyEvent(event)
+	if stored.ICalUID == "" {
+		uid, err := newUID()
+		if err != nil {
+			return nil, fmt.Errorf("unable to create event: %v", err)
+		}
+		stored.ICalUID = uid
+	}
+	if stored.Organizer == nil {
+		stored.Organizer = &calendar.EventOrganizer{Email: p.owner, Self: true}
+	}
+
+	target := p.calendarURL + url.PathEscape(stored.ICalUID) + ".ics"
+	// Never overwrite an existing object
+	if err := p.put(ctx, target, []*calendar.Event{stored}, map[string]string{"If-None-Match": "*"}); err != nil {
+		return nil, fmt.Errorf("unable to create event: %w", err)
+	}
+
+	stored.Id = stored.ICalUID
+	stored.Status = "confirmed"
+	return stored, nil
+}
+
+// UpdateEvent replaces the calendar object holding the event
+func (p *CalDAVProvider) UpdateEvent(ctx context.Context, eventID string, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	if requestsConference(event) {
+		return nil, fmt.Errorf("unable to update event: %w: Google Meet conferences", ErrNotSupported)
+	}
+	if _, isInstance := splitInstanceID(eventID); isInstance {
+		return nil, fmt.Errorf("unable to update event: %w: change the recurring series instead", ErrNotSupported)
+	}
+	if err := validateEvent(event); err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", err)
+	}
+
+	object, err := p.find(ctx, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", err)
+	}
+	if object.unreadable > 0 {
+		// Writing the object back would drop what we couldn't read
+		return nil, fmt.Errorf("unable to update event: %w: the calendar object has events that can't be read", ErrNotSupported)
+	}
+
+	stored := copyEvent(event)
+	stored.ICalUID = eventID
+	stored.OriginalStartTime = nil
+	if stored.Organizer == nil && len(object.events) > 0 {
+		stored.Organizer = object.events[0].Organizer
+	}
+
+	// The object also holds the series' changed and cancelled instances
+	// (RECURRENCE-ID components); write them back so they aren't lost,
+	// unless the event stops repeating
+	components := []*calendar.Event{stored}
+	for _, component := range object.events {
+		if component.OriginalStartTime != nil && IsRecurring(stored) {
+			components = append(components, component)
+		}
+	}
+
+	headers := map[string]string{}
+	if object.etag != "" {
+		// Fail rather than overwrite concurrent changes
+		headers["If-Match"] = object.etag
+	}
+	if err := p.put(ctx, object.href, components, headers); err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", err)
+	}
+
+	stored.Id = eventID
+	return stored, nil
+}
+
+// PatchEvent merges the patch into the stored event and writes it back
+func (p *CalDAVProvider) PatchEvent(ctx context.Context, eventID string, patch *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	if requestsConference(patch) {
+		return nil, fmt.Errorf("unable to patch event: %w: Google Meet conferences", ErrNotSupported)
+	}
+	existing, err := p.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := mergeEvent(existing, patch)
+	if err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", err)
+	}
+	return p.UpdateEvent(ctx, eventID, merged, opts)
+}
+
+// RespondToEvent sets the owner's PARTSTAT on their copy of the event.
+// Servers with implicit scheduling (RFC 6638) pass the reply on to the
+// organizer.
+func (p *CalDAVProvider) RespondToEvent(ctx context.Context, eventID string, rsvp RSVP, opts WriteOptions) (*calendar.Event, error) {
+	event, err := p.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if err := setResponse(event, p.owner, rsvp); err != nil {
+		return nil, fmt.Errorf("unable to respond to event: %w", err)
+	}
+	return p.UpdateEvent(ctx, eventID, event, opts)
+}
+
+// DeleteEvent removes the calendar object holding the event
+func (p *CalDAVProvider) DeleteEvent(ctx context.Context, eventID string, opts WriteOptions) error {
+	if _, isInstance := splitInstanceID(eventID); isInstance {
+		return fmt.Errorf("unable to delete event: %w: change the recurring series instead", ErrNotSupported)
+	}
+
+	object, err := p.find(ctx, eventID)
+	if err != nil {
+		return fmt.Errorf("unable to delete event: %w", err)
+	}
+
+	headers := map[string]string{}
+	if object.etag != "" {
+		headers["If-Match"] = object.etag
+	}
+	resp, err := p.request(ctx, http.MethodDelete, object.href, nil, headers)
+	if err != nil {
+		return fmt.Errorf("unable to delete event: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unable to delete event: %w", caldavError(resp))
+	}
+	return nil
+}
+
+// FreeBusy is computed from the user's own events; CalDAV gives us no view
+// of other people's calendars, so only the owner (or "primary") is answered.
+func (p *CalDAVProvider) FreeBusy(ctx context.Context, timeMin, timeMax time.Time, calendars []string) (map[string][]*calendar.TimePeriod, error) {
+	busy := make(map[string][]*calendar.TimePeriod)
+
+	var periods []*calendar.TimePeriod
+	loaded := false
+	for _, id := range calendars {
+		if id != p.owner && id != PrimaryCalendar {
+			continue
+		}
+
+		if !loaded {
+			events, err := p.ListEvents(ctx, ListOptions{TimeMin: timeMin, TimeMax: timeMax})
+			if err != nil {
+				return nil, fmt.Errorf("unable to query free/busy: %w", err)
+			}
+
+			var intervals []Interval
+			for _, event := range events.Items {
+				if event.Transparency == "transparent" {
+					continue
+				}
+				start, end, err := eventBounds(event)
+				if err != nil {
+					continue
+				}
+				intervals = append(intervals, Interval{Start: maxTime(start, timeMin), End: minTime(end, timeMax)})
+			}
+
+			periods = []*calendar.TimePeriod{}
+			for _, interval := range MergeIntervals(intervals) {
+				periods = append(periods, &calendar.TimePeriod{
+					Start: interval.Start.Format(time.RFC3339),
+					End:   interval.End.Format(time.RFC3339),
+				})
+			}
+			loaded = true
+		}
+		busy[id] = periods
+	}
+	return busy, nil
+}
+
+// newUID generates a random iCalendar UID
+func newUID() (string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	return id + "@goauthDemo", nil
+}
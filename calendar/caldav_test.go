@@ -0,0 +1,292 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goauthDemo/internal/netguard"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// caldavServer is a stand-in CalDAV collection: it stores the objects PUT
+// to it and answers REPORTs with all of them, or those matching a UID
+// filter. Recurring events are not expanded.
+type caldavServer struct {
+	mu      sync.Mutex
+	objects map[string]string
+	etags   map[string]int
+	// status, when set, is returned for every request with a body that
+	// must not leak into errors
+	status int
+}
+
+var (
+	uidFilter = regexp.MustCompile(`<c:text-match[^>]*>([^<]*)</c:text-match>`)
+	uidLine   = regexp.MustCompile(`(?m)^UID:(.*)\r$`)
+)
+
+// uidContains matches as RFC 4791 text-match does: the UID only has to
+// contain the text
+func uidContains(data, text string) bool {
+	for _, match := range uidLine.FindAllStringSubmatch(data, -1) {
+		if strings.Contains(match[1], text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *caldavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		fmt.Fprint(w, "internal detail: secret-token-123")
+		return
+	}
+	if user, password, ok := r.BasicAuth(); !ok || user != "alice" || password != "app-password" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "PROPFIND":
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<d:multistatus xmlns:d="DAV:"/>`)
+	case http.MethodPut:
+		etag := fmt.Sprintf(`"%d"`, s.etags[r.URL.Path])
+		_, exists := s.objects[r.URL.Path]
+		if (r.Header.Get("If-None-Match") == "*" && exists) || (r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != etag) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		s.objects[r.URL.Path] = string(body)
+		s.etags[r.URL.Path]++
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	case "REPORT":
+		uid := ""
+		if match := uidFilter.FindSubmatch(body); match != nil {
+			uid = html.UnescapeString(string(match[1]))
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+		for href, data := range s.objects {
+			if uid != "" && !uidContains(data, uid) {
+				continue
+			}
+			fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>"%d"</d:getetag><c:calendar-data>%s</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`,
+				href, s.etags[href], html.EscapeString(data))
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newTestCalDAV starts a caldavServer and returns a provider for it. The
+// server listens on loopback, so the provider's guarded client is swapped
+// for the test server's.
+func newTestCalDAV(t *testing.T) (*caldavServer, *CalDAVProvider) {
+	t.Helper()
+	server := &caldavServer{objects: map[string]string{}, etags: map[string]int{}}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	provider := NewCalDAVProvider(httpServer.URL+"/calendars/alice/personal", "alice", "app-password", "alice@example.com")
+	provider.client = httpServer.Client()
+	return server, provider
+}
+
+func TestCalDAVCheckConnection(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+	}{
+		{"reachable", 0, nil},
+		{"bad credentials", http.StatusUnauthorized, ErrForbidden},
+		{"missing collection", http.StatusNotFound, ErrNotFound},
+		{"server error", http.StatusInternalServerError, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, provider := newTestCalDAV(t)
+			server.status = tt.status
+
+			err := provider.CheckConnection(context.Background())
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("CheckConnection() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("CheckConnection() = nil, want an error")
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("CheckConnection() = %v, want %v", err, tt.err)
+			}
+			if strings.Contains(err.Error(), "secret-token-123") {
+				t.Errorf("error %q contains the server's response body", err)
+			}
+		})
+	}
+}
+
+func TestCalDAVRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(&caldavServer{})
+	defer server.Close()
+
+	provider := NewCalDAVProvider(server.URL+"/calendars/alice/personal", "alice", "app-password", "alice@example.com")
+	if err := provider.CheckConnection(context.Background()); !errors.Is(err, netguard.ErrBlocked) {
+		t.Fatalf("CheckConnection() = %v, want %v", err, netguard.ErrBlocked)
+	}
+}
+
+func TestCalDAVEventLifecycle(t *testing.T) {
+	_, provider := newTestCalDAV(t)
+	ctx := context.Background()
+
+	created, err := provider.CreateEvent(ctx, NewEvent("Planning", "2026-10-20T15:00:00Z", "2026-10-20T16:00:00Z", "Agenda", []string{"bob@example.com"}, "UTC"), WriteOptions{})
+	if err != nil {
+		t.Fatalf("CreateEvent() = %v", err)
+	}
+
+	steps := []struct {
+		name    string
+		run     func() (*calendar.Event, error)
+		summary string
+		err     error
+	}{
+		{"get", func() (*calendar.Event, error) { return provider.GetEvent(ctx, created.Id) }, "Planning", nil},
+		{"patch", func() (*calendar.Event, error) {
+			return provider.PatchEvent(ctx, created.Id, &calendar.Event{Summary: "Review"}, WriteOptions{})
+		}, "Review", nil},
+		{"get patched", func() (*calendar.Event, error) { return provider.GetEvent(ctx, created.Id) }, "Review", nil},
+		{"delete", func() (*calendar.Event, error) { return nil, provider.DeleteEvent(ctx, created.Id, WriteOptions{}) }, "", nil},
+		{"get deleted", func() (*calendar.Event, error) { return provider.GetEvent(ctx, created.Id) }, "", ErrNotFound},
+		{"delete again", func() (*calendar.Event, error) { return nil, provider.DeleteEvent(ctx, created.Id, WriteOptions{}) }, "", ErrNotFound},
+	}
+
+	for _, step := range steps {
+		event, err := step.run()
+		if !errors.Is(err, step.err) {
+			t.Fatalf("%s: error = %v, want %v", step.name, err, step.err)
+		}
+		if step.summary != "" && event.Summary != step.summary {
+			t.Errorf("%s: summary = %q, want %q", step.name, event.Summary, step.summary)
+		}
+	}
+}
+
+func TestCalDAVUpdateKeepsChangedInstances(t *testing.T) {
+	server, provider := newTestCalDAV(t)
+	server.objects["/calendars/alice/personal/standup.ics"] = strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//test//EN",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTAMP:20261001T000000Z",
+		"DTSTART:20261019T090000Z",
+		"DTEND:20261019T091500Z",
+		"RRULE:FREQ=DAILY;COUNT=5",
+		"SUMMARY:Standup",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTAMP:20261001T000000Z",
+		"RECURRENCE-ID:20261021T090000Z",
+		"DTSTART:20261021T100000Z",
+		"DTEND:20261021T101500Z",
+		"SUMMARY:Late standup",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	tests := []struct {
+		name      string
+		patch     *calendar.Event
+		overrides int
+	}{
+		{"rename keeps the moved instance", &calendar.Event{Summary: "Daily"}, 1},
+		{"no longer repeating drops it", &calendar.Event{Recurrence: []string{}, ForceSendFields: []string{"Recurrence"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := provider.PatchEvent(context.Background(), "standup", tt.patch, WriteOptions{}); err != nil {
+				t.Fatalf("PatchEvent() = %v", err)
+			}
+			stored := server.objects["/calendars/alice/personal/standup.ics"]
+			if got := strings.Count(stored, "RECURRENCE-ID"); got != tt.overrides {
+				t.Errorf("stored object has %d RECURRENCE-ID components, want %d:\n%s", got, tt.overrides, stored)
+			}
+			if tt.overrides > 0 && !strings.Contains(stored, "SUMMARY:Late standup") {
+				t.Errorf("moved instance lost its changes:\n%s", stored)
+			}
+		})
+	}
+}
+
+func TestCalDAVFindMatchesWholeUID(t *testing.T) {
+	server, provider := newTestCalDAV(t)
+	ctx := context.Background()
+	for _, uid := range []string{"abc-1", "abc"} {
+		event := NewEvent("Event "+uid, "2026-10-20T15:00:00Z", "2026-10-20T16:00:00Z", "", nil, "UTC")
+		event.ICalUID = uid
+		if _, err := provider.CreateEvent(ctx, event, WriteOptions{}); err != nil {
+			t.Fatalf("CreateEvent(%s) = %v", uid, err)
+		}
+	}
+
+	steps := []struct {
+		name    string
+		run     func() (*calendar.Event, error)
+		summary string
+		err     error
+	}{
+		{"get contained UID", func() (*calendar.Event, error) { return provider.GetEvent(ctx, "abc") }, "Event abc", nil},
+		{"patch contained UID", func() (*calendar.Event, error) {
+			return provider.PatchEvent(ctx, "abc", &calendar.Event{Summary: "Renamed abc"}, WriteOptions{})
+		}, "Renamed abc", nil},
+		{"other event untouched", func() (*calendar.Event, error) { return provider.GetEvent(ctx, "abc-1") }, "Event abc-1", nil},
+		{"delete contained UID", func() (*calendar.Event, error) { return nil, provider.DeleteEvent(ctx, "abc", WriteOptions{}) }, "", nil},
+		{"get deleted", func() (*calendar.Event, error) { return provider.GetEvent(ctx, "abc") }, "", ErrNotFound},
+		{"other event kept", func() (*calendar.Event, error) { return provider.GetEvent(ctx, "abc-1") }, "Event abc-1", nil},
+		{"prefix of a UID", func() (*calendar.Event, error) { return provider.GetEvent(ctx, "ab") }, "", ErrNotFound},
+	}
+
+	for _, step := range steps {
+		event, err := step.run()
+		if !errors.Is(err, step.err) {
+			t.Fatalf("%s: error = %v, want %v", step.name, err, step.err)
+		}
+		if step.summary != "" && event.Summary != step.summary {
+			t.Errorf("%s: summary = %q, want %q", step.name, event.Summary, step.summary)
+		}
+	}
+	if len(server.objects) != 1 {
+		t.Errorf("%d objects left on the server, want 1", len(server.objects))
+	}
+}
@@ -1,100 +1,88 @@
 package calendar
 
 import (
-	"context"
 	"fmt"
 	"time"
 
-	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
-	"google.golang.org/api/option"
 )
 
-func GetCalendarEvents(token string) ([]*calendar.Event, error) {
-	ctx := context.Background()
-	client := option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+// Values accepted by the Calendar API's sendUpdates parameter, controlling
+// whether Google emails attendees about changes and cancellations
+const (
+	SendUpdatesAll          = "all"
+	SendUpdatesExternalOnly = "externalOnly"
+	SendUpdatesNone         = "none"
+)
 
-	srv, err := calendar.NewService(ctx, client)
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
+// ValidSendUpdates reports whether v is a sendUpdates value Google accepts
+func ValidSendUpdates(v string) bool {
+	switch v {
+	case SendUpdatesAll, SendUpdatesExternalOnly, SendUpdatesNone:
+		return true
 	}
+	return false
+}
 
-	events, err := srv.Events.List("primary").Do()
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve events: %v", err)
+// NewEvent builds a calendar event from the fields the meeting endpoints
+// accept. timeZone is an IANA zone name; empty leaves the zone to the
+// offsets in startTime and endTime.
+func NewEvent(title, startTime, endTime, description string, attendees []string, timeZone string) *calendar.Event {
+	return &calendar.Event{
+		Summary:     title,
+		Description: description,
+		Start:       NewEventDateTime(startTime, timeZone),
+		End:         NewEventDateTime(endTime, timeZone),
+		Attendees:   NewAttendees(attendees),
 	}
-
-	return events.Items, nil
 }
 
-// GetUpcomingWeekEvents retrieves events for the upcoming week only
-func GetUpcomingWeekEvents(token string) ([]*calendar.Event, error) {
-	ctx := context.Background()
-	client := option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
-
-	srv, err := calendar.NewService(ctx, client)
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
+// NewEventDateTime wraps an RFC3339 timestamp for use as an event start or end
+func NewEventDateTime(dateTime, timeZone string) *calendar.EventDateTime {
+	return &calendar.EventDateTime{
+		DateTime: dateTime,
+		TimeZone: timeZone,
 	}
-
-	// Calculate time bounds for the next week
-	now := time.Now()
-	oneWeekLater := now.AddDate(0, 0, 7)
-
-	// Format times in RFC3339 format as required by Google Calendar API
-	timeMin := now.Format(time.RFC3339)
-	timeMax := oneWeekLater.Format(time.RFC3339)
-
-	// Query events within the time range
-	events, err := srv.Events.List("primary").
-		TimeMin(timeMin).
-		TimeMax(timeMax).
-		OrderBy("startTime").
-		SingleEvents(true). // Expand recurring events
-		Do()
-
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve events: %v", err)
-	}
-
-	return events.Items, nil
 }
 
-func CreateEvent(token string, title, startTime, endTime, description string, attendees []string) error {
-	ctx := context.Background()
-	client := option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
-
-	srv, err := calendar.NewService(ctx, client)
-	if err != nil {
-		fmt.Println("Error creating Calendar service:", err)
-		return fmt.Errorf("unable to retrieve Calendar client: %v", err)
+// LoadTimeZone validates an IANA time zone name such as "Europe/Berlin"
+func LoadTimeZone(name string) (*time.Location, error) {
+	// LoadLocation also accepts "" and "Local", which mean nothing to
+	// other clients of the calendar
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("invalid time zone %q", name)
 	}
-
-	event := &calendar.Event{
-		Summary:     title,
-		Description: description,
-		Start: &calendar.EventDateTime{
-			DateTime: startTime,
-			TimeZone: "Asia/Kolkata",
-		},
-		End: &calendar.EventDateTime{
-			DateTime: endTime,
-			TimeZone: "Asia/Kolkata",
-		},
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q", name)
 	}
+	return loc, nil
+}
 
+// NewAttendees turns a list of email addresses into event attendees
+func NewAttendees(emails []string) []*calendar.EventAttendee {
 	var attendeeList []*calendar.EventAttendee
-	for _, email := range attendees {
+	for _, email := range emails {
 		attendeeList = append(attendeeList, &calendar.EventAttendee{Email: email})
 	}
+	return attendeeList
+}
 
-	event.Attendees = attendeeList
-	createdEvent, err := srv.Events.Insert("primary", event).Do()
-	if err != nil {
-		fmt.Println("Error inserting event into calendar:", err)
-		return fmt.Errorf("unable to create event: %v", err)
+// ParseEventDateTime converts an event start or end into a time. All-day
+// dates are taken as midnight in the event's time zone (UTC if unset).
+func ParseEventDateTime(dt *calendar.EventDateTime) (time.Time, error) {
+	if dt == nil {
+		return time.Time{}, fmt.Errorf("missing event time")
+	}
+	if dt.DateTime != "" {
+		return time.Parse(time.RFC3339, dt.DateTime)
 	}
 
-	fmt.Println("Meeting Created:", createdEvent.HtmlLink)
-	return nil
+	loc := time.UTC
+	if dt.TimeZone != "" {
+		if l, err := time.LoadLocation(dt.TimeZone); err == nil {
+			loc = l
+		}
+	}
+	return time.ParseInLocation("2006-01-02", dt.Date, loc)
 }
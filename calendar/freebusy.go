@@ -0,0 +1,63 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// FindConflicts returns, for each of the calendars that is busy at some
+// point during [start, end), the busy periods overlapping that range.
+// Calendars that are free, or whose availability can't be looked up, are
+// left out.
+func FindConflicts(ctx context.Context, provider CalendarProvider, start, end time.Time, calendars []string) (map[string][]*calendar.TimePeriod, error) {
+	busy, err := provider.FreeBusy(ctx, start, end, uniqueCalendars(calendars))
+	if err != nil {
+		return nil, err
+	}
+
+	meeting := Interval{Start: start, End: end}
+	conflicts := make(map[string][]*calendar.TimePeriod)
+	for id, periods := range busy {
+		for _, period := range periods {
+			interval, err := ParseTimePeriod(period)
+			if err != nil || !interval.Overlaps(meeting) {
+				continue
+			}
+			conflicts[id] = append(conflicts[id], period)
+		}
+	}
+	return conflicts, nil
+}
+
+// ParseTimePeriod converts a free/busy period into an Interval
+func ParseTimePeriod(period *calendar.TimePeriod) (Interval, error) {
+	start, err := time.Parse(time.RFC3339, period.Start)
+	if err != nil {
+		return Interval{}, fmt.Errorf("invalid busy period start: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, period.End)
+	if err != nil {
+		return Interval{}, fmt.Errorf("invalid busy period end: %v", err)
+	}
+	return Interval{Start: start, End: end}, nil
+}
+
+// uniqueCalendars drops empty and repeated calendar IDs, ignoring case
+// since they are usually email addresses
+func uniqueCalendars(calendars []string) []string {
+	seen := make(map[string]bool, len(calendars))
+	var unique []string
+	for _, id := range calendars {
+		key := strings.ToLower(strings.TrimSpace(id))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, strings.TrimSpace(id))
+	}
+	return unique
+}
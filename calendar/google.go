@@ -0,0 +1,361 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// GoogleProvider talks to the Google Calendar v3 API on behalf of one user
+type GoogleProvider struct {
+	srv        *calendar.Service
+	calendarID string
+}
+
+// NewGoogleProvider builds a Calendar client on top of the user's token
+// source so expired access tokens are refreshed transparently
+func NewGoogleProvider(ctx context.Context, ts oauth2.TokenSource) (*GoogleProvider, error) {
+	srv, err := calendar.NewService(ctx, option.WithTokenSource(ts))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Calendar client: %v", err)
+	}
+	return &GoogleProvider{srv: srv, calendarID: PrimaryCalendar}, nil
+}
+
+// googleError tags Google API errors with the matching provider error so
+// callers can react without knowing about googleapi
+func googleError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch apiErr.Code {
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrForbidden, err)
+	case http.StatusBadRequest:
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+	return err
+}
+
+// CalendarTimeZone reads the time zone from the user's calendar settings
+func (p *GoogleProvider) CalendarTimeZone(ctx context.Context) (string, error) {
+	setting, err := p.srv.Settings.Get("timezone").Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve calendar time zone: %w", googleError(err))
+	}
+	return setting.Value, nil
+}
+
+// ListCalendars reads the user's calendar list, which includes calendars
+// shared with them and the resource calendars they've added
+func (p *GoogleProvider) ListCalendars(ctx context.Context) ([]*CalendarInfo, error) {
+	var calendars []*CalendarInfo
+	err := p.srv.CalendarList.List().Context(ctx).Pages(ctx, func(list *calendar.CalendarList) error {
+		for _, entry := range list.Items {
+			name := entry.SummaryOverride
+			if name == "" {
+				name = entry.Summary
+			}
+			calendars = append(calendars, &CalendarInfo{
+				ID:          entry.Id,
+				Name:        name,
+				Description: entry.Description,
+				TimeZone:    entry.TimeZone,
+				Color:       entry.BackgroundColor,
+				Primary:     entry.Primary,
+				AccessRole:  entry.AccessRole,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve calendars: %w", googleError(err))
+	}
+	return calendars, nil
+}
+
+// WithCalendar returns a provider for another calendar. Google reports
+// unknown calendars once they're used.
+func (p *GoogleProvider) WithCalendar(ctx context.Context, calendarID string) (CalendarProvider, error) {
+	return &GoogleProvider{srv: p.srv, calendarID: calendarID}, nil
+}
+
+// ListEvents retrieves the events within the window, expanding recurring
+// events. Without MaxResults all of Google's pages are followed.
+func (p *GoogleProvider) ListEvents(ctx context.Context, opts ListOptions) (*EventPage, error) {
+	call := p.srv.Events.List(p.calendarID).
+		Context(ctx).
+		OrderBy("startTime").
+		SingleEvents(true) // Expand recurring events
+
+	// Format times in RFC3339 format as required by Google Calendar API
+	if !opts.TimeMin.IsZero() {
+		call = call.TimeMin(opts.TimeMin.Format(time.RFC3339))
+	}
+	if !opts.TimeMax.IsZero() {
+		call = call.TimeMax(opts.TimeMax.Format(time.RFC3339))
+	}
+	if opts.PageToken != "" {
+		call = call.PageToken(opts.PageToken)
+	}
+
+	if opts.MaxResults > 0 {
+		events, err := call.MaxResults(int64(opts.MaxResults)).Do()
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve events: %w", googleError(err))
+		}
+		return &EventPage{Items: events.Items, NextPageToken: events.NextPageToken}, nil
+	}
+
+	page := &EventPage{}
+	err := call.Pages(ctx, func(events *calendar.Events) error {
+		page.Items = append(page.Items, events.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve events: %w", googleError(err))
+	}
+	return page, nil
+}
+
+// SyncEvents lists what changed since the sync token, or every event when
+// the token is empty, following all of Google's pages. Google answers 410
+// Gone once a token has expired.
+func (p *GoogleProvider) SyncEvents(ctx context.Context, syncToken string) (*SyncResult, error) {
+	call := p.srv.Events.List(p.calendarID).
+		Context(ctx).
+		SingleEvents(true).
+		MaxResults(2500)
+	if syncToken != "" {
+		call = call.SyncToken(syncToken)
+	}
+
+	result := &SyncResult{}
+	err := call.Pages(ctx, func(events *calendar.Events) error {
+		result.Items = append(result.Items, events.Items...)
+		result.NextSyncToken = events.NextSyncToken
+		return nil
+	})
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+			return nil, fmt.Errorf("unable to sync events: %w", ErrSyncTokenExpired)
+		}
+		return nil, fmt.Errorf("unable to sync events: %w", googleError(err))
+	}
+	return result, nil
+}
+
+// WatchEvents opens a web_hook channel for the calendar's events
+func (p *GoogleProvider) WatchEvents(ctx context.Context, channelID, address, token string, ttl time.Duration) (string, time.Time, error) {
+	request := &calendar.Channel{
+		Id:      channelID,
+		Type:    "web_hook",
+		Address: address,
+		Token:   token,
+	}
+	if ttl > 0 {
+		request.Params = map[string]string{"ttl": strconv.Itoa(int(ttl.Seconds()))}
+	}
+
+	channel, err := p.srv.Events.Watch(p.calendarID, request).Context(ctx).Do()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to watch events: %w", googleError(err))
+	}
+	return channel.ResourceId, time.UnixMilli(channel.Expiration), nil
+}
+
+// StopWatching closes a channel opened by WatchEvents
+func (p *GoogleProvider) StopWatching(ctx context.Context, channelID, resourceID string) error {
+	err := p.srv.Channels.Stop(&calendar.Channel{Id: channelID, ResourceId: resourceID}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to stop watching events: %w", googleError(err))
+	}
+	return nil
+}
+
+// ListInstances retrieves the instances of a recurring event within the window
+func (p *GoogleProvider) ListInstances(ctx context.Context, eventID string, opts ListOptions) (*EventPage, error) {
+	call := p.srv.Events.Instances(p.calendarID, eventID).Context(ctx)
+	if !opts.TimeMin.IsZero() {
+		call = call.TimeMin(opts.TimeMin.Format(time.RFC3339))
+	}
+	if !opts.TimeMax.IsZero() {
+		call = call.TimeMax(opts.TimeMax.Format(time.RFC3339))
+	}
+	if opts.PageToken != "" {
+		call = call.PageToken(opts.PageToken)
+	}
+
+	if opts.MaxResults > 0 {
+		events, err := call.MaxResults(int64(opts.MaxResults)).Do()
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve instances: %w", googleError(err))
+		}
+		return &EventPage{Items: events.Items, NextPageToken: events.NextPageToken}, nil
+	}
+
+	page := &EventPage{}
+	err := call.Pages(ctx, func(events *calendar.Events) error {
+		page.Items = append(page.Items, events.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve instances: %w", googleError(err))
+	}
+	return page, nil
+}
+
+// GetEvent retrieves a single event
+func (p *GoogleProvider) GetEvent(ctx context.Context, eventID string) (*calendar.Event, error) {
+	event, err := p.srv.Events.Get(p.calendarID, eventID).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve event: %w", googleError(err))
+	}
+	return event, nil
+}
+
+// FindByICalUID looks up the event with the given iCalendar UID. Google
+// lists the series together with its changed instances.
+func (p *GoogleProvider) FindByICalUID(ctx context.Context, uid string) (*calendar.Event, error) {
+	events, err := p.srv.Events.List(p.calendarID).Context(ctx).ICalUID(uid).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve event: %w", googleError(err))
+	}
+	for _, event := range events.Items {
+		if event.Status != "cancelled" && event.RecurringEventId == "" {
+			return event, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to retrieve event: %w", ErrNotFound)
+}
+
+// CreateEvent inserts a new event into the calendar
+func (p *GoogleProvider) CreateEvent(ctx context.Context, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	call := p.srv.Events.Insert(p.calendarID, event).Context(ctx)
+	if opts.SendUpdates != "" {
+		call = call.SendUpdates(opts.SendUpdates)
+	}
+	if event.ConferenceData != nil {
+		// Without version 1 Google ignores the conference data
+		call = call.ConferenceDataVersion(1)
+	}
+
+	createdEvent, err := call.Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create event: %w", googleError(err))
+	}
+	return createdEvent, nil
+}
+
+// UpdateEvent replaces an existing event with the given one
+func (p *GoogleProvider) UpdateEvent(ctx context.Context, eventID string, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	call := p.srv.Events.Update(p.calendarID, eventID, event).Context(ctx)
+	if opts.SendUpdates != "" {
+		call = call.SendUpdates(opts.SendUpdates)
+	}
+	if event.ConferenceData != nil {
+		// Without version 1 Google ignores the conference data
+		call = call.ConferenceDataVersion(1)
+	}
+
+	updatedEvent, err := call.Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", googleError(err))
+	}
+	return updatedEvent, nil
+}
+
+// PatchEvent changes only the fields set on patch, leaving the rest of the
+// event as it is
+func (p *GoogleProvider) PatchEvent(ctx context.Context, eventID string, patch *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	call := p.srv.Events.Patch(p.calendarID, eventID, patch).Context(ctx)
+	if opts.SendUpdates != "" {
+		call = call.SendUpdates(opts.SendUpdates)
+	}
+	if patch.ConferenceData != nil {
+		// Without version 1 Google ignores the conference data
+		call = call.ConferenceDataVersion(1)
+	}
+
+	patchedEvent, err := call.Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", googleError(err))
+	}
+	return patchedEvent, nil
+}
+
+// RespondToEvent sets the user's own attendee status. Attendee lists are
+// replaced as a whole by patches, so the full list is sent back.
+func (p *GoogleProvider) RespondToEvent(ctx context.Context, eventID string, rsvp RSVP, opts WriteOptions) (*calendar.Event, error) {
+	event, err := p.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if err := setResponse(event, "", rsvp); err != nil {
+		return nil, fmt.Errorf("unable to respond to event: %w", err)
+	}
+
+	patched, err := p.PatchEvent(ctx, eventID, &calendar.Event{Attendees: event.Attendees}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to respond to event: %w", err)
+	}
+	return patched, nil
+}
+
+// DeleteEvent cancels an event, optionally notifying its attendees
+func (p *GoogleProvider) DeleteEvent(ctx context.Context, eventID string, opts WriteOptions) error {
+	call := p.srv.Events.Delete(p.calendarID, eventID).Context(ctx)
+	if opts.SendUpdates != "" {
+		call = call.SendUpdates(opts.SendUpdates)
+	}
+
+	if err := call.Do(); err != nil {
+		return fmt.Errorf("unable to delete event: %w", googleError(err))
+	}
+	return nil
+}
+
+// FreeBusy queries the Google FreeBusy API for the given calendars.
+// Calendars Google can't look up (e.g. external accounts) are left out.
+func (p *GoogleProvider) FreeBusy(ctx context.Context, timeMin, timeMax time.Time, calendars []string) (map[string][]*calendar.TimePeriod, error) {
+	request := &calendar.FreeBusyRequest{
+		TimeMin: timeMin.Format(time.RFC3339),
+		TimeMax: timeMax.Format(time.RFC3339),
+	}
+	for _, id := range calendars {
+		request.Items = append(request.Items, &calendar.FreeBusyRequestItem{Id: id})
+	}
+
+	response, err := p.srv.Freebusy.Query(request).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to query free/busy: %w", googleError(err))
+	}
+
+	busy := make(map[string][]*calendar.TimePeriod, len(calendars))
+	for _, id := range calendars {
+		fbCalendar, ok := response.Calendars[id]
+		if !ok {
+			continue
+		}
+		if len(fbCalendar.Errors) > 0 {
+			log.Printf("Free/busy unavailable for %s: %s", id, fbCalendar.Errors[0].Reason)
+			continue
+		}
+		busy[id] = fbCalendar.Busy
+	}
+	return busy, nil
+}
@@ -0,0 +1,270 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// ICalUIDFinder is implemented by providers that can look an event up by
+// its iCalendar UID
+type ICalUIDFinder interface {
+	// FindByICalUID returns the single event or series master with the
+	// UID, or ErrNotFound
+	FindByICalUID(ctx context.Context, uid string) (*calendar.Event, error)
+}
+
+// Outcomes of importing an event, reported in ImportItem.Status
+const (
+	// ImportNew is an event a dry run would create
+	ImportNew = "new"
+	// ImportCreated is an event that was created
+	ImportCreated = "created"
+	// ImportDuplicate is an event already in the calendar, or listed twice
+	ImportDuplicate = "duplicate"
+	// ImportInvalid is an event that can't be created as given
+	ImportInvalid = "invalid"
+	// ImportFailed is an event the provider refused to create
+	ImportFailed = "failed"
+)
+
+// ImportItem reports what importing one event of an iCalendar file did,
+// or would do in a dry run. A recurring event is one item together with
+// its changed and cancelled occurrences.
+type ImportItem struct {
+	ICalUID    string   `json:"iCalUID,omitempty"`
+	Title      string   `json:"title"`
+	Start      string   `json:"start"`
+	End        string   `json:"end"`
+	TimeZone   string   `json:"timeZone,omitempty"`
+	Recurrence []string `json:"recurrence,omitempty"`
+	Attendees  []string `json:"attendees,omitempty"`
+	// Exceptions counts the changed or cancelled occurrences of a series
+	Exceptions int    `json:"exceptions,omitempty"`
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	// EventID is the created event, or the existing one for duplicates
+	EventID string `json:"eventId,omitempty"`
+
+	event      *calendar.Event
+	exceptions []*calendar.Event
+}
+
+// ImportEvents creates decoded iCalendar events in the calendar, skipping
+// those whose UID is already there. Events without a UID are imported
+// without that check. With dryRun nothing is created and the new events
+// are reported as ImportNew.
+func ImportEvents(ctx context.Context, provider CalendarProvider, events []*calendar.Event, dryRun bool, opts WriteOptions) ([]*ImportItem, error) {
+	items := groupImport(events)
+
+	for _, item := range items {
+		if item.Status != "" {
+			continue
+		}
+		if err := validateImport(item.event); err != nil {
+			item.Status = ImportInvalid
+			item.Reason = err.Error()
+			continue
+		}
+
+		existing, err := findExisting(ctx, provider, item.event)
+		if err != nil {
+			return nil, fmt.Errorf("unable to check for existing events: %w", err)
+		}
+		if existing != nil {
+			item.Status = ImportDuplicate
+			item.Reason = "already in the calendar"
+			item.EventID = existing.Id
+			if existing.RecurringEventId != "" {
+				item.EventID = existing.RecurringEventId
+			}
+			continue
+		}
+
+		if dryRun {
+			item.Status = ImportNew
+			continue
+		}
+		importItem(ctx, provider, item, opts)
+	}
+	return items, nil
+}
+
+// groupImport pairs each series with its changed occurrences, which share
+// its UID. Repeated UIDs and occurrences without their series are marked
+// right away.
+func groupImport(events []*calendar.Event) []*ImportItem {
+	var items []*ImportItem
+	byUID := map[string]*ImportItem{}
+	var orphans []*calendar.Event
+
+	for _, event := range events {
+		if event.OriginalStartTime != nil {
+			orphans = append(orphans, event)
+			continue
+		}
+
+		item := newImportItem(event)
+		items = append(items, item)
+		if event.ICalUID == "" {
+			continue
+		}
+		if _, seen := byUID[event.ICalUID]; seen {
+			item.Status = ImportDuplicate
+			item.Reason = "UID appears more than once in the file"
+			continue
+		}
+		byUID[event.ICalUID] = item
+	}
+
+	for _, event := range orphans {
+		if item, ok := byUID[event.ICalUID]; ok && len(item.event.Recurrence) > 0 {
+			item.exceptions = append(item.exceptions, event)
+			item.Exceptions++
+			continue
+		}
+		item := newImportItem(event)
+		item.Status = ImportInvalid
+		item.Reason = "changed occurrence of a recurring event that isn't in the file"
+		items = append(items, item)
+	}
+	return items
+}
+
+func newImportItem(event *calendar.Event) *ImportItem {
+	item := &ImportItem{
+		ICalUID:    event.ICalUID,
+		Title:      event.Summary,
+		Recurrence: event.Recurrence,
+		event:      event,
+	}
+	if event.Start != nil {
+		item.Start = event.Start.DateTime + event.Start.Date
+		item.TimeZone = event.Start.TimeZone
+	}
+	if event.End != nil {
+		item.End = event.End.DateTime + event.End.Date
+	}
+	for _, attendee := range event.Attendees {
+		item.Attendees = append(item.Attendees, attendee.Email)
+	}
+	return item
+}
+
+// validateImport applies the checks CreateEvent would make, so dry runs
+// report them too
+func validateImport(event *calendar.Event) error {
+	if event.Status == "cancelled" {
+		return errors.New("event is cancelled")
+	}
+	return validateEvent(event)
+}
+
+// findExisting returns the event in the calendar matching an imported one.
+// Providers that can't look up UIDs are searched around the event's start
+// for the same UID, or failing that the same title at the same time, since
+// some providers assign UIDs of their own.
+func findExisting(ctx context.Context, provider CalendarProvider, event *calendar.Event) (*calendar.Event, error) {
+	if finder, ok := provider.(ICalUIDFinder); ok && event.ICalUID != "" {
+		existing, err := finder.FindByICalUID(ctx, event.ICalUID)
+		switch {
+		case err == nil:
+			return existing, nil
+		case errors.Is(err, ErrNotFound):
+			return nil, nil
+		case !errors.Is(err, ErrNotSupported):
+			return nil, err
+		}
+	}
+
+	start, end, err := eventBounds(event)
+	if err != nil {
+		return nil, err
+	}
+	if !end.After(start) {
+		end = start.Add(time.Minute)
+	}
+	page, err := provider.ListEvents(ctx, ListOptions{TimeMin: start, TimeMax: end})
+	if err != nil {
+		return nil, err
+	}
+	for _, listed := range page.Items {
+		if event.ICalUID != "" && listed.ICalUID == event.ICalUID {
+			return listed, nil
+		}
+		listedStart, err := ParseEventDateTime(listed.Start)
+		if err == nil && listed.Summary == event.Summary && listedStart.Equal(start) {
+			return listed, nil
+		}
+	}
+	return nil, nil
+}
+
+// importItem creates the event, then applies its changed occurrences.
+// Occurrences that can't be applied are noted on the item.
+func importItem(ctx context.Context, provider CalendarProvider, item *ImportItem, opts WriteOptions) {
+	created, err := provider.CreateEvent(ctx, importedEvent(item.event), opts)
+	if err != nil {
+		log.Printf("Error importing event %s: %v", item.ICalUID, err)
+		item.Status = ImportFailed
+		item.Reason = err.Error()
+		return
+	}
+	item.Status = ImportCreated
+	item.EventID = created.Id
+
+	failed := 0
+	for _, exception := range item.exceptions {
+		if err := importException(ctx, provider, created, exception, opts); err != nil {
+			log.Printf("Error importing changed occurrence of event %s: %v", created.Id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		item.Reason = fmt.Sprintf("%d of %d changed occurrences could not be applied", failed, len(item.exceptions))
+	}
+}
+
+// importException changes or cancels the occurrence of a created series
+// that the exception replaces
+func importException(ctx context.Context, provider CalendarProvider, series, exception *calendar.Event, opts WriteOptions) error {
+	originalStart, err := ParseEventDateTime(exception.OriginalStartTime)
+	if err != nil {
+		return fmt.Errorf("invalid RECURRENCE-ID: %v", err)
+	}
+
+	instances, err := provider.ListInstances(ctx, series.Id, ListOptions{TimeMin: originalStart, TimeMax: originalStart.Add(time.Minute)})
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances.Items {
+		if instanceStart, err := ParseEventDateTime(instance.OriginalStartTime); err != nil || !instanceStart.Equal(originalStart) {
+			continue
+		}
+
+		if exception.Status == "cancelled" {
+			return provider.DeleteEvent(ctx, instance.Id, opts)
+		}
+		changed := importedEvent(exception)
+		changed.RecurringEventId = series.Id
+		changed.OriginalStartTime = instance.OriginalStartTime
+		_, err := provider.UpdateEvent(ctx, instance.Id, changed, opts)
+		return err
+	}
+	return fmt.Errorf("%w: series has no occurrence at %s", ErrNotFound, originalStart.Format(time.RFC3339))
+}
+
+// importedEvent strips what the provider assigns itself from a decoded event
+func importedEvent(event *calendar.Event) *calendar.Event {
+	imported := copyEvent(event)
+	imported.Status = ""
+	imported.HtmlLink = ""
+	imported.Organizer = nil
+	imported.RecurringEventId = ""
+	imported.OriginalStartTime = nil
+	return imported
+}
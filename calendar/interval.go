@@ -0,0 +1,55 @@
+package calendar
+
+import (
+	"sort"
+	"time"
+)
+
+// Interval is a half-open time range [Start, End)
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Overlaps reports whether the two intervals share any time
+func (i Interval) Overlaps(other Interval) bool {
+	return i.Start.Before(other.End) && other.Start.Before(i.End)
+}
+
+// MergeIntervals sorts the intervals and joins those that overlap or touch
+func MergeIntervals(intervals []Interval) []Interval {
+	if len(intervals) == 0 {
+		return nil
+	}
+
+	sorted := make([]Interval, len(intervals))
+	copy(sorted, intervals)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	merged := []Interval{sorted[0]}
+	for _, interval := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if !interval.Start.After(last.End) {
+			last.End = maxTime(last.End, interval.End)
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,220 @@
+package calendar
+
+import (
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Meeting is the representation of an event returned by the meeting
+// endpoints. Unlike the raw provider event it has a fixed shape whichever
+// calendar backend the user is on.
+type Meeting struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Location    string `json:"location,omitempty"`
+	Status      string `json:"status"`
+	// Visibility is "default", "public", "private" or "confidential"
+	Visibility string `json:"visibility,omitempty"`
+	// StartTime and EndTime are RFC3339 times, or YYYY-MM-DD dates for
+	// all-day meetings
+	StartTime string `json:"startTime"`
+	EndTime   string `json:"endTime"`
+	AllDay    bool   `json:"allDay"`
+	// TimeZone is the zone the meeting was scheduled in, if any
+	TimeZone string `json:"timeZone,omitempty"`
+	// Recurrence is set on recurring meetings; their instances name the
+	// series in RecurringEventID instead
+	Recurrence        []string            `json:"recurrence,omitempty"`
+	RecurringEventID  string              `json:"recurringEventId,omitempty"`
+	OriginalStartTime string              `json:"originalStartTime,omitempty"`
+	Link              string              `json:"link"`
+	Organizer         *MeetingPerson      `json:"organizer,omitempty"`
+	Attendees         []MeetingAttendee   `json:"attendees"`
+	Conference        *MeetingConference  `json:"conference,omitempty"`
+	Reminders         *MeetingReminders   `json:"reminders,omitempty"`
+	Attachments       []MeetingAttachment `json:"attachments,omitempty"`
+	Created           string              `json:"created,omitempty"`
+	Updated           string              `json:"updated,omitempty"`
+}
+
+// MeetingPerson identifies the organizer of a meeting
+type MeetingPerson struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+	// Self is set when the person is the signed-in user
+	Self bool `json:"self,omitempty"`
+}
+
+// MeetingAttendee is someone invited to a meeting
+type MeetingAttendee struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+	// ResponseStatus is "needsAction", "accepted", "declined" or "tentative"
+	ResponseStatus string `json:"responseStatus,omitempty"`
+	Comment        string `json:"comment,omitempty"`
+	Optional       bool   `json:"optional,omitempty"`
+	Organizer      bool   `json:"organizer,omitempty"`
+	Self           bool   `json:"self,omitempty"`
+}
+
+// MeetingConference describes a meeting's video conference
+type MeetingConference struct {
+	Type string `json:"type,omitempty"`
+	ID   string `json:"id,omitempty"`
+	// Status is "pending" while Google is still creating the conference
+	Status      string              `json:"status,omitempty"`
+	MeetLink    string              `json:"meetLink,omitempty"`
+	EntryPoints []MeetingEntryPoint `json:"entryPoints,omitempty"`
+}
+
+// MeetingEntryPoint is one way of joining a conference, e.g. by video or phone
+type MeetingEntryPoint struct {
+	Type  string `json:"type"`
+	URI   string `json:"uri"`
+	Label string `json:"label,omitempty"`
+	PIN   string `json:"pin,omitempty"`
+}
+
+// MeetingReminders lists when attendees are reminded of a meeting
+type MeetingReminders struct {
+	// UseDefault means the calendar's default reminders apply
+	UseDefault bool              `json:"useDefault"`
+	Overrides  []MeetingReminder `json:"overrides,omitempty"`
+}
+
+// MeetingReminder is a single reminder
+type MeetingReminder struct {
+	// Method is "email" or "popup"
+	Method  string `json:"method"`
+	Minutes int64  `json:"minutes"`
+}
+
+// MeetingAttachment is a file attached to a meeting
+type MeetingAttachment struct {
+	Title    string `json:"title,omitempty"`
+	FileURL  string `json:"fileUrl"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// NewMeeting converts a provider event into a Meeting, rendering times in loc
+func NewMeeting(event *calendar.Event, loc *time.Location) *Meeting {
+	meeting := &Meeting{
+		ID:               event.Id,
+		Title:            event.Summary,
+		Description:      event.Description,
+		Location:         event.Location,
+		Status:           event.Status,
+		Visibility:       event.Visibility,
+		Link:             event.HtmlLink,
+		Attendees:        NewMeetingAttendees(event.Attendees),
+		Recurrence:       event.Recurrence,
+		RecurringEventID: event.RecurringEventId,
+		Created:          event.Created,
+		Updated:          event.Updated,
+	}
+
+	meeting.StartTime, meeting.AllDay = meetingTime(event.Start, loc)
+	meeting.EndTime, _ = meetingTime(event.End, loc)
+	meeting.OriginalStartTime, _ = meetingTime(event.OriginalStartTime, loc)
+	if event.Start != nil {
+		meeting.TimeZone = event.Start.TimeZone
+	}
+	if event.Organizer != nil {
+		meeting.Organizer = &MeetingPerson{
+			Email: event.Organizer.Email,
+			Name:  event.Organizer.DisplayName,
+			Self:  event.Organizer.Self,
+		}
+	}
+
+	if event.ConferenceData != nil || event.HangoutLink != "" {
+		meeting.Conference = newMeetingConference(event)
+	}
+
+	if event.Reminders != nil {
+		meeting.Reminders = &MeetingReminders{UseDefault: event.Reminders.UseDefault}
+		for _, reminder := range event.Reminders.Overrides {
+			meeting.Reminders.Overrides = append(meeting.Reminders.Overrides, MeetingReminder{
+				Method:  reminder.Method,
+				Minutes: reminder.Minutes,
+			})
+		}
+	}
+
+	for _, attachment := range event.Attachments {
+		meeting.Attachments = append(meeting.Attachments, MeetingAttachment{
+			Title:    attachment.Title,
+			FileURL:  attachment.FileUrl,
+			MimeType: attachment.MimeType,
+		})
+	}
+
+	return meeting
+}
+
+// NewMeetingAttendees converts event attendees, keeping their responses
+func NewMeetingAttendees(attendees []*calendar.EventAttendee) []MeetingAttendee {
+	converted := []MeetingAttendee{}
+	for _, attendee := range attendees {
+		converted = append(converted, MeetingAttendee{
+			Email:          attendee.Email,
+			Name:           attendee.DisplayName,
+			ResponseStatus: attendee.ResponseStatus,
+			Comment:        attendee.Comment,
+			Optional:       attendee.Optional,
+			Organizer:      attendee.Organizer,
+			Self:           attendee.Self,
+		})
+	}
+	return converted
+}
+
+func newMeetingConference(event *calendar.Event) *MeetingConference {
+	conference := &MeetingConference{MeetLink: MeetLink(event)}
+
+	data := event.ConferenceData
+	if data == nil {
+		return conference
+	}
+
+	conference.ID = data.ConferenceId
+	if data.ConferenceSolution != nil && data.ConferenceSolution.Key != nil {
+		conference.Type = data.ConferenceSolution.Key.Type
+	}
+	if data.CreateRequest != nil {
+		if conference.Type == "" && data.CreateRequest.ConferenceSolutionKey != nil {
+			conference.Type = data.CreateRequest.ConferenceSolutionKey.Type
+		}
+		if data.CreateRequest.Status != nil {
+			conference.Status = data.CreateRequest.Status.StatusCode
+		}
+	}
+	for _, entryPoint := range data.EntryPoints {
+		conference.EntryPoints = append(conference.EntryPoints, MeetingEntryPoint{
+			Type:  entryPoint.EntryPointType,
+			URI:   entryPoint.Uri,
+			Label: entryPoint.Label,
+			PIN:   entryPoint.Pin,
+		})
+	}
+	return conference
+}
+
+// meetingTime formats an event start or end, reporting whether it is an
+// all-day date
+func meetingTime(dt *calendar.EventDateTime, loc *time.Location) (string, bool) {
+	if dt == nil {
+		return "", false
+	}
+	if dt.DateTime == "" {
+		return dt.Date, dt.Date != ""
+	}
+
+	t, err := time.Parse(time.RFC3339, dt.DateTime)
+	if err != nil {
+		return dt.DateTime, false
+	}
+	return t.In(loc).Format(time.RFC3339), false
+}
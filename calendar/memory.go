@@ -0,0 +1,617 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goauthDemo/models"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// MemoryProvider is an in-memory CalendarProvider for handler tests and
+// offline development. It mimics the Google Calendar behaviour the
+// handlers rely on: server-assigned IDs, patch semantics, time window
+// queries, recurring events with per-instance exceptions and free/busy
+// computed from the stored events.
+type MemoryProvider struct {
+	mu     sync.Mutex
+	owner  string
+	events map[string]*calendar.Event
+	nextID int
+
+	// info describes this calendar; calendars is shared by every calendar
+	// of the owner, the first being their primary one
+	info      CalendarInfo
+	calendars *memoryCalendars
+
+	// Now is used for created/updated timestamps; tests may override it
+	Now func() time.Time
+}
+
+// memoryCalendars lists the calendars a MemoryProvider owner can see
+type memoryCalendars struct {
+	mu   sync.Mutex
+	list []*MemoryProvider
+}
+
+// NewMemoryProvider creates an empty calendar owned by the given email.
+// Like Google's primary calendar its ID is the owner's email.
+func NewMemoryProvider(ownerEmail string) *MemoryProvider {
+	p := &MemoryProvider{
+		owner:     ownerEmail,
+		events:    make(map[string]*calendar.Event),
+		info:      CalendarInfo{ID: ownerEmail, Name: ownerEmail, Primary: true, AccessRole: "owner"},
+		calendars: &memoryCalendars{},
+		Now:       time.Now,
+	}
+	p.calendars.list = append(p.calendars.list, p)
+	return p
+}
+
+// AddCalendar adds an empty calendar, such as a team or room calendar,
+// that the owner can select with WithCalendar
+func (p *MemoryProvider) AddCalendar(calendarID, name, accessRole string) *MemoryProvider {
+	added := &MemoryProvider{
+		owner:     p.owner,
+		events:    make(map[string]*calendar.Event),
+		info:      CalendarInfo{ID: calendarID, Name: name, AccessRole: accessRole},
+		calendars: p.calendars,
+		Now:       p.Now,
+	}
+
+	p.calendars.mu.Lock()
+	defer p.calendars.mu.Unlock()
+	p.calendars.list = append(p.calendars.list, added)
+	return added
+}
+
+// NewMemoryProviderFactory returns a ProviderFactory that keeps a separate
+// in-memory calendar for every user
+func NewMemoryProviderFactory() ProviderFactory {
+	var mu sync.Mutex
+	providers := make(map[int]*MemoryProvider)
+
+	return func(ctx context.Context, user *models.User) (CalendarProvider, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		provider, ok := providers[user.ID]
+		if !ok {
+			provider = NewMemoryProvider(user.Email)
+			providers[user.ID] = provider
+		}
+		return provider, nil
+	}
+}
+
+// Events returns a copy of every stored event, for assertions in tests
+func (p *MemoryProvider) Events() []*calendar.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := make([]*calendar.Event, 0, len(p.events))
+	for _, event := range p.events {
+		events = append(events, copyEvent(event))
+	}
+	sortEvents(events)
+	return events
+}
+
+// ListCalendars returns the owner's primary calendar and any added ones
+func (p *MemoryProvider) ListCalendars(ctx context.Context) ([]*CalendarInfo, error) {
+	p.calendars.mu.Lock()
+	defer p.calendars.mu.Unlock()
+
+	calendars := make([]*CalendarInfo, 0, len(p.calendars.list))
+	for _, c := range p.calendars.list {
+		info := c.info
+		calendars = append(calendars, &info)
+	}
+	return calendars, nil
+}
+
+// WithCalendar returns one of the owner's calendars
+func (p *MemoryProvider) WithCalendar(ctx context.Context, calendarID string) (CalendarProvider, error) {
+	p.calendars.mu.Lock()
+	defer p.calendars.mu.Unlock()
+
+	for _, c := range p.calendars.list {
+		if c.info.ID == calendarID || (calendarID == PrimaryCalendar && c.info.Primary) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to open calendar %q: %w", calendarID, ErrNotFound)
+}
+
+// ListEvents returns the events overlapping the window ordered by start
+// time, with recurring series expanded into their instances
+func (p *MemoryProvider) ListEvents(ctx context.Context, opts ListOptions) (*EventPage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return paginate(p.occurrences(opts.TimeMin, opts.TimeMax, ""), opts)
+}
+
+// ListInstances returns the instances of a recurring series overlapping the window
+func (p *MemoryProvider) ListInstances(ctx context.Context, eventID string, opts ListOptions) (*EventPage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	master, ok := p.events[eventID]
+	if !ok || master.Status == "cancelled" {
+		return nil, fmt.Errorf("unable to retrieve instances: %w", ErrNotFound)
+	}
+	if !IsRecurring(master) {
+		return nil, fmt.Errorf("unable to retrieve instances: %w: not a recurring event", ErrInvalidRequest)
+	}
+	return paginate(p.occurrences(opts.TimeMin, opts.TimeMax, eventID), opts)
+}
+
+// GetEvent returns a stored event or an instance of a recurring one
+func (p *MemoryProvider) GetEvent(ctx context.Context, eventID string) (*calendar.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	event, ok := p.lookup(eventID)
+	if !ok {
+		return nil, fmt.Errorf("unable to retrieve event: %w", ErrNotFound)
+	}
+	return copyEvent(event), nil
+}
+
+// FindByICalUID returns the single event or series with the given UID
+func (p *MemoryProvider) FindByICalUID(ctx context.Context, uid string) (*calendar.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, event := range p.events {
+		if event.ICalUID == uid && event.Status != "cancelled" && event.RecurringEventId == "" {
+			return copyEvent(event), nil
+		}
+	}
+	return nil, fmt.Errorf("unable to retrieve event: %w", ErrNotFound)
+}
+
+// CreateEvent stores a new event, assigning an ID unless one is given
+func (p *MemoryProvider) CreateEvent(ctx context.Context, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	if err := validateEvent(event); err != nil {
+		return nil, fmt.Errorf("unable to create event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored := copyEvent(event)
+	if stored.Id == "" {
+		p.nextID++
+		stored.Id = fmt.Sprintf("mem%d", p.nextID)
+	} else if _, exists := p.events[stored.Id]; exists {
+		return nil, fmt.Errorf("unable to create event: %w: duplicate ID %s", ErrInvalidRequest, stored.Id)
+	}
+
+	now := p.Now().UTC().Format(time.RFC3339)
+	stored.Kind = "calendar#event"
+	stored.Status = "confirmed"
+	stored.Created = now
+	stored.Updated = now
+	stored.HtmlLink = "memory://events/" + stored.Id
+	if stored.ICalUID == "" {
+		stored.ICalUID = stored.Id + "@memory"
+	}
+	stored.Organizer = &calendar.EventOrganizer{Email: p.owner, Self: true}
+	stored.Creator = &calendar.EventCreator{Email: p.owner, Self: true}
+	p.markSelf(stored)
+	if requestsConference(stored) {
+		fakeConference(stored)
+	}
+
+	p.events[stored.Id] = stored
+	return copyEvent(stored), nil
+}
+
+// UpdateEvent replaces a stored event, keeping its server-managed fields.
+// Changing an instance of a recurring event stores it as an exception.
+func (p *MemoryProvider) UpdateEvent(ctx context.Context, eventID string, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	if err := validateEvent(event); err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing, ok := p.lookup(eventID)
+	if !ok {
+		return nil, fmt.Errorf("unable to update event: %w", ErrNotFound)
+	}
+
+	stored := copyEvent(event)
+	if err := p.store(stored, existing); err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", err)
+	}
+	return copyEvent(stored), nil
+}
+
+// PatchEvent merges the fields set on patch into the stored event. Like
+// Google, nested objects are merged, lists are replaced and fields listed
+// in NullFields are cleared.
+func (p *MemoryProvider) PatchEvent(ctx context.Context, eventID string, patch *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing, ok := p.lookup(eventID)
+	if !ok {
+		return nil, fmt.Errorf("unable to patch event: %w", ErrNotFound)
+	}
+
+	merged, err := mergeEvent(existing, patch)
+	if err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", err)
+	}
+	if err := validateEvent(merged); err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", err)
+	}
+
+	if err := p.store(merged, existing); err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", err)
+	}
+	return copyEvent(merged), nil
+}
+
+// RespondToEvent sets the owner's attendee status
+func (p *MemoryProvider) RespondToEvent(ctx context.Context, eventID string, rsvp RSVP, opts WriteOptions) (*calendar.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing, ok := p.lookup(eventID)
+	if !ok {
+		return nil, fmt.Errorf("unable to respond to event: %w", ErrNotFound)
+	}
+
+	event := copyEvent(existing)
+	if err := setResponse(event, p.owner, rsvp); err != nil {
+		return nil, fmt.Errorf("unable to respond to event: %w", err)
+	}
+	if err := p.store(event, existing); err != nil {
+		return nil, fmt.Errorf("unable to respond to event: %w", err)
+	}
+	return copyEvent(event), nil
+}
+
+// DeleteEvent removes a stored event. Deleting an instance of a recurring
+// event cancels just that occurrence; deleting the series removes all of it.
+func (p *MemoryProvider) DeleteEvent(ctx context.Context, eventID string, opts WriteOptions) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing, ok := p.lookup(eventID)
+	if !ok {
+		return fmt.Errorf("unable to delete event: %w", ErrNotFound)
+	}
+
+	if existing.RecurringEventId != "" {
+		existing.Status = "cancelled"
+		p.events[eventID] = existing
+		return nil
+	}
+
+	delete(p.events, eventID)
+	for id, event := range p.events {
+		if event.RecurringEventId == eventID {
+			delete(p.events, id)
+		}
+	}
+	return nil
+}
+
+// FreeBusy reports a calendar as busy during every stored event it
+// organizes or attends without having declined. Transparent events don't
+// block time, matching Google.
+func (p *MemoryProvider) FreeBusy(ctx context.Context, timeMin, timeMax time.Time, calendars []string) (map[string][]*calendar.TimePeriod, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := p.occurrences(timeMin, timeMax, "")
+
+	busy := make(map[string][]*calendar.TimePeriod, len(calendars))
+	for _, id := range calendars {
+		var intervals []Interval
+		for _, event := range events {
+			if event.Transparency == "transparent" || !p.blocksTime(event, id) {
+				continue
+			}
+			start, end, err := eventBounds(event)
+			if err != nil {
+				continue
+			}
+			intervals = append(intervals, Interval{Start: maxTime(start, timeMin), End: minTime(end, timeMax)})
+		}
+
+		periods := []*calendar.TimePeriod{}
+		for _, interval := range MergeIntervals(intervals) {
+			periods = append(periods, &calendar.TimePeriod{
+				Start: interval.Start.Format(time.RFC3339),
+				End:   interval.End.Format(time.RFC3339),
+			})
+		}
+		busy[id] = periods
+	}
+	return busy, nil
+}
+
+// occurrences returns copies of the events overlapping the window, sorted
+// by start time: single events, changed instances and the expanded
+// instances of recurring series. With a seriesID only that series is
+// included. Cancelled events are left out. The caller holds p.mu.
+func (p *MemoryProvider) occurrences(timeMin, timeMax time.Time, seriesID string) []*calendar.Event {
+	var events []*calendar.Event
+	for _, event := range p.events {
+		if event.Status == "cancelled" {
+			continue
+		}
+		if seriesID != "" && event.Id != seriesID && event.RecurringEventId != seriesID {
+			continue
+		}
+
+		if IsRecurring(event) {
+			instances, err := ExpandRecurrence(event, timeMin, timeMax)
+			if err != nil {
+				continue
+			}
+			for _, instance := range instances {
+				// Changed and cancelled instances are stored separately
+				if _, changed := p.events[instance.Id]; !changed {
+					events = append(events, instance)
+				}
+			}
+			continue
+		}
+
+		start, end, err := eventBounds(event)
+		if err != nil {
+			continue
+		}
+		if !timeMax.IsZero() && !start.Before(timeMax) {
+			continue
+		}
+		if !timeMin.IsZero() && !end.After(timeMin) {
+			continue
+		}
+		events = append(events, copyEvent(event))
+	}
+
+	sortEvents(events)
+	return events
+}
+
+// lookup finds a stored event, or builds the instance of a recurring event
+// the ID refers to. The caller holds p.mu.
+func (p *MemoryProvider) lookup(eventID string) (*calendar.Event, bool) {
+	if event, ok := p.events[eventID]; ok {
+		if event.Status == "cancelled" {
+			return nil, false
+		}
+		return copyEvent(event), true
+	}
+
+	seriesID, originalStart, ok := parseInstanceID(eventID)
+	if !ok {
+		return nil, false
+	}
+	master, ok := p.events[seriesID]
+	if !ok || master.Status == "cancelled" || !IsRecurring(master) {
+		return nil, false
+	}
+	return InstanceOf(master, originalStart)
+}
+
+// store saves the new version of an existing event. Instances can't recur
+// themselves, and changing a series drops the changed instances that no
+// longer fall on one of its occurrences. The caller holds p.mu.
+func (p *MemoryProvider) store(event, existing *calendar.Event) error {
+	if existing.RecurringEventId != "" && len(event.Recurrence) > 0 {
+		return fmt.Errorf("%w: an instance of a recurring event can't have its own recurrence", ErrInvalidRequest)
+	}
+
+	p.keepServerFields(event, existing)
+	p.events[event.Id] = event
+
+	for id, exception := range p.events {
+		if exception.RecurringEventId != event.Id {
+			continue
+		}
+		originalStart, err := ParseEventDateTime(exception.OriginalStartTime)
+		if err != nil {
+			continue
+		}
+		if _, ok := InstanceOf(event, originalStart); !IsRecurring(event) || !ok {
+			delete(p.events, id)
+		}
+	}
+	return nil
+}
+
+// fakeConference answers a conference create request the way Google does,
+// with a made-up Meet link
+func fakeConference(event *calendar.Event) {
+	link := "https://meet.google.com/" + event.Id
+	event.HangoutLink = link
+	event.ConferenceData = &calendar.ConferenceData{
+		ConferenceId: event.Id,
+		ConferenceSolution: &calendar.ConferenceSolution{
+			Key:  &calendar.ConferenceSolutionKey{Type: "hangoutsMeet"},
+			Name: "Google Meet",
+		},
+		CreateRequest: &calendar.CreateConferenceRequest{
+			RequestId:             event.ConferenceData.CreateRequest.RequestId,
+			ConferenceSolutionKey: event.ConferenceData.CreateRequest.ConferenceSolutionKey,
+			Status:                &calendar.ConferenceRequestStatus{StatusCode: "success"},
+		},
+		EntryPoints: []*calendar.EntryPoint{{EntryPointType: "video", Uri: link, Label: "meet.google.com/" + event.Id}},
+	}
+}
+
+// blocksTime reports whether the event occupies the given calendar
+func (p *MemoryProvider) blocksTime(event *calendar.Event, calendarID string) bool {
+	for _, attendee := range event.Attendees {
+		if attendee.Email == calendarID {
+			return attendee.ResponseStatus != "declined"
+		}
+	}
+	return calendarID == p.owner || calendarID == PrimaryCalendar
+}
+
+// markSelf flags the owner's own attendee entry, as Google does
+func (p *MemoryProvider) markSelf(event *calendar.Event) {
+	for _, attendee := range event.Attendees {
+		attendee.Self = attendee.Email == p.owner
+		if attendee.ResponseStatus == "" {
+			attendee.ResponseStatus = "needsAction"
+		}
+	}
+}
+
+// keepServerFields copies the fields clients can't change from the stored
+// event onto its replacement
+func (p *MemoryProvider) keepServerFields(event, existing *calendar.Event) {
+	event.Id = existing.Id
+	event.Kind = existing.Kind
+	event.Status = existing.Status
+	event.Created = existing.Created
+	event.HtmlLink = existing.HtmlLink
+	event.ICalUID = existing.ICalUID
+	event.Organizer = existing.Organizer
+	event.Creator = existing.Creator
+	event.RecurringEventId = existing.RecurringEventId
+	event.OriginalStartTime = existing.OriginalStartTime
+	event.Updated = p.Now().UTC().Format(time.RFC3339)
+	// Like Google, count reschedules so invites can be told apart
+	event.Sequence = existing.Sequence
+	if !SameDateTime(event.Start, existing.Start) || !SameDateTime(event.End, existing.End) {
+		event.Sequence++
+	}
+	p.markSelf(event)
+	if requestsConference(event) && event.ConferenceData.CreateRequest.Status == nil {
+		fakeConference(event)
+	}
+}
+
+// SameDateTime reports whether two event times are the same instant or day
+func SameDateTime(a, b *calendar.EventDateTime) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Date != "" || b.Date != "" {
+		return a.Date == b.Date
+	}
+	at, errA := ParseEventDateTime(a)
+	bt, errB := ParseEventDateTime(b)
+	return errA == nil && errB == nil && at.Equal(bt)
+}
+
+// validateEvent applies the checks Google makes before storing an event
+func validateEvent(event *calendar.Event) error {
+	start, end, err := eventBounds(event)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("%w: the requested time range is empty", ErrInvalidRequest)
+	}
+	if len(event.Recurrence) > 0 {
+		return ValidateRecurrence(event.Recurrence)
+	}
+	return nil
+}
+
+// eventBounds returns when an event starts and ends
+func eventBounds(event *calendar.Event) (time.Time, time.Time, error) {
+	start, err := ParseEventDateTime(event.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start time: %v", err)
+	}
+	end, err := ParseEventDateTime(event.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end time: %v", err)
+	}
+	return start, end, nil
+}
+
+func sortEvents(events []*calendar.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		si, _ := ParseEventDateTime(events[i].Start)
+		sj, _ := ParseEventDateTime(events[j].Start)
+		if si.Equal(sj) {
+			return events[i].Id < events[j].Id
+		}
+		return si.Before(sj)
+	})
+}
+
+// copyEvent deep-copies an event so callers can't mutate stored state
+func copyEvent(event *calendar.Event) *calendar.Event {
+	data, err := json.Marshal(event)
+	if err != nil {
+		panic(fmt.Sprintf("calendar: unable to copy event: %v", err))
+	}
+
+	var copied calendar.Event
+	if err := json.Unmarshal(data, &copied); err != nil {
+		panic(fmt.Sprintf("calendar: unable to copy event: %v", err))
+	}
+	return &copied
+}
+
+// mergeEvent applies patch to event using the JSON representation, so the
+// result matches what Google's patch endpoint would store
+func mergeEvent(event, patch *calendar.Event) (*calendar.Event, error) {
+	var base, changes map[string]interface{}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return nil, err
+	}
+
+	mergeJSON(base, changes)
+
+	data, err = json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	var merged calendar.Event
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+func mergeJSON(base, changes map[string]interface{}) {
+	for key, value := range changes {
+		if value == nil {
+			delete(base, key)
+			continue
+		}
+
+		nested, ok := value.(map[string]interface{})
+		existing, existingOk := base[key].(map[string]interface{})
+		if ok && existingOk {
+			mergeJSON(existing, nested)
+			continue
+		}
+		base[key] = value
+	}
+}
@@ -0,0 +1,695 @@
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+)
+
+const graphBaseURL = "https://graph.microsoft.com/v1.0"
+
+// graphDateTimeLayout is how Graph formats dateTime values (no offset; the
+// zone is given separately)
+const graphDateTimeLayout = "2006-01-02T15:04:05.9999999"
+
+// MicrosoftProvider talks to a user's Outlook calendar through Microsoft
+// Graph. Events are converted to and from the Google event model. Graph
+// always notifies attendees about updates the organizer makes, so
+// WriteOptions.SendUpdates only affects cancellations.
+type MicrosoftProvider struct {
+	client *http.Client
+	// BaseURL points at Graph; tests can aim it at a local server
+	BaseURL string
+	// calendarID selects one of the user's calendars; empty means their
+	// default calendar
+	calendarID string
+}
+
+// NewMicrosoftProvider creates a Graph client authenticated with the user's token source
+func NewMicrosoftProvider(ctx context.Context, ts oauth2.TokenSource) *MicrosoftProvider {
+	return &MicrosoftProvider{
+		client:  oauth2.NewClient(ctx, ts),
+		BaseURL: graphBaseURL,
+	}
+}
+
+type graphDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+type graphEmailAddress struct {
+	Address string `json:"address"`
+	Name    string `json:"name,omitempty"`
+}
+
+type graphAttendee struct {
+	EmailAddress graphEmailAddress `json:"emailAddress"`
+	Type         string            `json:"type,omitempty"`
+	Status       *struct {
+		Response string `json:"response"`
+	} `json:"status,omitempty"`
+}
+
+type graphEvent struct {
+	ID                   string         `json:"id"`
+	ICalUID              string         `json:"iCalUId"`
+	Subject              string         `json:"subject"`
+	Start                *graphDateTime `json:"start"`
+	End                  *graphDateTime `json:"end"`
+	IsAllDay             bool           `json:"isAllDay"`
+	IsCancelled          bool           `json:"isCancelled"`
+	SeriesMasterID       string         `json:"seriesMasterId"`
+	OriginalStart        string         `json:"originalStart"`
+	ShowAs               string         `json:"showAs"`
+	WebLink              string         `json:"webLink"`
+	IsReminderOn         bool           `json:"isReminderOn"`
+	ReminderMinutes      int64          `json:"reminderMinutesBeforeStart"`
+	CreatedDateTime      string         `json:"createdDateTime"`
+	LastModifiedDateTime string         `json:"lastModifiedDateTime"`
+	Body                 *struct {
+		Content string `json:"content"`
+	} `json:"body"`
+	Location *struct {
+		DisplayName string `json:"displayName"`
+	} `json:"location"`
+	Organizer *struct {
+		EmailAddress graphEmailAddress `json:"emailAddress"`
+	} `json:"organizer"`
+	Attendees []graphAttendee `json:"attendees"`
+}
+
+type graphErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// do sends a request to Graph and decodes the JSON response into out
+func (p *MicrosoftProvider) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := path
+	if !strings.HasPrefix(path, "http") {
+		target = p.BaseURL + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Ask for UTC times and plain-text bodies so we don't have to map
+	// Windows time zone names or strip HTML
+	req.Header.Set("Prefer", `outlook.timezone="UTC", outlook.body-content-type="text"`)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return graphError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// graphError turns a failed Graph response into an error tagged with the
+// matching provider error
+func graphError(resp *http.Response) error {
+	var body graphErrorResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	err := fmt.Errorf("graph responded with %d: %s %s", resp.StatusCode, body.Error.Code, body.Error.Message)
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrForbidden, err)
+	case http.StatusBadRequest:
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+	return err
+}
+
+// calendarPath is the Graph path of the selected calendar
+func (p *MicrosoftProvider) calendarPath() string {
+	if p.calendarID == "" {
+		return "/me/calendar"
+	}
+	return "/me/calendars/" + url.PathEscape(p.calendarID)
+}
+
+// eventPath is the Graph path of an event in the selected calendar
+func (p *MicrosoftProvider) eventPath(eventID string) string {
+	return p.calendarPath() + "/events/" + url.PathEscape(eventID)
+}
+
+// ListCalendars reads the user's calendars, including ones shared with them
+func (p *MicrosoftProvider) ListCalendars(ctx context.Context) ([]*CalendarInfo, error) {
+	var calendars []*CalendarInfo
+	next := "/me/calendars?$top=100"
+	for next != "" {
+		var response struct {
+			Value []struct {
+				ID                string `json:"id"`
+				Name              string `json:"name"`
+				HexColor          string `json:"hexColor"`
+				IsDefaultCalendar bool   `json:"isDefaultCalendar"`
+				CanEdit           bool   `json:"canEdit"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		if err := p.do(ctx, http.MethodGet, next, nil, &response); err != nil {
+			return nil, fmt.Errorf("unable to retrieve calendars: %w", err)
+		}
+
+		for _, item := range response.Value {
+			info := &CalendarInfo{
+				ID:         item.ID,
+				Name:       item.Name,
+				Color:      item.HexColor,
+				Primary:    item.IsDefaultCalendar,
+				AccessRole: "reader",
+			}
+			if item.CanEdit {
+				info.AccessRole = "writer"
+			}
+			if item.IsDefaultCalendar {
+				info.AccessRole = "owner"
+			}
+			calendars = append(calendars, info)
+		}
+		next = response.NextLink
+	}
+	return calendars, nil
+}
+
+// WithCalendar returns a provider for another of the user's calendars.
+// Graph reports unknown calendars once they're used.
+func (p *MicrosoftProvider) WithCalendar(ctx context.Context, calendarID string) (CalendarProvider, error) {
+	selected := *p
+	selected.calendarID = calendarID
+	if calendarID == PrimaryCalendar {
+		selected.calendarID = ""
+	}
+	return &selected, nil
+}
+
+// ListEvents reads the calendar view, which expands recurring events.
+// Without MaxResults Graph's paging links are followed; otherwise the next
+// link is handed out as the page token.
+func (p *MicrosoftProvider) ListEvents(ctx context.Context, opts ListOptions) (*EventPage, error) {
+	page, err := p.listView(ctx, p.calendarPath()+"/calendarView", opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve events: %w", err)
+	}
+	return page, nil
+}
+
+// ListInstances reads the occurrences of a series master within the window
+func (p *MicrosoftProvider) ListInstances(ctx context.Context, eventID string, opts ListOptions) (*EventPage, error) {
+	page, err := p.listView(ctx, p.eventPath(eventID)+"/instances", opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve instances: %w", err)
+	}
+	return page, nil
+}
+
+// listView pages through a Graph collection that takes a time window, such
+// as the calendarView or the instances of a series
+func (p *MicrosoftProvider) listView(ctx context.Context, path string, opts ListOptions) (*EventPage, error) {
+	next := ""
+	if opts.PageToken != "" {
+		link, err := base64.RawURLEncoding.DecodeString(opts.PageToken)
+		// Only ever follow links back to Graph with the user's token
+		if err != nil || !strings.HasPrefix(string(link), p.BaseURL+"/") {
+			return nil, fmt.Errorf("%w: invalid page token", ErrInvalidRequest)
+		}
+		next = string(link)
+	} else {
+		// Graph needs both ends of the window
+		timeMin, timeMax := opts.TimeMin, opts.TimeMax
+		if timeMin.IsZero() {
+			timeMin = time.Now()
+		}
+		if timeMax.IsZero() {
+			timeMax = timeMin.AddDate(0, 0, 7)
+		}
+
+		top := 100
+		if opts.MaxResults > 0 {
+			top = opts.MaxResults
+		}
+
+		query := url.Values{}
+		query.Set("startDateTime", timeMin.UTC().Format(time.RFC3339))
+		query.Set("endDateTime", timeMax.UTC().Format(time.RFC3339))
+		query.Set("$orderby", "start/dateTime")
+		query.Set("$top", strconv.Itoa(top))
+		next = path + "?" + query.Encode()
+	}
+
+	page := &EventPage{}
+	for next != "" {
+		var response struct {
+			Value    []graphEvent `json:"value"`
+			NextLink string       `json:"@odata.nextLink"`
+		}
+		if err := p.do(ctx, http.MethodGet, next, nil, &response); err != nil {
+			return nil, err
+		}
+
+		for _, item := range response.Value {
+			page.Items = append(page.Items, fromGraphEvent(item))
+		}
+		next = response.NextLink
+
+		if opts.MaxResults > 0 {
+			if next != "" {
+				page.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(next))
+			}
+			break
+		}
+	}
+
+	return page, nil
+}
+
+// SendsOwnInvites is true: Exchange emails attendees about every event
+// the organizer creates or changes
+func (p *MicrosoftProvider) SendsOwnInvites() bool {
+	return true
+}
+
+// GetEvent retrieves a single event
+func (p *MicrosoftProvider) GetEvent(ctx context.Context, eventID string) (*calendar.Event, error) {
+	var event graphEvent
+	if err := p.do(ctx, http.MethodGet, p.eventPath(eventID), nil, &event); err != nil {
+		return nil, fmt.Errorf("unable to retrieve event: %w", err)
+	}
+	return fromGraphEvent(event), nil
+}
+
+// CreateEvent creates an event in the selected calendar. Graph sends
+// the invitations itself.
+func (p *MicrosoftProvider) CreateEvent(ctx context.Context, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	if len(event.Recurrence) > 0 {
+		// Graph describes recurrence with its own pattern objects, not RRULEs
+		return nil, fmt.Errorf("unable to create event: %w: recurrence rules", ErrNotSupported)
+	}
+	if requestsConference(event) {
+		return nil, fmt.Errorf("unable to create event: %w: Google Meet conferences", ErrNotSupported)
+	}
+	body, err := graphFields(event, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create event: %w", err)
+	}
+
+	var created graphEvent
+	if err := p.do(ctx, http.MethodPost, p.calendarPath()+"/events", body, &created); err != nil {
+		return nil, fmt.Errorf("unable to create event: %w", err)
+	}
+	return fromGraphEvent(created), nil
+}
+
+// UpdateEvent replaces an event's fields. Graph has no PUT for events, so
+// every field we manage is sent in a PATCH.
+func (p *MicrosoftProvider) UpdateEvent(ctx context.Context, eventID string, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	if len(event.Recurrence) > 0 {
+		// Graph describes recurrence with its own pattern objects, not RRULEs
+		return nil, fmt.Errorf("unable to update event: %w: recurrence rules", ErrNotSupported)
+	}
+	if requestsConference(event) {
+		return nil, fmt.Errorf("unable to update event: %w: Google Meet conferences", ErrNotSupported)
+	}
+	body, err := graphFields(event, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", err)
+	}
+
+	var updated graphEvent
+	if err := p.do(ctx, http.MethodPatch, p.eventPath(eventID), body, &updated); err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", err)
+	}
+	return fromGraphEvent(updated), nil
+}
+
+// PatchEvent changes only the fields set on patch
+func (p *MicrosoftProvider) PatchEvent(ctx context.Context, eventID string, patch *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	if len(patch.Recurrence) > 0 {
+		// Graph describes recurrence with its own pattern objects, not RRULEs
+		return nil, fmt.Errorf("unable to patch event: %w: recurrence rules", ErrNotSupported)
+	}
+	if requestsConference(patch) {
+		return nil, fmt.Errorf("unable to patch event: %w: Google Meet conferences", ErrNotSupported)
+	}
+	body, err := graphFields(patch, false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", err)
+	}
+
+	var patched graphEvent
+	if err := p.do(ctx, http.MethodPatch, p.eventPath(eventID), body, &patched); err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", err)
+	}
+	return fromGraphEvent(patched), nil
+}
+
+// graphResponseActions maps responses onto the Graph actions that send them
+var graphResponseActions = map[string]string{
+	ResponseAccepted:  "accept",
+	ResponseDeclined:  "decline",
+	ResponseTentative: "tentativelyAccept",
+}
+
+// RespondToEvent answers an invitation through Graph's accept, decline and
+// tentativelyAccept actions
+func (p *MicrosoftProvider) RespondToEvent(ctx context.Context, eventID string, rsvp RSVP, opts WriteOptions) (*calendar.Event, error) {
+	action, ok := graphResponseActions[rsvp.Response]
+	if !ok {
+		return nil, fmt.Errorf("unable to respond to event: %w: unknown response %q", ErrInvalidRequest, rsvp.Response)
+	}
+
+	body := map[string]interface{}{
+		"comment":      rsvp.Comment,
+		"sendResponse": opts.SendUpdates != SendUpdatesNone,
+	}
+	if err := p.do(ctx, http.MethodPost, p.eventPath(eventID)+"/"+action, body, nil); err != nil {
+		return nil, fmt.Errorf("unable to respond to event: %w", err)
+	}
+	return p.GetEvent(ctx, eventID)
+}
+
+// DeleteEvent cancels an event. Unless updates are turned off, organizers
+// cancel through Graph's cancel action so attendees get notified; plain
+// deletion is used otherwise.
+func (p *MicrosoftProvider) DeleteEvent(ctx context.Context, eventID string, opts WriteOptions) error {
+	path := p.eventPath(eventID)
+
+	if opts.SendUpdates != SendUpdatesNone {
+		err := p.do(ctx, http.MethodPost, path+"/cancel", map[string]string{}, nil)
+		if err == nil {
+			return nil
+		}
+		// Only organizers may cancel; attendees fall through to deleting
+		// the event from their own calendar
+		if !errors.Is(err, ErrInvalidRequest) {
+			return fmt.Errorf("unable to delete event: %w", err)
+		}
+	}
+
+	if err := p.do(ctx, http.MethodDelete, path, nil, nil); err != nil {
+		return fmt.Errorf("unable to delete event: %w", err)
+	}
+	return nil
+}
+
+// FreeBusy looks up availability with Graph's getSchedule action.
+// Schedules Graph can't look up are left out.
+func (p *MicrosoftProvider) FreeBusy(ctx context.Context, timeMin, timeMax time.Time, calendars []string) (map[string][]*calendar.TimePeriod, error) {
+	body := map[string]interface{}{
+		"schedules":                calendars,
+		"startTime":                toGraphDateTime(timeMin),
+		"endTime":                  toGraphDateTime(timeMax),
+		"availabilityViewInterval": 15,
+	}
+
+	var response struct {
+		Value []struct {
+			ScheduleID    string `json:"scheduleId"`
+			ScheduleItems []struct {
+				Status string         `json:"status"`
+				Start  *graphDateTime `json:"start"`
+				End    *graphDateTime `json:"end"`
+			} `json:"scheduleItems"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"value"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/me/calendar/getSchedule", body, &response); err != nil {
+		return nil, fmt.Errorf("unable to query free/busy: %w", err)
+	}
+
+	busy := make(map[string][]*calendar.TimePeriod, len(response.Value))
+	for _, schedule := range response.Value {
+		if schedule.Error != nil {
+			continue
+		}
+
+		periods := []*calendar.TimePeriod{}
+		for _, item := range schedule.ScheduleItems {
+			if item.Status == "free" || item.Status == "workingElsewhere" {
+				continue
+			}
+			start, err := parseGraphDateTime(item.Start)
+			if err != nil {
+				continue
+			}
+			end, err := parseGraphDateTime(item.End)
+			if err != nil {
+				continue
+			}
+			periods = append(periods, &calendar.TimePeriod{
+				Start: start.Format(time.RFC3339),
+				End:   end.Format(time.RFC3339),
+			})
+		}
+		busy[schedule.ScheduleID] = periods
+	}
+	return busy, nil
+}
+
+func toGraphDateTime(t time.Time) *graphDateTime {
+	return &graphDateTime{DateTime: t.UTC().Format("2006-01-02T15:04:05"), TimeZone: "UTC"}
+}
+
+// graphEventTime converts an event time for Graph. Graph wants all-day
+// events to start and end at midnight in their own zone, so dates aren't
+// converted to UTC.
+func graphEventTime(dt *calendar.EventDateTime) (*graphDateTime, error) {
+	if dt.Date != "" {
+		if _, err := time.Parse("2006-01-02", dt.Date); err != nil {
+			return nil, err
+		}
+		timeZone := dt.TimeZone
+		if timeZone == "" {
+			timeZone = "UTC"
+		}
+		return &graphDateTime{DateTime: dt.Date + "T00:00:00", TimeZone: timeZone}, nil
+	}
+
+	t, err := ParseEventDateTime(dt)
+	if err != nil {
+		return nil, err
+	}
+	return toGraphDateTime(t), nil
+}
+
+// parseGraphDateTime reads a dateTime we asked Graph to return in UTC
+func parseGraphDateTime(dt *graphDateTime) (time.Time, error) {
+	if dt == nil {
+		return time.Time{}, fmt.Errorf("missing event time")
+	}
+
+	loc := time.UTC
+	if dt.TimeZone != "" && dt.TimeZone != "UTC" {
+		l, err := time.LoadLocation(dt.TimeZone)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc = l
+	}
+	return time.ParseInLocation(graphDateTimeLayout, dt.DateTime, loc)
+}
+
+// graphFields converts a Google-model event into a Graph request body.
+// When full is false only fields that are set (or forced / nulled, as in
+// Google patches) are included.
+func graphFields(event *calendar.Event, full bool) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	has := func(value bool, name string) bool {
+		if full || value {
+			return true
+		}
+		for _, f := range append(event.ForceSendFields, event.NullFields...) {
+			if f == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	if has(event.Summary != "", "Summary") {
+		fields["subject"] = event.Summary
+	}
+	if has(event.Description != "", "Description") {
+		fields["body"] = map[string]string{"contentType": "text", "content": event.Description}
+	}
+	if has(event.Location != "", "Location") {
+		fields["location"] = map[string]string{"displayName": event.Location}
+	}
+	if has(event.Transparency != "", "Transparency") {
+		showAs := "busy"
+		if event.Transparency == "transparent" {
+			showAs = "free"
+		}
+		fields["showAs"] = showAs
+	}
+
+	if event.Start != nil {
+		start, err := graphEventTime(event.Start)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid start time: %v", ErrInvalidRequest, err)
+		}
+		fields["start"] = start
+		fields["isAllDay"] = event.Start.Date != ""
+	}
+	if event.End != nil {
+		end, err := graphEventTime(event.End)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid end time: %v", ErrInvalidRequest, err)
+		}
+		fields["end"] = end
+	}
+
+	// Outlook keeps a single reminder, so the earliest one is used
+	if event.Reminders != nil && !event.Reminders.UseDefault {
+		fields["isReminderOn"] = len(event.Reminders.Overrides) > 0
+		var minutes int64
+		for _, reminder := range event.Reminders.Overrides {
+			if reminder.Minutes > minutes {
+				minutes = reminder.Minutes
+			}
+		}
+		if len(event.Reminders.Overrides) > 0 {
+			fields["reminderMinutesBeforeStart"] = minutes
+		}
+	}
+
+	if has(event.Attendees != nil, "Attendees") {
+		attendees := []graphAttendee{}
+		for _, attendee := range event.Attendees {
+			attendeeType := "required"
+			if attendee.Optional {
+				attendeeType = "optional"
+			}
+			attendees = append(attendees, graphAttendee{
+				EmailAddress: graphEmailAddress{Address: attendee.Email, Name: attendee.DisplayName},
+				Type:         attendeeType,
+			})
+		}
+		fields["attendees"] = attendees
+	}
+
+	return fields, nil
+}
+
+// graphResponseStatus maps Graph attendee responses onto Google's values
+var graphResponseStatus = map[string]string{
+	"accepted":            "accepted",
+	"organizer":           "accepted",
+	"declined":            "declined",
+	"tentativelyAccepted": "tentative",
+	"none":                "needsAction",
+	"notResponded":        "needsAction",
+}
+
+// fromGraphEvent converts a Graph event into the Google event model
+func fromGraphEvent(item graphEvent) *calendar.Event {
+	event := &calendar.Event{
+		Id:       item.ID,
+		ICalUID:  item.ICalUID,
+		Summary:  item.Subject,
+		HtmlLink: item.WebLink,
+		Status:   "confirmed",
+		Created:  item.CreatedDateTime,
+		Updated:  item.LastModifiedDateTime,
+	}
+	if item.IsCancelled {
+		event.Status = "cancelled"
+	}
+	if item.ShowAs == "free" {
+		event.Transparency = "transparent"
+	}
+	if item.Body != nil {
+		event.Description = strings.TrimSpace(item.Body.Content)
+	}
+	if item.Location != nil {
+		event.Location = item.Location.DisplayName
+	}
+	if item.Organizer != nil {
+		event.Organizer = &calendar.EventOrganizer{
+			Email:       item.Organizer.EmailAddress.Address,
+			DisplayName: item.Organizer.EmailAddress.Name,
+		}
+	}
+
+	event.Start = fromGraphDateTime(item.Start, item.IsAllDay)
+	event.End = fromGraphDateTime(item.End, item.IsAllDay)
+	event.Reminders = &calendar.EventReminders{}
+	if item.IsReminderOn {
+		event.Reminders.Overrides = []*calendar.EventReminder{{Method: "popup", Minutes: item.ReminderMinutes}}
+	}
+	if item.SeriesMasterID != "" {
+		event.RecurringEventId = item.SeriesMasterID
+		if originalStart, err := time.Parse(time.RFC3339, item.OriginalStart); err == nil {
+			event.OriginalStartTime = &calendar.EventDateTime{DateTime: originalStart.UTC().Format(time.RFC3339), TimeZone: "UTC"}
+		}
+	}
+
+	for _, attendee := range item.Attendees {
+		status := "needsAction"
+		if attendee.Status != nil {
+			if mapped, ok := graphResponseStatus[attendee.Status.Response]; ok {
+				status = mapped
+			}
+		}
+		event.Attendees = append(event.Attendees, &calendar.EventAttendee{
+			Email:          attendee.EmailAddress.Address,
+			DisplayName:    attendee.EmailAddress.Name,
+			Optional:       attendee.Type == "optional",
+			ResponseStatus: status,
+		})
+	}
+
+	return event
+}
+
+func fromGraphDateTime(dt *graphDateTime, allDay bool) *calendar.EventDateTime {
+	t, err := parseGraphDateTime(dt)
+	if err != nil {
+		return &calendar.EventDateTime{}
+	}
+	if allDay {
+		return &calendar.EventDateTime{Date: t.Format("2006-01-02")}
+	}
+	return &calendar.EventDateTime{DateTime: t.Format(time.RFC3339), TimeZone: "UTC"}
+}
@@ -0,0 +1,143 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goauthDemo/models"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	// ErrNotFound is returned when the requested event doesn't exist or was deleted
+	ErrNotFound = errors.New("event not found")
+	// ErrForbidden is returned when the user may not access the calendar or event
+	ErrForbidden = errors.New("access to calendar denied")
+	// ErrInvalidRequest is returned when the provider rejects the event data
+	ErrInvalidRequest = errors.New("invalid calendar request")
+	// ErrNotSupported is returned by providers that can't perform an operation
+	ErrNotSupported = errors.New("operation not supported by calendar provider")
+)
+
+// CalendarProvider is implemented by every calendar backend. Events are
+// exchanged as Google Calendar v3 events, which is the richest model we
+// support; other backends map to and from it.
+type CalendarProvider interface {
+	// ListEvents returns the events overlapping the given window, with
+	// recurring events expanded into single instances ordered by start time.
+	// Without MaxResults every page is fetched.
+	ListEvents(ctx context.Context, opts ListOptions) (*EventPage, error)
+	// ListInstances returns the occurrences of a recurring event within the
+	// window, including ones changed individually
+	ListInstances(ctx context.Context, eventID string, opts ListOptions) (*EventPage, error)
+	// GetEvent returns a single event by ID, which may be the ID of one
+	// instance of a recurring event
+	GetEvent(ctx context.Context, eventID string) (*calendar.Event, error)
+	// CreateEvent stores a new event and returns it as saved by the provider
+	CreateEvent(ctx context.Context, event *calendar.Event, opts WriteOptions) (*calendar.Event, error)
+	// UpdateEvent replaces an existing event
+	UpdateEvent(ctx context.Context, eventID string, event *calendar.Event, opts WriteOptions) (*calendar.Event, error)
+	// PatchEvent changes only the fields set on patch
+	PatchEvent(ctx context.Context, eventID string, patch *calendar.Event, opts WriteOptions) (*calendar.Event, error)
+	// RespondToEvent records the user's answer to an invitation and, unless
+	// updates are turned off, lets the organizer know
+	RespondToEvent(ctx context.Context, eventID string, rsvp RSVP, opts WriteOptions) (*calendar.Event, error)
+	// DeleteEvent cancels an event
+	DeleteEvent(ctx context.Context, eventID string, opts WriteOptions) error
+	// FreeBusy returns the busy intervals of each of the given calendars
+	// (usually email addresses) within the window
+	FreeBusy(ctx context.Context, timeMin, timeMax time.Time, calendars []string) (map[string][]*calendar.TimePeriod, error)
+	// ListCalendars returns the calendars the user can see: their own and
+	// any shared team or room calendars
+	ListCalendars(ctx context.Context) ([]*CalendarInfo, error)
+	// WithCalendar returns a provider working on another of the user's
+	// calendars, identified by an ID from ListCalendars or PrimaryCalendar
+	WithCalendar(ctx context.Context, calendarID string) (CalendarProvider, error)
+}
+
+// PrimaryCalendar is the ID that always selects the user's own calendar
+const PrimaryCalendar = "primary"
+
+// CalendarInfo describes one of the calendars a user can access
+type CalendarInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	TimeZone    string `json:"timeZone,omitempty"`
+	Color       string `json:"color,omitempty"`
+	// Primary marks the user's own calendar
+	Primary bool `json:"primary"`
+	// AccessRole is "owner", "writer", "reader" or "freeBusyReader"
+	AccessRole string `json:"accessRole,omitempty"`
+}
+
+// TimeZoneReader is implemented by providers that can report the time
+// zone configured for the user's calendar
+type TimeZoneReader interface {
+	CalendarTimeZone(ctx context.Context) (string, error)
+}
+
+// InviteSender is implemented by providers whose backend emails
+// attendees about new and changed events itself, whatever
+// WriteOptions.SendUpdates says
+type InviteSender interface {
+	SendsOwnInvites() bool
+}
+
+// SendsOwnInvites reports whether the provider's backend always emails
+// attendees itself
+func SendsOwnInvites(provider CalendarProvider) bool {
+	sender, ok := provider.(InviteSender)
+	return ok && sender.SendsOwnInvites()
+}
+
+// ProviderFactory returns the calendar provider to use for a user. Handlers
+// receive one so tests can swap in a MemoryProvider.
+type ProviderFactory func(ctx context.Context, user *models.User) (CalendarProvider, error)
+
+// ListOptions narrows down ListEvents
+type ListOptions struct {
+	TimeMin time.Time
+	TimeMax time.Time
+	// MaxResults limits the page size; 0 returns all events in the window
+	MaxResults int
+	// PageToken continues from a previous EventPage.NextPageToken
+	PageToken string
+}
+
+// EventPage is one page of ListEvents results
+type EventPage struct {
+	Items []*calendar.Event
+	// NextPageToken is set when more events are available
+	NextPageToken string
+}
+
+// paginate serves a page from a fully loaded, sorted event list for
+// providers without server-side paging. Page tokens are offsets.
+func paginate(events []*calendar.Event, opts ListOptions) (*EventPage, error) {
+	offset := 0
+	if opts.PageToken != "" {
+		n, err := strconv.Atoi(opts.PageToken)
+		if err != nil || n < 0 || n > len(events) {
+			return nil, fmt.Errorf("%w: invalid page token", ErrInvalidRequest)
+		}
+		offset = n
+	}
+
+	page := &EventPage{Items: events[offset:]}
+	if opts.MaxResults > 0 && len(page.Items) > opts.MaxResults {
+		page.Items = page.Items[:opts.MaxResults]
+		page.NextPageToken = strconv.Itoa(offset + opts.MaxResults)
+	}
+	return page, nil
+}
+
+// WriteOptions controls side effects of creating, changing or deleting events
+type WriteOptions struct {
+	// SendUpdates is one of the SendUpdates* values; empty means the
+	// provider default
+	SendUpdates string
+}
@@ -0,0 +1,260 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+	"google.golang.org/api/calendar/v3"
+)
+
+// instanceTimeLayout formats the original start time in instance IDs, as
+// Google does for timed events ("<series ID>_20261020T093000Z")
+const instanceTimeLayout = "20060102T150405Z"
+
+// maxExpansion bounds how far ahead open-ended series are expanded when a
+// listing has no end
+const maxExpansion = 366 * 24 * time.Hour
+
+// ValidateRecurrence checks the RRULE, EXRULE, RDATE and EXDATE lines of a
+// recurring event
+func ValidateRecurrence(lines []string) error {
+	rules := 0
+	for _, line := range lines {
+		name := strings.ToUpper(line)
+		if i := strings.IndexAny(name, ";:"); i > 0 {
+			name = name[:i]
+		}
+		switch name {
+		case "RRULE":
+			rules++
+		case "EXRULE", "RDATE", "EXDATE":
+		default:
+			return fmt.Errorf("%w: unsupported recurrence line %q", ErrInvalidRequest, line)
+		}
+	}
+	if rules > 1 {
+		return fmt.Errorf("%w: only one RRULE is allowed", ErrInvalidRequest)
+	}
+
+	if _, err := rrule.StrSliceToRRuleSetInLoc(lines, time.UTC); err != nil {
+		return fmt.Errorf("%w: invalid recurrence: %v", ErrInvalidRequest, err)
+	}
+	return nil
+}
+
+// IsRecurring reports whether the event is the master of a recurring series
+func IsRecurring(event *calendar.Event) bool {
+	return len(event.Recurrence) > 0 && event.RecurringEventId == ""
+}
+
+// recurrenceSet parses a series' recurrence, anchored at its first start.
+// Times are expanded in the event's time zone so wall-clock times survive
+// daylight saving changes.
+func recurrenceSet(master *calendar.Event) (*rrule.Set, time.Time, error) {
+	start, err := ParseEventDateTime(master.Start)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid start time: %v", err)
+	}
+
+	loc := time.UTC
+	if master.Start.TimeZone != "" {
+		if l, err := time.LoadLocation(master.Start.TimeZone); err == nil {
+			loc = l
+		}
+	}
+	start = start.In(loc)
+
+	set, err := rrule.StrSliceToRRuleSetInLoc(master.Recurrence, loc)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: invalid recurrence: %v", ErrInvalidRequest, err)
+	}
+	set.DTStart(start)
+	return set, start, nil
+}
+
+// ExpandRecurrence returns the instances of a recurring series overlapping
+// [from, to). An open end (zero to) is capped at a year after from.
+func ExpandRecurrence(master *calendar.Event, from, to time.Time) ([]*calendar.Event, error) {
+	set, start, err := recurrenceSet(master)
+	if err != nil {
+		return nil, err
+	}
+	end, err := ParseEventDateTime(master.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time: %v", err)
+	}
+	duration := end.Sub(start)
+
+	if from.IsZero() {
+		from = start
+	}
+	if to.IsZero() {
+		to = from.Add(maxExpansion)
+	}
+
+	var instances []*calendar.Event
+	for _, occurrence := range set.Between(from.Add(-duration), to, true) {
+		if !occurrence.Add(duration).After(from) || !occurrence.Before(to) {
+			continue
+		}
+		instances = append(instances, newInstance(master, occurrence, duration))
+	}
+	return instances, nil
+}
+
+// InstanceOf returns the instance of a series originally starting at the
+// given time, or false if the series has no such occurrence
+func InstanceOf(master *calendar.Event, originalStart time.Time) (*calendar.Event, bool) {
+	set, start, err := recurrenceSet(master)
+	if err != nil {
+		return nil, false
+	}
+	end, err := ParseEventDateTime(master.End)
+	if err != nil {
+		return nil, false
+	}
+
+	occurrence := set.After(originalStart, true)
+	if !occurrence.Equal(originalStart) {
+		return nil, false
+	}
+	return newInstance(master, occurrence, end.Sub(start)), true
+}
+
+// newInstance builds a single occurrence of a series the way Google lists
+// it with singleEvents: its own ID and times, linked back to the series
+func newInstance(master *calendar.Event, occurrence time.Time, duration time.Duration) *calendar.Event {
+	instance := copyEvent(master)
+	instance.Id = InstanceID(master.Id, occurrence)
+	instance.RecurringEventId = master.Id
+	instance.Recurrence = nil
+
+	if master.Start.Date != "" {
+		instance.Start = &calendar.EventDateTime{Date: occurrence.Format("2006-01-02"), TimeZone: master.Start.TimeZone}
+		instance.End = &calendar.EventDateTime{Date: occurrence.Add(duration).Format("2006-01-02"), TimeZone: master.End.TimeZone}
+		instance.OriginalStartTime = &calendar.EventDateTime{Date: instance.Start.Date, TimeZone: master.Start.TimeZone}
+		return instance
+	}
+
+	instance.Start = &calendar.EventDateTime{DateTime: occurrence.Format(time.RFC3339), TimeZone: master.Start.TimeZone}
+	instance.End = &calendar.EventDateTime{DateTime: occurrence.Add(duration).Format(time.RFC3339), TimeZone: master.End.TimeZone}
+	instance.OriginalStartTime = &calendar.EventDateTime{DateTime: instance.Start.DateTime, TimeZone: master.Start.TimeZone}
+	return instance
+}
+
+// InstanceID is the ID of the occurrence of a series starting at the given time
+func InstanceID(seriesID string, originalStart time.Time) string {
+	return seriesID + "_" + originalStart.UTC().Format(instanceTimeLayout)
+}
+
+// splitInstanceID separates a series ID from an instance suffix
+func splitInstanceID(eventID string) (string, bool) {
+	seriesID, _, ok := parseInstanceID(eventID)
+	return seriesID, ok
+}
+
+// parseInstanceID separates a series ID and original start time from an
+// instance ID
+func parseInstanceID(eventID string) (string, time.Time, bool) {
+	i := strings.LastIndex(eventID, "_")
+	if i < 0 {
+		return eventID, time.Time{}, false
+	}
+	originalStart, err := time.Parse(instanceTimeLayout, eventID[i+1:])
+	if err != nil {
+		return eventID, time.Time{}, false
+	}
+	return eventID[:i], originalStart, true
+}
+
+// SplitRecurrence divides a series at one of its occurrences, returning the
+// recurrence for the part before it (to be kept on the existing series) and
+// for the part from it on (for a new series starting at that occurrence).
+// A COUNT limit is shared out between the two.
+func SplitRecurrence(master *calendar.Event, at time.Time) ([]string, []string, error) {
+	_, start, err := recurrenceSet(master)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := start.Location()
+	if !at.After(start) {
+		return nil, nil, fmt.Errorf("%w: can't split a series at its first occurrence", ErrInvalidRequest)
+	}
+
+	var before, after []string
+	for _, line := range master.Recurrence {
+		name := strings.ToUpper(line)
+		if i := strings.IndexAny(name, ";:"); i > 0 {
+			name = name[:i]
+		}
+
+		switch name {
+		case "RRULE":
+			option, err := rrule.StrToROptionInLocation(line[len("RRULE:"):], loc)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: invalid recurrence: %v", ErrInvalidRequest, err)
+			}
+
+			remaining := *option
+			if option.Count > 0 {
+				// Count the occurrences of the rule alone, as COUNT does
+				counted := *option
+				counted.Dtstart = start
+				rule, err := rrule.NewRRule(counted)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%w: invalid recurrence: %v", ErrInvalidRequest, err)
+				}
+				used := len(rule.Between(start, at.Add(-time.Second), true))
+				remaining.Count = option.Count - used
+			}
+			if remaining.Count > 0 || option.Count == 0 {
+				after = append(after, "RRULE:"+remaining.RRuleString())
+			}
+
+			ended := *option
+			ended.Count = 0
+			ended.Until = at.Add(-time.Second)
+			if !option.Until.IsZero() && option.Until.Before(ended.Until) {
+				ended.Until = option.Until
+			}
+			before = append(before, "RRULE:"+ended.RRuleString())
+		case "RDATE":
+			dates, err := rrule.StrToDatesInLoc(line[len("RDATE")+1:], loc)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: invalid recurrence: %v", ErrInvalidRequest, err)
+			}
+			var early, late []time.Time
+			for _, date := range dates {
+				if date.Before(at) {
+					early = append(early, date)
+				} else {
+					late = append(late, date)
+				}
+			}
+			if len(early) > 0 {
+				before = append(before, formatDates("RDATE", early))
+			}
+			if len(late) > 0 {
+				after = append(after, formatDates("RDATE", late))
+			}
+		default:
+			// Exclusions are harmless on the side they don't apply to
+			before = append(before, line)
+			after = append(after, line)
+		}
+	}
+	return before, after, nil
+}
+
+// formatDates writes a list of dates as a recurrence line in UTC
+func formatDates(name string, dates []time.Time) string {
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	values := make([]string, len(dates))
+	for i, date := range dates {
+		values[i] = date.UTC().Format(instanceTimeLayout)
+	}
+	return name + ":" + strings.Join(values, ",")
+}
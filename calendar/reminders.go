@@ -0,0 +1,51 @@
+package calendar
+
+import (
+	"fmt"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	// maxReminderOverrides is how many reminders Google keeps per event
+	maxReminderOverrides = 5
+	// maxReminderMinutes is the earliest reminder Google allows: four weeks
+	maxReminderMinutes = 40320
+)
+
+// NewReminders converts requested reminders into the event model. Without
+// overrides the calendar's default reminders apply unless UseDefault is
+// false, which turns reminders off.
+func NewReminders(reminders *MeetingReminders) (*calendar.EventReminders, error) {
+	if len(reminders.Overrides) > maxReminderOverrides {
+		return nil, fmt.Errorf("at most %d reminders are allowed", maxReminderOverrides)
+	}
+	if reminders.UseDefault && len(reminders.Overrides) > 0 {
+		return nil, fmt.Errorf("reminders can't both useDefault and have overrides")
+	}
+
+	result := &calendar.EventReminders{
+		UseDefault: reminders.UseDefault,
+		// Google would leave UseDefault unchanged if false were omitted
+		ForceSendFields: []string{"UseDefault"},
+	}
+	for _, reminder := range reminders.Overrides {
+		if reminder.Method != "email" && reminder.Method != "popup" {
+			return nil, fmt.Errorf("invalid reminder method %q: must be email or popup", reminder.Method)
+		}
+		if reminder.Minutes < 0 || reminder.Minutes > maxReminderMinutes {
+			return nil, fmt.Errorf("reminder minutes must be between 0 and %d", maxReminderMinutes)
+		}
+		result.Overrides = append(result.Overrides, &calendar.EventReminder{
+			Method:  reminder.Method,
+			Minutes: reminder.Minutes,
+			// Zero minutes means at the start of the event
+			ForceSendFields: []string{"Minutes"},
+		})
+	}
+	if len(result.Overrides) == 0 {
+		// A patch would otherwise keep the event's earlier overrides
+		result.NullFields = []string{"Overrides"}
+	}
+	return result, nil
+}
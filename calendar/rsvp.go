@@ -0,0 +1,47 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Responses an attendee can give to an invitation, as used in
+// EventAttendee.ResponseStatus
+const (
+	ResponseAccepted    = "accepted"
+	ResponseDeclined    = "declined"
+	ResponseTentative   = "tentative"
+	ResponseNeedsAction = "needsAction"
+)
+
+// ValidResponse reports whether v is a response an attendee can give
+func ValidResponse(v string) bool {
+	switch v {
+	case ResponseAccepted, ResponseDeclined, ResponseTentative:
+		return true
+	}
+	return false
+}
+
+// RSVP is the signed-in user's answer to an invitation
+type RSVP struct {
+	// Response is one of ResponseAccepted, ResponseDeclined or ResponseTentative
+	Response string
+	// Comment is an optional note for the organizer
+	Comment string
+}
+
+// setResponse records the RSVP on the attendee entry of the given email
+// address, or the entry flagged as Self when email is empty
+func setResponse(event *calendar.Event, email string, rsvp RSVP) error {
+	for _, attendee := range event.Attendees {
+		if attendee.Self || (email != "" && strings.EqualFold(attendee.Email, email)) {
+			attendee.ResponseStatus = rsvp.Response
+			attendee.Comment = rsvp.Comment
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: you are not an attendee of this event", ErrInvalidRequest)
+}
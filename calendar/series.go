@@ -0,0 +1,268 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Scopes of a change made through one instance of a recurring event,
+// matching the choices calendar apps offer
+const (
+	ScopeThis      = "this"
+	ScopeFollowing = "following"
+	ScopeAll       = "all"
+)
+
+// ValidScope reports whether v is one of the Scope* values
+func ValidScope(v string) bool {
+	switch v {
+	case ScopeThis, ScopeFollowing, ScopeAll:
+		return true
+	}
+	return false
+}
+
+// UpdateRecurring replaces the event with the given ID. When the ID is an
+// instance of a recurring event, scope decides whether only that instance,
+// it and the following ones, or the whole series change. Moving an
+// instance with ScopeAll moves every instance by the same amount.
+func UpdateRecurring(ctx context.Context, provider CalendarProvider, eventID string, event *calendar.Event, scope string, opts WriteOptions) (*calendar.Event, error) {
+	instance, master, err := resolveSeries(ctx, provider, eventID, scope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update event: %w", err)
+	}
+
+	switch {
+	case master == nil:
+		return provider.UpdateEvent(ctx, eventID, event, opts)
+	case instance == nil || scope == ScopeAll || startsSeries(instance, master):
+		series := copyEvent(event)
+		if instance != nil {
+			if err := shiftToSeries(series, instance, master); err != nil {
+				return nil, fmt.Errorf("unable to update event: %w", err)
+			}
+		}
+		if len(series.Recurrence) == 0 {
+			series.Recurrence = master.Recurrence
+		}
+		return provider.UpdateEvent(ctx, master.Id, series, opts)
+	}
+
+	series := copyEvent(event)
+	return splitSeries(ctx, provider, master, instance, series, opts)
+}
+
+// PatchRecurring changes the fields set on patch, with scope working as for
+// UpdateRecurring
+func PatchRecurring(ctx context.Context, provider CalendarProvider, eventID string, patch *calendar.Event, scope string, opts WriteOptions) (*calendar.Event, error) {
+	instance, master, err := resolveSeries(ctx, provider, eventID, scope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", err)
+	}
+
+	switch {
+	case master == nil:
+		return provider.PatchEvent(ctx, eventID, patch, opts)
+	case instance == nil || scope == ScopeAll || startsSeries(instance, master):
+		if instance != nil && (patch.Start != nil || patch.End != nil) {
+			// Work out where the instance ends up and move the series along
+			moved, err := mergeEvent(instance, patch)
+			if err != nil {
+				return nil, fmt.Errorf("unable to patch event: %w", err)
+			}
+			if err := shiftToSeries(moved, instance, master); err != nil {
+				return nil, fmt.Errorf("unable to patch event: %w", err)
+			}
+			patch = copyEvent(patch)
+			patch.Start, patch.End = moved.Start, moved.End
+		}
+		return provider.PatchEvent(ctx, master.Id, patch, opts)
+	}
+
+	// The new series starts out as a copy of the instance
+	template := copyEvent(master)
+	template.Start, template.End = instance.Start, instance.End
+	template.Recurrence = nil
+	series, err := mergeEvent(template, patch)
+	if err != nil {
+		return nil, fmt.Errorf("unable to patch event: %w", err)
+	}
+	return splitSeries(ctx, provider, master, instance, series, opts)
+}
+
+// DeleteRecurring deletes the event with the given ID, with scope working
+// as for UpdateRecurring
+func DeleteRecurring(ctx context.Context, provider CalendarProvider, eventID string, scope string, opts WriteOptions) error {
+	instance, master, err := resolveSeries(ctx, provider, eventID, scope)
+	if err != nil {
+		return fmt.Errorf("unable to delete event: %w", err)
+	}
+
+	switch {
+	case master == nil:
+		return provider.DeleteEvent(ctx, eventID, opts)
+	case instance == nil || scope == ScopeAll || startsSeries(instance, master):
+		return provider.DeleteEvent(ctx, master.Id, opts)
+	}
+
+	before, _, err := SplitRecurrence(master, originalStart(instance))
+	if err != nil {
+		return fmt.Errorf("unable to delete event: %w", err)
+	}
+	_, err = provider.PatchEvent(ctx, master.Id, &calendar.Event{Recurrence: before}, opts)
+	return err
+}
+
+// resolveSeries loads the event a change applies to. It returns a nil
+// master when the change affects just the event itself, and a nil
+// instance when eventID is the series itself.
+func resolveSeries(ctx context.Context, provider CalendarProvider, eventID, scope string) (*calendar.Event, *calendar.Event, error) {
+	event, err := provider.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if event.RecurringEventId == "" {
+		if IsRecurring(event) {
+			return nil, event, nil
+		}
+		return event, nil, nil
+	}
+	if scope == ScopeThis {
+		return event, nil, nil
+	}
+
+	master, err := provider.GetEvent(ctx, event.RecurringEventId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return event, master, nil
+}
+
+// splitSeries ends the series before the instance and creates a new one,
+// from the given event, for the instance and all that follow
+func splitSeries(ctx context.Context, provider CalendarProvider, master, instance, series *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	before, after, err := SplitRecurrence(master, originalStart(instance))
+	if err != nil {
+		return nil, fmt.Errorf("unable to split series: %w", err)
+	}
+
+	series.Id = ""
+	series.ICalUID = ""
+	series.HtmlLink = ""
+	series.RecurringEventId = ""
+	series.OriginalStartTime = nil
+	if len(series.Recurrence) == 0 {
+		series.Recurrence = after
+	}
+
+	// Create the new series first so a failure leaves the old one intact
+	created, err := provider.CreateEvent(ctx, series, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to split series: %w", err)
+	}
+
+	if _, err := provider.PatchEvent(ctx, master.Id, &calendar.Event{Recurrence: before}, opts); err != nil {
+		if deleteErr := provider.DeleteEvent(ctx, created.Id, WriteOptions{SendUpdates: SendUpdatesNone}); deleteErr != nil {
+			log.Printf("Unable to remove new series %s after failed split: %v", created.Id, deleteErr)
+		}
+		return nil, fmt.Errorf("unable to split series: %w", err)
+	}
+	return created, nil
+}
+
+// shiftToSeries turns the new times of an instance into the times of the
+// series, moving its first occurrence by the same amount
+func shiftToSeries(event, instance, master *calendar.Event) error {
+	newStart, newEnd, err := eventBounds(event)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	seriesStart, err := ParseEventDateTime(master.Start)
+	if err != nil {
+		return err
+	}
+
+	start := seriesStart.Add(newStart.Sub(originalStart(instance)))
+	end := start.Add(newEnd.Sub(newStart))
+	event.Start = shiftedDateTime(event.Start, start)
+	event.End = shiftedDateTime(event.End, end)
+	return nil
+}
+
+// shiftedDateTime writes t in the same form as dt: a date for all-day
+// events, otherwise a time in dt's zone
+func shiftedDateTime(dt *calendar.EventDateTime, t time.Time) *calendar.EventDateTime {
+	loc := time.UTC
+	if dt.TimeZone != "" {
+		if l, err := time.LoadLocation(dt.TimeZone); err == nil {
+			loc = l
+		}
+	}
+
+	if dt.Date != "" {
+		return &calendar.EventDateTime{Date: t.In(loc).Format("2006-01-02"), TimeZone: dt.TimeZone}
+	}
+	return &calendar.EventDateTime{DateTime: t.In(loc).Format(time.RFC3339), TimeZone: dt.TimeZone}
+}
+
+// originalStart is when an instance was scheduled to start before any
+// change made to it alone
+func originalStart(instance *calendar.Event) time.Time {
+	if t, err := ParseEventDateTime(instance.OriginalStartTime); err == nil {
+		return t
+	}
+	t, _ := ParseEventDateTime(instance.Start)
+	return t
+}
+
+// startsSeries reports whether the instance is the first of its series, in
+// which case "this and following" means the whole series
+func startsSeries(instance, master *calendar.Event) bool {
+	seriesStart, err := ParseEventDateTime(master.Start)
+	return err == nil && !originalStart(instance).After(seriesStart)
+}
+
+// WithSeries prepares listed events for export: the instances of a
+// recurring event are preceded by the series itself, so the recurrence
+// rule is kept and the instances act as its overrides. Instances whose
+// series can't be loaded are kept as single events.
+func WithSeries(ctx context.Context, provider CalendarProvider, events []*calendar.Event) []*calendar.Event {
+	masters := map[string]*calendar.Event{}
+	var result []*calendar.Event
+	for _, event := range events {
+		if event.RecurringEventId == "" {
+			result = append(result, event)
+			continue
+		}
+
+		master, loaded := masters[event.RecurringEventId]
+		if !loaded {
+			var err error
+			master, err = provider.GetEvent(ctx, event.RecurringEventId)
+			if err != nil {
+				log.Printf("Exporting instance %s without its series: %v", event.Id, err)
+				master = nil
+			}
+			masters[event.RecurringEventId] = master
+			if master != nil {
+				result = append(result, master)
+			}
+		}
+
+		if master == nil {
+			single := copyEvent(event)
+			single.ICalUID = event.Id
+			single.RecurringEventId = ""
+			single.OriginalStartTime = nil
+			result = append(result, single)
+			continue
+		}
+		result = append(result, event)
+	}
+	return result
+}
@@ -0,0 +1,230 @@
+package calendar
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// WorkingHours is the part of the day, in a participant's own time zone,
+// during which meetings may be scheduled
+type WorkingHours struct {
+	// Start and End are wall-clock times of day, as durations since midnight
+	Start time.Duration
+	End   time.Duration
+	// Days lists the weekdays that are working days
+	Days []time.Weekday
+}
+
+// DefaultWorkingHours is 09:00 to 17:00, Monday to Friday
+var DefaultWorkingHours = WorkingHours{
+	Start: 9 * time.Hour,
+	End:   17 * time.Hour,
+	Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+}
+
+// ParseWorkingHours reads working hours given as "HH:MM" times of day
+func ParseWorkingHours(start, end string, days []time.Weekday) (WorkingHours, error) {
+	startOffset, err := parseTimeOfDay(start)
+	if err != nil {
+		return WorkingHours{}, fmt.Errorf("invalid working hours start: %v", err)
+	}
+	endOffset, err := parseTimeOfDay(end)
+	if err != nil {
+		return WorkingHours{}, fmt.Errorf("invalid working hours end: %v", err)
+	}
+	if endOffset <= startOffset {
+		return WorkingHours{}, fmt.Errorf("working hours must end after they start")
+	}
+	if len(days) == 0 {
+		return WorkingHours{}, fmt.Errorf("working hours need at least one working day")
+	}
+	return WorkingHours{Start: startOffset, End: endOffset, Days: days}, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	if value == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Participant is someone who has to attend a suggested meeting
+type Participant struct {
+	Calendar string
+	Location *time.Location
+	Busy     []Interval
+}
+
+// SuggestOptions controls SuggestTimes
+type SuggestOptions struct {
+	Duration time.Duration
+	// WindowStart and WindowEnd bound the search
+	WindowStart time.Time
+	WindowEnd   time.Time
+	// WorkingHours applies to every participant in their own time zone
+	WorkingHours WorkingHours
+	// Buffer is the free time to keep before and after existing meetings
+	Buffer time.Duration
+	// MinNotice is how far from Now the earliest suggestion may start
+	MinNotice time.Duration
+	// Step is the granularity of candidate start times; defaults to 15 minutes
+	Step time.Duration
+	// MaxResults limits the number of suggestions; defaults to 10
+	MaxResults int
+	// Now is the current time; defaults to time.Now()
+	Now time.Time
+}
+
+// Suggestion is a candidate meeting slot
+type Suggestion struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Score ranks suggestions from 0 to 1; higher is better
+	Score float64 `json:"score"`
+}
+
+// SuggestTimes finds slots in which every participant is free and inside
+// their working hours. Slots are ranked by how close to the middle of
+// everyone's working day they fall, then by how soon they are. Returned
+// slots never overlap each other.
+func SuggestTimes(participants []Participant, opts SuggestOptions) []Suggestion {
+	if opts.Step <= 0 {
+		opts.Step = 15 * time.Minute
+	}
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = 10
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Duration <= 0 || !opts.WindowEnd.After(opts.WindowStart) {
+		return nil
+	}
+
+	// Widen every busy interval by the buffer so slots keep their distance
+	busy := make([][]Interval, len(participants))
+	for i, participant := range participants {
+		var widened []Interval
+		for _, interval := range participant.Busy {
+			widened = append(widened, Interval{
+				Start: interval.Start.Add(-opts.Buffer),
+				End:   interval.End.Add(opts.Buffer),
+			})
+		}
+		busy[i] = MergeIntervals(widened)
+	}
+
+	earliest := maxTime(opts.WindowStart, opts.Now.Add(opts.MinNotice))
+	start := earliest.Truncate(opts.Step)
+	if start.Before(earliest) {
+		start = start.Add(opts.Step)
+	}
+	window := opts.WindowEnd.Sub(opts.WindowStart).Seconds()
+
+	var candidates []Suggestion
+	for ; !start.Add(opts.Duration).After(opts.WindowEnd); start = start.Add(opts.Step) {
+		slot := Interval{Start: start, End: start.Add(opts.Duration)}
+
+		available := true
+		centered := 0.0
+		for i, participant := range participants {
+			fit, ok := workingHoursFit(slot, participant.Location, opts.WorkingHours)
+			if !ok || overlapsAny(slot, busy[i]) {
+				available = false
+				break
+			}
+			centered += fit
+		}
+		if !available {
+			continue
+		}
+		if len(participants) > 0 {
+			centered /= float64(len(participants))
+		}
+
+		soon := 1 - slot.Start.Sub(opts.WindowStart).Seconds()/window
+		score := 0.7*centered + 0.3*soon
+		candidates = append(candidates, Suggestion{
+			Start: slot.Start,
+			End:   slot.End,
+			Score: math.Round(score*100) / 100,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Start.Before(candidates[j].Start)
+	})
+
+	var suggestions []Suggestion
+	for _, candidate := range candidates {
+		if len(suggestions) == opts.MaxResults {
+			break
+		}
+		slot := Interval{Start: candidate.Start, End: candidate.End}
+		clashes := false
+		for _, chosen := range suggestions {
+			if slot.Overlaps(Interval{Start: chosen.Start, End: chosen.End}) {
+				clashes = true
+				break
+			}
+		}
+		if !clashes {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	return suggestions
+}
+
+// workingHoursFit reports whether the slot lies within one working day in
+// loc, and how close it is to the middle of that day: 1 when centered,
+// 0 when it touches either end
+func workingHoursFit(slot Interval, loc *time.Location, hours WorkingHours) (float64, bool) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := slot.Start.In(loc)
+
+	working := false
+	for _, day := range hours.Days {
+		if local.Weekday() == day {
+			working = true
+			break
+		}
+	}
+	if !working {
+		return 0, false
+	}
+
+	// Working hours are wall-clock times, so build them from the date
+	// rather than adding to midnight, which is off by the shift on DST days
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, int(hours.Start.Minutes()), 0, 0, loc)
+	dayEnd := time.Date(local.Year(), local.Month(), local.Day(), 0, int(hours.End.Minutes()), 0, 0, loc)
+	if slot.Start.Before(dayStart) || slot.End.After(dayEnd) {
+		return 0, false
+	}
+
+	slack := dayEnd.Sub(dayStart) - slot.End.Sub(slot.Start)
+	if slack <= 0 {
+		return 1, true
+	}
+	offCenter := math.Abs(slot.Start.Sub(dayStart).Seconds() - dayEnd.Sub(slot.End).Seconds())
+	return 1 - offCenter/slack.Seconds(), true
+}
+
+func overlapsAny(slot Interval, intervals []Interval) bool {
+	for _, interval := range intervals {
+		if slot.Overlaps(interval) {
+			return true
+		}
+	}
+	return false
+}
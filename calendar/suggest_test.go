@@ -0,0 +1,41 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkingHoursFitAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data unavailable")
+	}
+	everyDay := WorkingHours{
+		Start: 9 * time.Hour,
+		End:   17 * time.Hour,
+		Days:  []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday},
+	}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		fits  bool
+	}{
+		{"first hour, normal day", time.Date(2026, 3, 28, 9, 0, 0, 0, berlin), true},
+		{"first hour, clocks go forward", time.Date(2026, 3, 29, 9, 0, 0, 0, berlin), true},
+		{"before hours, clocks go forward", time.Date(2026, 3, 29, 8, 0, 0, 0, berlin), false},
+		{"last hour, clocks go forward", time.Date(2026, 3, 29, 16, 0, 0, 0, berlin), true},
+		{"first hour, clocks go back", time.Date(2026, 10, 25, 9, 0, 0, 0, berlin), true},
+		{"last hour, clocks go back", time.Date(2026, 10, 25, 16, 0, 0, 0, berlin), true},
+		{"after hours, clocks go back", time.Date(2026, 10, 25, 17, 0, 0, 0, berlin), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot := Interval{Start: tt.start, End: tt.start.Add(time.Hour)}
+			if _, fits := workingHoursFit(slot, berlin, everyDay); fits != tt.fits {
+				t.Errorf("workingHoursFit(%v) fits = %v, want %v", tt.start, fits, tt.fits)
+			}
+		})
+	}
+}
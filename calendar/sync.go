@@ -0,0 +1,357 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goauthDemo/models"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// ErrSyncTokenExpired is returned by a Syncer that no longer accepts a sync
+// token; the calendar has to be synced from scratch
+var ErrSyncTokenExpired = errors.New("sync token expired")
+
+// Syncer is implemented by providers that can report what changed in a
+// calendar since an earlier sync
+type Syncer interface {
+	// SyncEvents returns the events changed since syncToken was issued, or
+	// every event when it's empty. Recurring events are expanded into
+	// instances and deleted events come back with status "cancelled".
+	SyncEvents(ctx context.Context, syncToken string) (*SyncResult, error)
+}
+
+// SyncResult is the outcome of Syncer.SyncEvents
+type SyncResult struct {
+	Items []*calendar.Event
+	// NextSyncToken continues from this sync next time
+	NextSyncToken string
+}
+
+// EventCache stores synced events and how far each calendar was synced.
+// *database.EventRepository satisfies it.
+type EventCache interface {
+	// GetSyncState returns nil if the calendar was never synced
+	GetSyncState(userID int, calendarID string) (*models.SyncState, error)
+	// ReplaceEvents swaps the cached events of a calendar for a full sync
+	ReplaceEvents(userID int, calendarID string, events []models.CachedEvent, syncToken string) error
+	// ApplyEventChanges stores the changed events of an incremental sync
+	// and drops the deleted ones
+	ApplyEventChanges(userID int, calendarID string, changed []models.CachedEvent, deleted []string, syncToken string) error
+	// ListCachedEvents returns the events overlapping the window ordered by start time
+	ListCachedEvents(userID int, calendarID string, timeMin, timeMax time.Time) ([]models.CachedEvent, error)
+	// MarkCalendarStale makes the next listing sync the calendar first
+	MarkCalendarStale(userID int, calendarID string) error
+}
+
+// CachedProvider serves ListEvents from an EventCache that is kept up to
+// date with incremental syncs, sparing a full listing on every request.
+// Other reads go to the wrapped provider; writes mark the cache stale.
+type CachedProvider struct {
+	CalendarProvider
+	syncer     Syncer
+	cache      EventCache
+	locks      *syncLocks
+	userID     int
+	calendarID string
+	// maxAge is how long a synced calendar is listed without asking the
+	// provider for changes
+	maxAge time.Duration
+}
+
+// NewCachingFactory wraps a ProviderFactory so that providers able to sync
+// incrementally list events from the cache. Listings at most maxAge old
+// are served without contacting the provider.
+func NewCachingFactory(factory ProviderFactory, cache EventCache, maxAge time.Duration) ProviderFactory {
+	locks := &syncLocks{locks: make(map[string]*sync.Mutex)}
+
+	return func(ctx context.Context, user *models.User) (CalendarProvider, error) {
+		provider, err := factory(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return newCachedProvider(provider, cache, locks, user.ID, PrimaryCalendar, maxAge), nil
+	}
+}
+
+// newCachedProvider wraps provider if it supports incremental sync
+func newCachedProvider(provider CalendarProvider, cache EventCache, locks *syncLocks, userID int, calendarID string, maxAge time.Duration) CalendarProvider {
+	syncer, ok := provider.(Syncer)
+	if !ok {
+		return provider
+	}
+	return &CachedProvider{
+		CalendarProvider: provider,
+		syncer:           syncer,
+		cache:            cache,
+		locks:            locks,
+		userID:           userID,
+		calendarID:       calendarID,
+		maxAge:           maxAge,
+	}
+}
+
+// syncLocks keeps concurrent requests from syncing the same calendar twice
+type syncLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (l *syncLocks) lock(userID int, calendarID string) func() {
+	key := fmt.Sprintf("%d/%s", userID, calendarID)
+
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[key] = lock
+	}
+	l.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// Page tokens of CachedProvider.ListEvents say which source issued them,
+// so a listing that started from the cache keeps paging through the cache
+// and one served by the provider keeps paging through the provider
+const (
+	cachedPageToken = "cache:"
+	livePageToken   = "live:"
+)
+
+// ListEvents lists the window from the cache, syncing first if the cache
+// is stale. If the cache can't be used the provider is asked directly,
+// unless the request continues a listing of the cache.
+func (p *CachedProvider) ListEvents(ctx context.Context, opts ListOptions) (*EventPage, error) {
+	pageToken := opts.PageToken
+	switch {
+	case strings.HasPrefix(pageToken, livePageToken):
+		opts.PageToken = strings.TrimPrefix(pageToken, livePageToken)
+		return p.listLive(ctx, opts)
+	case pageToken != "" && !strings.HasPrefix(pageToken, cachedPageToken):
+		return nil, fmt.Errorf("%w: invalid page token", ErrInvalidRequest)
+	}
+	opts.PageToken = strings.TrimPrefix(pageToken, cachedPageToken)
+
+	if err := p.syncIfStale(ctx); err != nil {
+		if pageToken != "" {
+			return nil, fmt.Errorf("unable to continue listing: %w", err)
+		}
+		log.Printf("Unable to sync calendar %s of user %d, listing it directly: %v", p.calendarID, p.userID, err)
+		return p.listLive(ctx, opts)
+	}
+
+	cached, err := p.cache.ListCachedEvents(p.userID, p.calendarID, opts.TimeMin, opts.TimeMax)
+	if err != nil {
+		if pageToken != "" {
+			return nil, fmt.Errorf("unable to continue listing: %w", err)
+		}
+		log.Printf("Unable to read cached events of user %d, listing them directly: %v", p.userID, err)
+		return p.listLive(ctx, opts)
+	}
+
+	events := make([]*calendar.Event, 0, len(cached))
+	for _, c := range cached {
+		var event calendar.Event
+		if err := json.Unmarshal([]byte(c.Data), &event); err != nil {
+			log.Printf("Skipping unreadable cached event %s: %v", c.EventID, err)
+			continue
+		}
+		events = append(events, &event)
+	}
+
+	page, err := paginate(events, opts)
+	if err != nil {
+		return nil, err
+	}
+	if page.NextPageToken != "" {
+		page.NextPageToken = cachedPageToken + page.NextPageToken
+	}
+	return page, nil
+}
+
+// listLive lists events from the wrapped provider, tagging its page token
+func (p *CachedProvider) listLive(ctx context.Context, opts ListOptions) (*EventPage, error) {
+	page, err := p.CalendarProvider.ListEvents(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if page.NextPageToken != "" {
+		page.NextPageToken = livePageToken + page.NextPageToken
+	}
+	return page, nil
+}
+
+// Sync brings the cache up to date. Only the changes since the last sync
+// are fetched; a full sync replaces the cache when there is no sync token
+// yet or the provider no longer accepts it.
+func (p *CachedProvider) Sync(ctx context.Context) error {
+	defer p.locks.lock(p.userID, p.calendarID)()
+
+	state, err := p.cache.GetSyncState(p.userID, p.calendarID)
+	if err != nil {
+		return fmt.Errorf("unable to load sync state: %w", err)
+	}
+	return p.sync(ctx, state)
+}
+
+// syncIfStale syncs unless the cache was synced within maxAge and nothing
+// is known to have changed since
+func (p *CachedProvider) syncIfStale(ctx context.Context) error {
+	defer p.locks.lock(p.userID, p.calendarID)()
+
+	state, err := p.cache.GetSyncState(p.userID, p.calendarID)
+	if err != nil {
+		return fmt.Errorf("unable to load sync state: %w", err)
+	}
+	if state != nil && !state.Stale && time.Since(state.SyncedAt) < p.maxAge {
+		return nil
+	}
+	return p.sync(ctx, state)
+}
+
+// sync does the work of Sync; the caller holds the calendar's lock
+func (p *CachedProvider) sync(ctx context.Context, state *models.SyncState) error {
+	if state != nil && state.SyncToken != "" {
+		result, err := p.syncer.SyncEvents(ctx, state.SyncToken)
+		if err == nil {
+			changed, deleted := cachedEvents(p.userID, p.calendarID, result.Items)
+			if err := p.cache.ApplyEventChanges(p.userID, p.calendarID, changed, deleted, result.NextSyncToken); err != nil {
+				return fmt.Errorf("unable to store synced events: %w", err)
+			}
+			log.Printf("Synced calendar %s of user %d: %d changed, %d deleted", p.calendarID, p.userID, len(changed), len(deleted))
+			return nil
+		}
+		if !errors.Is(err, ErrSyncTokenExpired) {
+			return err
+		}
+		log.Printf("Sync token of calendar %s of user %d expired, doing a full sync", p.calendarID, p.userID)
+	}
+
+	result, err := p.syncer.SyncEvents(ctx, "")
+	if err != nil {
+		return err
+	}
+	events, _ := cachedEvents(p.userID, p.calendarID, result.Items)
+	if err := p.cache.ReplaceEvents(p.userID, p.calendarID, events, result.NextSyncToken); err != nil {
+		return fmt.Errorf("unable to store synced events: %w", err)
+	}
+	log.Printf("Fully synced calendar %s of user %d: %d events", p.calendarID, p.userID, len(events))
+	return nil
+}
+
+// cachedEvents converts synced events into cache rows, returning the IDs
+// of cancelled events separately
+func cachedEvents(userID int, calendarID string, items []*calendar.Event) ([]models.CachedEvent, []string) {
+	var changed []models.CachedEvent
+	var deleted []string
+	for _, event := range items {
+		if event.Status == "cancelled" {
+			deleted = append(deleted, event.Id)
+			continue
+		}
+
+		start, end, err := eventBounds(event)
+		if err != nil {
+			log.Printf("Not caching event %s: %v", event.Id, err)
+			continue
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Not caching event %s: %v", event.Id, err)
+			continue
+		}
+		changed = append(changed, models.CachedEvent{
+			UserID:     userID,
+			CalendarID: calendarID,
+			EventID:    event.Id,
+			StartTime:  start,
+			EndTime:    end,
+			Data:       string(data),
+		})
+	}
+	return changed, deleted
+}
+
+// WithCalendar selects another calendar, which gets a cache of its own
+func (p *CachedProvider) WithCalendar(ctx context.Context, calendarID string) (CalendarProvider, error) {
+	provider, err := p.CalendarProvider.WithCalendar(ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	return newCachedProvider(provider, p.cache, p.locks, p.userID, calendarID, p.maxAge), nil
+}
+
+// SendsOwnInvites asks the wrapped provider
+func (p *CachedProvider) SendsOwnInvites() bool {
+	return SendsOwnInvites(p.CalendarProvider)
+}
+
+// FindByICalUID asks the wrapped provider, which may not support it
+func (p *CachedProvider) FindByICalUID(ctx context.Context, uid string) (*calendar.Event, error) {
+	finder, ok := p.CalendarProvider.(ICalUIDFinder)
+	if !ok {
+		return nil, fmt.Errorf("unable to retrieve event: %w", ErrNotSupported)
+	}
+	return finder.FindByICalUID(ctx, uid)
+}
+
+// CreateEvent creates the event and marks the cache stale
+func (p *CachedProvider) CreateEvent(ctx context.Context, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	created, err := p.CalendarProvider.CreateEvent(ctx, event, opts)
+	if err == nil {
+		p.MarkStale()
+	}
+	return created, err
+}
+
+// UpdateEvent replaces the event and marks the cache stale
+func (p *CachedProvider) UpdateEvent(ctx context.Context, eventID string, event *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	updated, err := p.CalendarProvider.UpdateEvent(ctx, eventID, event, opts)
+	if err == nil {
+		p.MarkStale()
+	}
+	return updated, err
+}
+
+// PatchEvent changes the event and marks the cache stale
+func (p *CachedProvider) PatchEvent(ctx context.Context, eventID string, patch *calendar.Event, opts WriteOptions) (*calendar.Event, error) {
+	patched, err := p.CalendarProvider.PatchEvent(ctx, eventID, patch, opts)
+	if err == nil {
+		p.MarkStale()
+	}
+	return patched, err
+}
+
+// RespondToEvent records the response and marks the cache stale
+func (p *CachedProvider) RespondToEvent(ctx context.Context, eventID string, rsvp RSVP, opts WriteOptions) (*calendar.Event, error) {
+	event, err := p.CalendarProvider.RespondToEvent(ctx, eventID, rsvp, opts)
+	if err == nil {
+		p.MarkStale()
+	}
+	return event, err
+}
+
+// DeleteEvent cancels the event and marks the cache stale
+func (p *CachedProvider) DeleteEvent(ctx context.Context, eventID string, opts WriteOptions) error {
+	err := p.CalendarProvider.DeleteEvent(ctx, eventID, opts)
+	if err == nil {
+		p.MarkStale()
+	}
+	return err
+}
+
+// MarkStale makes the next listing sync first, e.g. after a change made
+// through us or reported by a push notification
+func (p *CachedProvider) MarkStale() {
+	if err := p.cache.MarkCalendarStale(p.userID, p.calendarID); err != nil {
+		log.Printf("Unable to mark calendar %s of user %d stale: %v", p.calendarID, p.userID, err)
+	}
+}
@@ -0,0 +1,157 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goauthDemo/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncingMemory is a MemoryProvider that can sync, or fail to while
+// broken is set
+type syncingMemory struct {
+	*MemoryProvider
+	broken bool
+}
+
+func (m *syncingMemory) SyncEvents(ctx context.Context, syncToken string) (*SyncResult, error) {
+	if m.broken {
+		return nil, errors.New("provider unavailable")
+	}
+	page, err := m.MemoryProvider.ListEvents(ctx, ListOptions{TimeMin: time.Now().AddDate(-1, 0, 0), TimeMax: time.Now().AddDate(1, 0, 0)})
+	if err != nil {
+		return nil, err
+	}
+	return &SyncResult{Items: page.Items, NextSyncToken: "next"}, nil
+}
+
+// memoryCache is an EventCache in memory
+type memoryCache struct {
+	mu     sync.Mutex
+	events []models.CachedEvent
+	state  *models.SyncState
+}
+
+func (c *memoryCache) GetSyncState(userID int, calendarID string) (*models.SyncState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state, nil
+}
+
+func (c *memoryCache) ReplaceEvents(userID int, calendarID string, events []models.CachedEvent, syncToken string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = events
+	c.state = &models.SyncState{SyncToken: syncToken, SyncedAt: time.Now()}
+	return nil
+}
+
+func (c *memoryCache) ApplyEventChanges(userID int, calendarID string, changed []models.CachedEvent, deleted []string, syncToken string) error {
+	return c.ReplaceEvents(userID, calendarID, changed, syncToken)
+}
+
+func (c *memoryCache) ListCachedEvents(userID int, calendarID string, timeMin, timeMax time.Time) ([]models.CachedEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.events, nil
+}
+
+func (c *memoryCache) MarkCalendarStale(userID int, calendarID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != nil {
+		c.state.Stale = true
+	}
+	return nil
+}
+
+func TestCachedProviderPageTokens(t *testing.T) {
+	ctx := context.Background()
+	memory := &syncingMemory{MemoryProvider: NewMemoryProvider("alice@example.com")}
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		at := start.Add(time.Duration(i) * 24 * time.Hour)
+		event := NewEvent(fmt.Sprintf("Meeting %d", i), at.Format(time.RFC3339), at.Add(time.Hour).Format(time.RFC3339), "", nil, "UTC")
+		if _, err := memory.CreateEvent(ctx, event, WriteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	locks := &syncLocks{locks: make(map[string]*sync.Mutex)}
+	window := ListOptions{TimeMin: start.Add(-time.Hour), TimeMax: start.AddDate(0, 0, 7), MaxResults: 2}
+
+	tests := []struct {
+		name string
+		// brokenFirst and brokenNext break syncing for the first and the
+		// second page
+		brokenFirst, brokenNext bool
+		firstPrefix             string
+		nextErr                 bool
+	}{
+		{"cache throughout", false, false, cachedPageToken, false},
+		{"provider throughout", true, true, livePageToken, false},
+		{"provider recovers after a live first page", true, false, livePageToken, false},
+		{"cache fails after a cached first page", false, true, cachedPageToken, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newCachedProvider(memory, &memoryCache{}, locks, 1, PrimaryCalendar, 0)
+
+			memory.broken = tt.brokenFirst
+			first, err := provider.ListEvents(ctx, window)
+			if err != nil {
+				t.Fatalf("first page: %v", err)
+			}
+			if len(first.Items) != 2 || !strings.HasPrefix(first.NextPageToken, tt.firstPrefix) {
+				t.Fatalf("first page has %d events and token %q, want 2 and a %q token", len(first.Items), first.NextPageToken, tt.firstPrefix)
+			}
+
+			memory.broken = tt.brokenNext
+			next := window
+			next.PageToken = first.NextPageToken
+			second, err := provider.ListEvents(ctx, next)
+			if tt.nextErr {
+				if err == nil {
+					t.Fatal("second page served from another source, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("second page: %v", err)
+			}
+			if len(second.Items) != 1 || second.Items[0].Summary != "Meeting 2" {
+				t.Errorf("second page = %d events, want only Meeting 2", len(second.Items))
+			}
+		})
+	}
+
+	provider := newCachedProvider(memory, &memoryCache{}, locks, 1, PrimaryCalendar, 0)
+	memory.broken = false
+	if _, err := provider.ListEvents(ctx, ListOptions{PageToken: "2"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("untagged page token: error = %v, want %v", err, ErrInvalidRequest)
+	}
+}
+
+func TestCachedProviderSendsOwnInvites(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider CalendarProvider
+		want     bool
+	}{
+		{"memory", NewMemoryProvider("alice@example.com"), false},
+		{"microsoft", &MicrosoftProvider{}, true},
+		{"cached microsoft", newCachedProvider(&MicrosoftProvider{}, nil, nil, 1, PrimaryCalendar, time.Minute), true},
+		{"cached memory", newCachedProvider(NewMemoryProvider("alice@example.com"), nil, nil, 1, PrimaryCalendar, time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		if got := SendsOwnInvites(tt.provider); got != tt.want {
+			t.Errorf("%s: SendsOwnInvites() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package calendar
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"goauthDemo/models"
+	"log"
+	"time"
+)
+
+// Watcher is implemented by providers that can push a notification to a
+// webhook whenever events in the calendar change
+type Watcher interface {
+	// WatchEvents opens a notification channel to address. The token is
+	// sent back with every notification. Returns the provider's ID of the
+	// watched resource and when the channel expires.
+	WatchEvents(ctx context.Context, channelID, address, token string, ttl time.Duration) (string, time.Time, error)
+	// StopWatching closes a channel opened by WatchEvents
+	StopWatching(ctx context.Context, channelID, resourceID string) error
+}
+
+// WatchStore keeps track of open notification channels.
+// *database.WatchRepository satisfies it.
+type WatchStore interface {
+	// GetWatchChannel returns nil if there is no channel with the given ID
+	GetWatchChannel(channelID string) (*models.WatchChannel, error)
+	// ListWatchChannels returns the channels of a calendar, latest expiry first
+	ListWatchChannels(userID int, calendarID string) ([]models.WatchChannel, error)
+	// ListExpiringWatchChannels returns the channels expiring before the given time
+	ListExpiringWatchChannels(before time.Time) ([]models.WatchChannel, error)
+	SaveWatchChannel(channel *models.WatchChannel) error
+	DeleteWatchChannel(channelID string) error
+}
+
+// UserLookup loads users by ID. *database.UserRepository satisfies it.
+type UserLookup interface {
+	GetUserByID(id int) (*models.User, error)
+}
+
+// WatchManager opens notification channels for users' calendars and
+// renews them before they expire, so the event cache can be kept fresh
+// without polling
+type WatchManager struct {
+	Store WatchStore
+	Users UserLookup
+	// Calendars should return the providers themselves, not cached ones
+	Calendars ProviderFactory
+	// Address is the public HTTPS URL of the webhook receiver
+	Address string
+	// TTL is how long channels are requested for; providers may cap it
+	TTL time.Duration
+	// RenewBefore is how long before expiry a channel is replaced
+	RenewBefore time.Duration
+}
+
+// Watch makes sure one of the user's calendars has an open channel that
+// isn't about to expire. Providers that can't push notifications are
+// skipped.
+func (m *WatchManager) Watch(ctx context.Context, user *models.User, calendarID string) error {
+	channels, err := m.Store.ListWatchChannels(user.ID, calendarID)
+	if err != nil {
+		return fmt.Errorf("unable to load watch channels: %w", err)
+	}
+	if len(channels) > 0 && channels[0].Expiration.After(time.Now().Add(m.RenewBefore)) {
+		return nil
+	}
+
+	provider, err := m.Calendars(ctx, user)
+	if err != nil {
+		return fmt.Errorf("unable to create calendar provider: %w", err)
+	}
+	if calendarID != PrimaryCalendar {
+		if provider, err = provider.WithCalendar(ctx, calendarID); err != nil {
+			return err
+		}
+	}
+	watcher, ok := provider.(Watcher)
+	if !ok {
+		return nil
+	}
+
+	channelID, err := randomHex(16)
+	if err != nil {
+		return fmt.Errorf("unable to create channel ID: %v", err)
+	}
+	token, err := randomHex(32)
+	if err != nil {
+		return fmt.Errorf("unable to create channel token: %v", err)
+	}
+
+	resourceID, expiration, err := watcher.WatchEvents(ctx, channelID, m.Address, token, m.TTL)
+	if err != nil {
+		return err
+	}
+
+	channel := &models.WatchChannel{
+		UserID:     user.ID,
+		CalendarID: calendarID,
+		ChannelID:  channelID,
+		ResourceID: resourceID,
+		Token:      token,
+		Expiration: expiration,
+	}
+	if err := m.Store.SaveWatchChannel(channel); err != nil {
+		// Nobody would recognize its notifications, so close it again
+		if stopErr := watcher.StopWatching(ctx, channelID, resourceID); stopErr != nil {
+			log.Printf("Unable to stop unsaved watch channel %s: %v", channelID, stopErr)
+		}
+		return fmt.Errorf("unable to save watch channel: %w", err)
+	}
+
+	log.Printf("Watching calendar %s of user %d until %s", calendarID, user.ID, expiration.Format(time.RFC3339))
+	return nil
+}
+
+// Renew replaces every channel that expires within RenewBefore with a new
+// one and stops the old one
+func (m *WatchManager) Renew(ctx context.Context) error {
+	channels, err := m.Store.ListExpiringWatchChannels(time.Now().Add(m.RenewBefore))
+	if err != nil {
+		return fmt.Errorf("unable to load expiring watch channels: %w", err)
+	}
+
+	for _, channel := range channels {
+		user, err := m.Users.GetUserByID(channel.UserID)
+		if err != nil {
+			log.Printf("Dropping watch channel %s of missing user %d: %v", channel.ChannelID, channel.UserID, err)
+			m.forget(channel)
+			continue
+		}
+
+		if err := m.Watch(ctx, user, channel.CalendarID); err != nil {
+			log.Printf("Unable to renew watch channel %s: %v", channel.ChannelID, err)
+			continue
+		}
+		m.stop(ctx, user, channel)
+	}
+	return nil
+}
+
+// Run renews channels every interval until ctx is done
+func (m *WatchManager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Renew(ctx); err != nil {
+			log.Printf("Error renewing watch channels: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop closes a channel with the provider, unless it has expired anyway,
+// and forgets it
+func (m *WatchManager) stop(ctx context.Context, user *models.User, channel models.WatchChannel) {
+	if channel.Expiration.After(time.Now()) {
+		if provider, err := m.Calendars(ctx, user); err == nil {
+			if watcher, ok := provider.(Watcher); ok {
+				if err := watcher.StopWatching(ctx, channel.ChannelID, channel.ResourceID); err != nil {
+					log.Printf("Unable to stop watch channel %s: %v", channel.ChannelID, err)
+				}
+			}
+		}
+	}
+	m.forget(channel)
+}
+
+func (m *WatchManager) forget(channel models.WatchChannel) {
+	if err := m.Store.DeleteWatchChannel(channel.ChannelID); err != nil {
+		log.Printf("Unable to delete watch channel %s: %v", channel.ChannelID, err)
+	}
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
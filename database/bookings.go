@@ -0,0 +1,97 @@
+package db
+
+import (
+	"goauthDemo/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BookingRepository provides methods to interact with the booking types
+// and bookings tables
+type BookingRepository struct {
+	DB *gorm.DB
+}
+
+// NewBookingRepository creates a new BookingRepository instance
+func NewBookingRepository(db *gorm.DB) *BookingRepository {
+	return &BookingRepository{DB: db}
+}
+
+// ListBookingTypes fetches a user's booking types ordered by slug
+func (r *BookingRepository) ListBookingTypes(userID int) ([]models.BookingType, error) {
+	var types []models.BookingType
+	err := r.DB.Where("user_id = ?", userID).Order("slug").Find(&types).Error
+	return types, err
+}
+
+// GetBookingType fetches one of a user's booking types, or nil if there
+// is none with that slug
+func (r *BookingRepository) GetBookingType(userID int, slug string) (*models.BookingType, error) {
+	var bookingType models.BookingType
+	err := r.DB.Where("user_id = ? AND slug = ?", userID, slug).First(&bookingType).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bookingType, nil
+}
+
+// SaveBookingType creates or updates a booking type
+func (r *BookingRepository) SaveBookingType(bookingType *models.BookingType) error {
+	return r.DB.Save(bookingType).Error
+}
+
+// DeleteBookingType removes one of a user's booking types. Its bookings
+// are kept.
+func (r *BookingRepository) DeleteBookingType(userID int, slug string) error {
+	return r.DB.Where("user_id = ? AND slug = ?", userID, slug).Delete(&models.BookingType{}).Error
+}
+
+// ListBookings fetches the active bookings of a booking type starting
+// within the window
+func (r *BookingRepository) ListBookings(bookingTypeID uint, from, to time.Time) ([]models.Booking, error) {
+	var bookings []models.Booking
+	err := r.DB.Where("booking_type_id = ? AND start_time >= ? AND start_time < ? AND cancelled_at IS NULL", bookingTypeID, from, to).
+		Order("start_time").
+		Find(&bookings).Error
+	return bookings, err
+}
+
+// CreateBooking stores a new booking, reporting false if its booking
+// type already has an active one at that start time
+func (r *BookingRepository) CreateBooking(booking *models.Booking) (bool, error) {
+	result := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(booking)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// SetBookingEvent records the calendar event created for a booking
+func (r *BookingRepository) SetBookingEvent(id uint, eventID string) error {
+	return r.DB.Model(&models.Booking{}).Where("id = ?", id).Update("event_id", eventID).Error
+}
+
+// DeleteBooking removes a booking, freeing its slot
+func (r *BookingRepository) DeleteBooking(id uint) error {
+	return r.DB.Delete(&models.Booking{}, id).Error
+}
+
+// CancelBooking marks a booking cancelled, freeing its slot while keeping
+// the record of it
+func (r *BookingRepository) CancelBooking(id uint) error {
+	return r.DB.Model(&models.Booking{}).Where("id = ? AND cancelled_at IS NULL", id).Update("cancelled_at", time.Now()).Error
+}
+
+// dropFullBookingSlotIndex removes the unique slot index that also
+// covered cancelled bookings; idx_booking_open_slot replaces it
+func dropFullBookingSlotIndex() error {
+	if !DB.Migrator().HasIndex(&models.Booking{}, "idx_booking_slot") {
+		return nil
+	}
+	return DB.Migrator().DropIndex(&models.Booking{}, "idx_booking_slot")
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"goauthDemo/models"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestBookingSlotIndexCoversActiveBookings(t *testing.T) {
+	parsed, err := schema.Parse(&models.Booking{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var index *schema.Index
+	for _, candidate := range parsed.ParseIndexes() {
+		if candidate.Name == "idx_booking_open_slot" {
+			index = &candidate
+		}
+	}
+	if index == nil {
+		t.Fatal("bookings have no idx_booking_open_slot index")
+	}
+	if index.Class != "UNIQUE" || index.Where != "cancelled_at IS NULL" {
+		t.Errorf("index is %s WHERE %q, want UNIQUE WHERE cancelled_at IS NULL", index.Class, index.Where)
+	}
+	var columns []string
+	for _, option := range index.Fields {
+		columns = append(columns, option.DBName)
+	}
+	if len(columns) != 2 || columns[0] != "booking_type_id" || columns[1] != "start_time" {
+		t.Errorf("index columns = %v, want [booking_type_id start_time]", columns)
+	}
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"goauthDemo/models"
+	"log"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// encryptedPrefix marks values written by EncryptedSerializer; anything
+// else in an encrypted column is a plaintext value from before encryption
+const encryptedPrefix = "enc:v1:"
+
+// credentialsCipher seals third-party credentials at rest, see
+// SetCredentialsKey
+var credentialsCipher cipher.AEAD
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// SetCredentialsKey sets the server-side secret that stored credentials
+// such as CalDAV passwords are encrypted with (AES-256-GCM keyed by its
+// SHA-256). Changing it makes existing credentials unreadable.
+func SetCredentialsKey(secret string) error {
+	if secret == "" {
+		return errors.New("credentials key is empty")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return fmt.Errorf("unable to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("unable to create cipher: %w", err)
+	}
+	credentialsCipher = aead
+	return nil
+}
+
+// EncryptedSerializer stores a string column encrypted with the
+// credentials key (gorm tag serializer:encrypted). Empty strings are
+// stored as is.
+type EncryptedSerializer struct{}
+
+// Scan decrypts the column into the string field
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T for encrypted column %s", dbValue, field.Name)
+	}
+
+	plaintext, err := decryptCredential(stored)
+	if err != nil {
+		return fmt.Errorf("unable to decrypt %s: %w", field.Name, err)
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+// Value encrypts the string field for storage
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %T for encrypted column %s", fieldValue, field.Name)
+	}
+	return encryptCredential(plaintext)
+}
+
+func encryptCredential(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	if credentialsCipher == nil {
+		return "", errors.New("credentials key not set")
+	}
+
+	nonce := make([]byte, credentialsCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("unable to create nonce: %w", err)
+	}
+	sealed := credentialsCipher.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptCredential(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	if credentialsCipher == nil {
+		return "", errors.New("credentials key not set")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil || len(sealed) < credentialsCipher.NonceSize() {
+		return "", errors.New("malformed ciphertext")
+	}
+	nonce, ciphertext := sealed[:credentialsCipher.NonceSize()], sealed[credentialsCipher.NonceSize():]
+	plaintext, err := credentialsCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("wrong credentials key or corrupted value")
+	}
+	return string(plaintext), nil
+}
+
+// encryptStoredCredentials rewrites CalDAV passwords saved before they
+// were encrypted
+func encryptStoredCredentials() error {
+	var users []models.User
+	err := DB.Select("id", "caldav_password").
+		Where("caldav_password <> '' AND caldav_password NOT LIKE ?", encryptedPrefix+"%").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		// Reading went through Scan, so this is the plaintext; saving
+		// it again encrypts it
+		err := DB.Model(&models.User{}).Where("id = ?", user.ID).
+			Select("CalDAVPassword").
+			Updates(models.User{CalDAVPassword: user.CalDAVPassword}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(users) > 0 {
+		log.Printf("Encrypted %d stored CalDAV passwords", len(users))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"goauthDemo/models"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestCredentialRoundTrip(t *testing.T) {
+	if err := SetCredentialsKey("test-credentials-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		stored func() (string, error)
+		want   string
+	}{
+		{"encrypted", func() (string, error) { return encryptCredential("app-password") }, "app-password"},
+		{"empty", func() (string, error) { return encryptCredential("") }, ""},
+		{"plaintext from before encryption", func() (string, error) { return "old-password", nil }, "old-password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := tt.stored()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && strings.Contains(stored, tt.want) && strings.HasPrefix(stored, encryptedPrefix) {
+				t.Errorf("stored value %q contains the plaintext", stored)
+			}
+			got, err := decryptCredential(stored)
+			if err != nil || got != tt.want {
+				t.Errorf("decryptCredential(%q) = %q, %v, want %q", stored, got, err, tt.want)
+			}
+		})
+	}
+
+	sealed, _ := encryptCredential("app-password")
+	SetCredentialsKey("another-key")
+	if _, err := decryptCredential(sealed); err == nil {
+		t.Error("decrypting with another key succeeded")
+	}
+}
+
+func TestCalDAVPasswordIsEncryptedInQueries(t *testing.T) {
+	if err := SetCredentialsKey("test-credentials-key"); err != nil {
+		t.Fatal(err)
+	}
+	dryRun, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := dryRun.Model(&models.User{}).Where("id = ?", 1).
+		Select("CalDAVPassword").Updates(models.User{CalDAVPassword: "app-password"})
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	stmt := tx.Statement
+	for _, v := range stmt.Vars {
+		if s, ok := v.(string); ok && s == "app-password" {
+			t.Fatalf("password written in plaintext: %s %v", stmt.SQL.String(), stmt.Vars)
+		}
+	}
+	if !strings.Contains(stmt.SQL.String(), "caldav_password") {
+		t.Fatalf("unexpected query %s", stmt.SQL.String())
+	}
+}
@@ -28,10 +28,20 @@ func InitDB() {
 	DB = db
 	log.Println("Connected to database successfully")
 
-	err = DB.AutoMigrate(&models.User{})
+	err = DB.AutoMigrate(&models.User{}, &models.CachedEvent{}, &models.SyncState{}, &models.WatchChannel{}, &models.FeedToken{}, &models.BookingType{}, &models.Booking{}, &models.Poll{}, &models.PollOption{}, &models.PollParticipant{}, &models.PollVote{}, &models.ReminderRule{}, &models.ReminderJob{})
 	if err != nil {
 		panic("failed to migrate database")
 	}
+
+	if err := encryptStoredCredentials(); err != nil {
+		panic("failed to encrypt stored credentials: " + err.Error())
+	}
+	if err := dropFullBookingSlotIndex(); err != nil {
+		panic("failed to migrate booking slots: " + err.Error())
+	}
+	if err := hashStoredPollTokens(); err != nil {
+		panic("failed to hash stored poll tokens: " + err.Error())
+	}
 }
 
 // UserRepository provides methods to interact with the users table
@@ -46,8 +56,14 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 
 // CreateOrUpdateUser creates a new user or updates an existing one
 func (r *UserRepository) CreateOrUpdateUser(user *models.User) error {
+	// Accounts are matched on the ID issued by the provider they signed in with
+	query := r.DB.Where("google_id = ?", user.GoogleID)
+	if user.Provider == "microsoftonline" {
+		query = r.DB.Where("microsoft_id = ?", user.MicrosoftID)
+	}
+
 	var existingUser models.User
-	if err := r.DB.Where("google_id = ?", user.GoogleID).First(&existingUser).Error; err != nil {
+	if err := query.First(&existingUser).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// User not found, create a new record
 			return r.DB.Create(user).Error
@@ -59,17 +75,45 @@ func (r *UserRepository) CreateOrUpdateUser(user *models.User) error {
 	existingUser.Email = user.Email
 	existingUser.Name = user.Name
 	existingUser.AccessToken = user.AccessToken
-	existingUser.RefreshToken = user.RefreshToken
+	// Google only hands out a refresh token on the first consent, so keep
+	// the stored one when the provider didn't send a new one
+	if user.RefreshToken != "" {
+		existingUser.RefreshToken = user.RefreshToken
+	}
 	existingUser.TokenExpiry = user.TokenExpiry
 	existingUser.UpdatedAt = time.Now()
 
-	return r.DB.Save(&existingUser).Error
+	if err := r.DB.Save(&existingUser).Error; err != nil {
+		return err
+	}
+
+	// Hand the stored record (including its ID) back to the caller
+	*user = existingUser
+	return nil
+}
+
+// GetUserByID fetches a user by their database ID
+func (r *UserRepository) GetUserByID(id int) (*models.User, error) {
+	var user models.User
+	if err := r.DB.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByGoogleID fetches a user by their Google account ID
+func (r *UserRepository) GetUserByGoogleID(googleID string) (*models.User, error) {
+	var user models.User
+	if err := r.DB.Where("google_id = ?", googleID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 // UpdateUserToken updates a user's tokens
-func (r *UserRepository) UpdateUserToken(googleID, accessToken, refreshToken string, tokenExpiry time.Time) error {
+func (r *UserRepository) UpdateUserToken(userID int, accessToken, refreshToken string, tokenExpiry time.Time) error {
 	return r.DB.Model(&models.User{}).
-		Where("google_id = ?", googleID).
+		Where("id = ?", userID).
 		Updates(models.User{
 			AccessToken:  accessToken,
 			RefreshToken: refreshToken,
@@ -77,3 +121,41 @@ func (r *UserRepository) UpdateUserToken(googleID, accessToken, refreshToken str
 			UpdatedAt:    time.Now(),
 		}).Error
 }
+
+// UpdateCalendarBackend stores which calendar backend a user's meetings go to
+func (r *UserRepository) UpdateCalendarBackend(userID int, backend, caldavURL, caldavUsername, caldavPassword string) error {
+	// Select so that clearing the backend also clears the CalDAV settings.
+	// Calendar IDs differ between backends, so the default calendar is reset.
+	return r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Select("CalendarBackend", "CalDAVURL", "CalDAVUsername", "CalDAVPassword", "DefaultCalendarID", "UpdatedAt").
+		Updates(models.User{
+			CalendarBackend: backend,
+			CalDAVURL:       caldavURL,
+			CalDAVUsername:  caldavUsername,
+			CalDAVPassword:  caldavPassword,
+			UpdatedAt:       time.Now(),
+		}).Error
+}
+
+// UpdateUserTimeZone stores a user's IANA time zone
+func (r *UserRepository) UpdateUserTimeZone(userID int, timeZone string) error {
+	return r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(models.User{
+			TimeZone:  timeZone,
+			UpdatedAt: time.Now(),
+		}).Error
+}
+
+// UpdateDefaultCalendar stores the calendar a user's meetings go to by
+// default; an empty ID goes back to their primary calendar
+func (r *UserRepository) UpdateDefaultCalendar(userID int, calendarID string) error {
+	return r.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Select("DefaultCalendarID", "UpdatedAt").
+		Updates(models.User{
+			DefaultCalendarID: calendarID,
+			UpdatedAt:         time.Now(),
+		}).Error
+}
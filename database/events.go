@@ -0,0 +1,121 @@
+package db
+
+import (
+	"goauthDemo/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EventRepository provides methods to interact with the cached events and
+// sync state tables
+type EventRepository struct {
+	DB *gorm.DB
+}
+
+// NewEventRepository creates a new EventRepository instance
+func NewEventRepository(db *gorm.DB) *EventRepository {
+	return &EventRepository{DB: db}
+}
+
+// GetSyncState fetches the sync state of a user's calendar, or nil if it
+// was never synced
+func (r *EventRepository) GetSyncState(userID int, calendarID string) (*models.SyncState, error) {
+	var state models.SyncState
+	err := r.DB.Where("user_id = ? AND calendar_id = ?", userID, calendarID).First(&state).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// ReplaceEvents swaps all cached events of a calendar for the result of a
+// full sync
+func (r *EventRepository) ReplaceEvents(userID int, calendarID string, events []models.CachedEvent, syncToken string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND calendar_id = ?", userID, calendarID).Delete(&models.CachedEvent{}).Error; err != nil {
+			return err
+		}
+		if err := upsertEvents(tx, events); err != nil {
+			return err
+		}
+		return saveSyncState(tx, userID, calendarID, syncToken)
+	})
+}
+
+// ApplyEventChanges stores the events changed since the last sync and drops
+// the deleted ones
+func (r *EventRepository) ApplyEventChanges(userID int, calendarID string, changed []models.CachedEvent, deleted []string, syncToken string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if len(deleted) > 0 {
+			if err := tx.Where("user_id = ? AND calendar_id = ? AND event_id IN ?", userID, calendarID, deleted).Delete(&models.CachedEvent{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := upsertEvents(tx, changed); err != nil {
+			return err
+		}
+		return saveSyncState(tx, userID, calendarID, syncToken)
+	})
+}
+
+// ListCachedEvents fetches the cached events of a calendar overlapping the
+// window; a zero bound leaves that side open
+func (r *EventRepository) ListCachedEvents(userID int, calendarID string, timeMin, timeMax time.Time) ([]models.CachedEvent, error) {
+	query := r.DB.Where("user_id = ? AND calendar_id = ?", userID, calendarID)
+	if !timeMin.IsZero() {
+		query = query.Where("end_time > ?", timeMin)
+	}
+	if !timeMax.IsZero() {
+		query = query.Where("start_time < ?", timeMax)
+	}
+
+	var events []models.CachedEvent
+	if err := query.Order("start_time, event_id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// MarkCalendarStale flags a calendar as changed since its last sync
+func (r *EventRepository) MarkCalendarStale(userID int, calendarID string) error {
+	return r.DB.Model(&models.SyncState{}).
+		Where("user_id = ? AND calendar_id = ?", userID, calendarID).
+		Updates(map[string]interface{}{"stale": true, "updated_at": time.Now()}).Error
+}
+
+// upsertEvents inserts cached events, overwriting ones already stored
+func upsertEvents(tx *gorm.DB, events []models.CachedEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for i := range events {
+		events[i].UpdatedAt = now
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "calendar_id"}, {Name: "event_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"start_time", "end_time", "data", "updated_at"}),
+	}).CreateInBatches(events, 500).Error
+}
+
+// saveSyncState records a finished sync
+func saveSyncState(tx *gorm.DB, userID int, calendarID, syncToken string) error {
+	now := time.Now()
+	state := models.SyncState{
+		UserID:     userID,
+		CalendarID: calendarID,
+		SyncToken:  syncToken,
+		SyncedAt:   now,
+		Stale:      false,
+		UpdatedAt:  now,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "calendar_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"sync_token", "synced_at", "stale", "updated_at"}),
+	}).Create(&state).Error
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"goauthDemo/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeedRepository provides methods to interact with the feed tokens table
+type FeedRepository struct {
+	DB *gorm.DB
+}
+
+// NewFeedRepository creates a new FeedRepository instance
+func NewFeedRepository(db *gorm.DB) *FeedRepository {
+	return &FeedRepository{DB: db}
+}
+
+// GetFeedToken fetches a user's feed token, or nil if they have none
+func (r *FeedRepository) GetFeedToken(userID int) (*models.FeedToken, error) {
+	return r.first(r.DB.Where("user_id = ?", userID))
+}
+
+// FindFeedToken fetches the feed token with the given hash, or nil if
+// there is none
+func (r *FeedRepository) FindFeedToken(tokenHash string) (*models.FeedToken, error) {
+	return r.first(r.DB.Where("token_hash = ?", tokenHash))
+}
+
+func (r *FeedRepository) first(query *gorm.DB) (*models.FeedToken, error) {
+	var token models.FeedToken
+	err := query.First(&token).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// SaveFeedToken stores a new feed token, replacing the user's old one
+func (r *FeedRepository) SaveFeedToken(token *models.FeedToken) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"token_hash", "last_used_at", "created_at"}),
+	}).Create(token).Error
+}
+
+// DeleteFeedToken revokes a user's feed token
+func (r *FeedRepository) DeleteFeedToken(userID int) error {
+	return r.DB.Where("user_id = ?", userID).Delete(&models.FeedToken{}).Error
+}
+
+// TouchFeedToken records that the feed was fetched
+func (r *FeedRepository) TouchFeedToken(id uint, at time.Time) error {
+	return r.DB.Model(&models.FeedToken{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"goauthDemo/models"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// PollRepository provides methods to interact with the polls tables
+type PollRepository struct {
+	DB *gorm.DB
+}
+
+// NewPollRepository creates a new PollRepository instance
+func NewPollRepository(db *gorm.DB) *PollRepository {
+	return &PollRepository{DB: db}
+}
+
+// ListPolls fetches a user's polls with their options, newest first
+func (r *PollRepository) ListPolls(userID int) ([]models.Poll, error) {
+	var polls []models.Poll
+	err := r.DB.Preload("Options", orderByStart).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&polls).Error
+	return polls, err
+}
+
+// GetPoll fetches one of a user's polls with its options, or nil if there
+// is none with that ID
+func (r *PollRepository) GetPoll(userID int, id uint) (*models.Poll, error) {
+	return r.findPoll(r.DB.Where("user_id = ? AND id = ?", userID, id))
+}
+
+// FindPollByToken fetches the poll whose shareable token has the given
+// hash, or nil if there is none
+func (r *PollRepository) FindPollByToken(tokenHash string) (*models.Poll, error) {
+	return r.findPoll(r.DB.Where("token_hash = ?", tokenHash))
+}
+
+func (r *PollRepository) findPoll(query *gorm.DB) (*models.Poll, error) {
+	var poll models.Poll
+	err := query.Preload("Options", orderByStart).First(&poll).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// CreatePoll stores a new poll together with its options
+func (r *PollRepository) CreatePoll(poll *models.Poll) error {
+	return r.DB.Create(poll).Error
+}
+
+// UpdatePoll saves a poll's own fields, leaving its options alone
+func (r *PollRepository) UpdatePoll(poll *models.Poll) error {
+	return r.DB.Omit("Options").Save(poll).Error
+}
+
+// DeletePoll removes one of a user's polls with its options and votes
+func (r *PollRepository) DeletePoll(userID int, id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND id = ?", userID, id).Delete(&models.Poll{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		participants := tx.Model(&models.PollParticipant{}).Select("id").Where("poll_id = ?", id)
+		if err := tx.Where("participant_id IN (?)", participants).Delete(&models.PollVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("poll_id = ?", id).Delete(&models.PollParticipant{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("poll_id = ?", id).Delete(&models.PollOption{}).Error
+	})
+}
+
+// ListPollParticipants fetches the participants of a poll with their
+// votes, in the order they first voted
+func (r *PollRepository) ListPollParticipants(pollID uint) ([]models.PollParticipant, error) {
+	var participants []models.PollParticipant
+	err := r.DB.Preload("Votes").
+		Where("poll_id = ?", pollID).
+		Order("created_at").
+		Find(&participants).Error
+	return participants, err
+}
+
+// GetPollParticipant fetches the participant of a poll with the email,
+// or nil if they haven't voted
+func (r *PollRepository) GetPollParticipant(pollID uint, email string) (*models.PollParticipant, error) {
+	var participant models.PollParticipant
+	err := r.DB.Where("poll_id = ? AND email = ?", pollID, email).First(&participant).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &participant, nil
+}
+
+// SavePollParticipant creates or updates a participant, replacing their
+// votes with the ones given
+func (r *PollRepository) SavePollParticipant(participant *models.PollParticipant) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Votes").Save(participant).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("participant_id = ?", participant.ID).Delete(&models.PollVote{}).Error; err != nil {
+			return err
+		}
+		if len(participant.Votes) == 0 {
+			return nil
+		}
+		for i := range participant.Votes {
+			participant.Votes[i].ID = 0
+			participant.Votes[i].ParticipantID = participant.ID
+		}
+		return tx.Create(&participant.Votes).Error
+	})
+}
+
+func orderByStart(db *gorm.DB) *gorm.DB {
+	return db.Order("start_time")
+}
+
+// hashStoredPollTokens replaces the voting tokens of polls created before
+// only their hashes were stored (as routes.hashToken does) and drops the
+// old column
+func hashStoredPollTokens() error {
+	if !DB.Migrator().HasColumn(&models.Poll{}, "token") {
+		return nil
+	}
+
+	var polls []struct {
+		ID    uint
+		Token string
+	}
+	err := DB.Table("polls").Select("id", "token").
+		Where("token <> '' AND (token_hash IS NULL OR token_hash = '')").
+		Find(&polls).Error
+	if err != nil {
+		return err
+	}
+	for _, poll := range polls {
+		sum := sha256.Sum256([]byte(poll.Token))
+		err := DB.Table("polls").Where("id = ?", poll.ID).Update("token_hash", hex.EncodeToString(sum[:])).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(polls) > 0 {
+		log.Printf("Hashed the voting tokens of %d polls", len(polls))
+	}
+	return DB.Migrator().DropColumn(&models.Poll{}, "token")
+}
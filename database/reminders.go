@@ -0,0 +1,119 @@
+package db
+
+import (
+	"goauthDemo/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReminderRepository provides methods to interact with the reminder rules
+// and reminder jobs tables
+type ReminderRepository struct {
+	DB *gorm.DB
+}
+
+// NewReminderRepository creates a new ReminderRepository instance
+func NewReminderRepository(db *gorm.DB) *ReminderRepository {
+	return &ReminderRepository{DB: db}
+}
+
+// ListReminderRules fetches the reminder rules of every user
+func (r *ReminderRepository) ListReminderRules() ([]models.ReminderRule, error) {
+	var rules []models.ReminderRule
+	err := r.DB.Order("user_id, id").Find(&rules).Error
+	return rules, err
+}
+
+// ListUserReminderRules fetches a user's reminder rules
+func (r *ReminderRepository) ListUserReminderRules(userID int) ([]models.ReminderRule, error) {
+	var rules []models.ReminderRule
+	err := r.DB.Where("user_id = ?", userID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// GetReminderRule fetches a rule by ID, or nil if it was deleted
+func (r *ReminderRepository) GetReminderRule(id uint) (*models.ReminderRule, error) {
+	var rule models.ReminderRule
+	err := r.DB.Where("id = ?", id).First(&rule).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreateReminderRule stores a new reminder rule
+func (r *ReminderRepository) CreateReminderRule(rule *models.ReminderRule) error {
+	return r.DB.Create(rule).Error
+}
+
+// DeleteReminderRule removes one of a user's reminder rules together with
+// the reminders it has yet to send. Returns false if there was no such rule.
+func (r *ReminderRepository) DeleteReminderRule(userID int, id uint) (bool, error) {
+	deleted := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND id = ?", userID, id).Delete(&models.ReminderRule{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		return tx.Where("rule_id = ? AND status = ?", id, "pending").Delete(&models.ReminderJob{}).Error
+	})
+	return deleted, err
+}
+
+// ListReminderJobs fetches a user's most recently planned reminders
+func (r *ReminderRepository) ListReminderJobs(userID int, limit int) ([]models.ReminderJob, error) {
+	var jobs []models.ReminderJob
+	err := r.DB.Where("user_id = ?", userID).Order("send_at DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// PlanReminderJob stores a reminder unless one for the same rule, event
+// and start time exists already
+func (r *ReminderRepository) PlanReminderJob(job *models.ReminderJob) error {
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(job).Error
+}
+
+// ListDueReminderJobs fetches up to limit pending reminders due by now,
+// earliest first
+func (r *ReminderRepository) ListDueReminderJobs(now time.Time, limit int) ([]models.ReminderJob, error) {
+	var jobs []models.ReminderJob
+	err := r.DB.Where("status = ? AND send_at <= ?", "pending", now).
+		Order("send_at").
+		Limit(limit).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// ClaimReminderJob marks a pending reminder as being sent. Returns false
+// if another scheduler got to it first.
+func (r *ReminderRepository) ClaimReminderJob(id uint, now time.Time) (bool, error) {
+	result := r.DB.Model(&models.ReminderJob{}).
+		Where("id = ? AND status = ?", id, "pending").
+		Updates(map[string]interface{}{"status": "sending", "updated_at": now})
+	return result.RowsAffected == 1, result.Error
+}
+
+// SaveReminderJob stores the outcome of sending a reminder
+func (r *ReminderRepository) SaveReminderJob(job *models.ReminderJob) error {
+	return r.DB.Save(job).Error
+}
+
+// ReleaseReminderJobs hands reminders claimed before the given time back
+// to the queue, for schedulers that stopped while sending them
+func (r *ReminderRepository) ReleaseReminderJobs(claimedBefore time.Time) error {
+	return r.DB.Model(&models.ReminderJob{}).
+		Where("status = ? AND updated_at < ?", "sending", claimedBefore).
+		Update("status", "pending").Error
+}
+
+// DeleteReminderJobs removes the reminders of events that started before
+// the given time
+func (r *ReminderRepository) DeleteReminderJobs(startedBefore time.Time) error {
+	return r.DB.Where("start_time < ? AND status <> ?", startedBefore, "sending").Delete(&models.ReminderJob{}).Error
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"goauthDemo/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WatchRepository provides methods to interact with the watch channels table
+type WatchRepository struct {
+	DB *gorm.DB
+}
+
+// NewWatchRepository creates a new WatchRepository instance
+func NewWatchRepository(db *gorm.DB) *WatchRepository {
+	return &WatchRepository{DB: db}
+}
+
+// GetWatchChannel fetches a channel by the ID it was registered under, or
+// nil if there is none
+func (r *WatchRepository) GetWatchChannel(channelID string) (*models.WatchChannel, error) {
+	var channel models.WatchChannel
+	err := r.DB.Where("channel_id = ?", channelID).First(&channel).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// ListWatchChannels fetches the channels of a user's calendar, latest
+// expiry first
+func (r *WatchRepository) ListWatchChannels(userID int, calendarID string) ([]models.WatchChannel, error) {
+	var channels []models.WatchChannel
+	err := r.DB.Where("user_id = ? AND calendar_id = ?", userID, calendarID).
+		Order("expiration DESC").
+		Find(&channels).Error
+	return channels, err
+}
+
+// ListExpiringWatchChannels fetches the channels expiring before the given time
+func (r *WatchRepository) ListExpiringWatchChannels(before time.Time) ([]models.WatchChannel, error) {
+	var channels []models.WatchChannel
+	err := r.DB.Where("expiration < ?", before).Find(&channels).Error
+	return channels, err
+}
+
+// SaveWatchChannel stores a newly opened channel
+func (r *WatchRepository) SaveWatchChannel(channel *models.WatchChannel) error {
+	return r.DB.Create(channel).Error
+}
+
+// DeleteWatchChannel removes a channel that was stopped or has expired
+func (r *WatchRepository) DeleteWatchChannel(channelID string) error {
+	return r.DB.Where("channel_id = ?", channelID).Delete(&models.WatchChannel{}).Error
+}
@@ -0,0 +1,7 @@
+//go:build dev
+
+package main
+
+// devBuild is set by building with -tags dev, which allows development
+// only settings such as CALENDAR_PROVIDER=memory
+const devBuild = true
@@ -0,0 +1,681 @@
+// Package ical converts between Google Calendar events and iCalendar
+// (RFC 5545) data, as used by CalDAV servers and .ics files.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	prodID        = "-//goauthDemo//Calendar//EN"
+	utcLayout     = "20060102T150405Z"
+	localLayout   = "20060102T150405"
+	dateLayout    = "20060102"
+	maxLineOctets = 75
+	mailtoPrefix  = "mailto:"
+)
+
+// Encode writes the events as a single VCALENDAR with times in UTC
+func Encode(w io.Writer, events []*calendar.Event) error {
+	return EncodeWithOptions(w, events, Options{})
+}
+
+// Options controls how EncodeWithOptions writes a calendar
+type Options struct {
+	// Name is shown by calendar apps as the name of the calendar
+	Name string
+	// LocalTimes writes timed events in their own zone with a TZID, and a
+	// VTIMEZONE for every zone used, instead of in UTC
+	LocalTimes bool
+	// TimeZone is the zone used for timed events that don't name one
+	TimeZone string
+	// Method is the iTIP (RFC 5546) method of a calendar sent by email,
+	// such as REQUEST for an invite or CANCEL for a cancellation
+	Method string
+}
+
+// EncodeWithOptions writes the events as a single VCALENDAR
+func EncodeWithOptions(w io.Writer, events []*calendar.Event, opts Options) error {
+	lw := &lineWriter{w: w}
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + prodID)
+	lw.line("CALSCALE:GREGORIAN")
+	if opts.Method != "" {
+		lw.line("METHOD:" + opts.Method)
+	}
+	if opts.Name != "" {
+		lw.line("X-WR-CALNAME:" + escapeText(opts.Name))
+	}
+
+	enc := &encoder{lw: lw, opts: opts}
+	if opts.LocalTimes {
+		enc.zones = usedZones(events, opts.TimeZone)
+		if opts.TimeZone != "" && enc.zones[opts.TimeZone] != nil {
+			lw.line("X-WR-TIMEZONE:" + opts.TimeZone)
+		}
+		for _, name := range sortedZoneNames(enc.zones) {
+			writeTimeZone(lw, enc.zones[name])
+		}
+	}
+
+	for _, event := range events {
+		if err := enc.encodeEvent(event); err != nil {
+			return err
+		}
+	}
+	lw.line("END:VCALENDAR")
+	return lw.err
+}
+
+// encoder writes the VEVENTs of one calendar
+type encoder struct {
+	lw   *lineWriter
+	opts Options
+	// zones holds the zones written as VTIMEZONEs, by TZID
+	zones map[string]*zoneSpan
+}
+
+func (enc *encoder) encodeEvent(event *calendar.Event) error {
+	lw := enc.lw
+	uid := event.ICalUID
+	if uid == "" {
+		uid = event.Id
+	}
+	if uid == "" {
+		return fmt.Errorf("event %q has no UID", event.Summary)
+	}
+
+	lw.line("BEGIN:VEVENT")
+	lw.line("UID:" + escapeText(uid))
+	lw.line("DTSTAMP:" + time.Now().UTC().Format(utcLayout))
+
+	start, err := enc.formatDateTime("DTSTART", event.Start)
+	if err != nil {
+		return fmt.Errorf("event %s: %v", uid, err)
+	}
+	lw.line(start)
+	if event.End != nil {
+		end, err := enc.formatDateTime("DTEND", event.End)
+		if err != nil {
+			return fmt.Errorf("event %s: %v", uid, err)
+		}
+		lw.line(end)
+	}
+
+	if event.OriginalStartTime != nil {
+		recurrenceID, err := enc.formatDateTime("RECURRENCE-ID", event.OriginalStartTime)
+		if err == nil {
+			lw.line(recurrenceID)
+		}
+	}
+	for _, rule := range event.Recurrence {
+		lw.line(rule)
+	}
+
+	if event.Sequence > 0 {
+		// Lets calendar apps tell newer copies of an invite from older ones
+		lw.line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+	}
+
+	lw.line("SUMMARY:" + escapeText(event.Summary))
+	if event.Description != "" {
+		lw.line("DESCRIPTION:" + escapeText(event.Description))
+	}
+	if event.Location != "" {
+		lw.line("LOCATION:" + escapeText(event.Location))
+	}
+	if event.HtmlLink != "" {
+		lw.line("URL:" + event.HtmlLink)
+	}
+
+	switch event.Status {
+	case "cancelled":
+		lw.line("STATUS:CANCELLED")
+	case "tentative":
+		lw.line("STATUS:TENTATIVE")
+	default:
+		lw.line("STATUS:CONFIRMED")
+	}
+	if event.Transparency == "transparent" {
+		lw.line("TRANSP:TRANSPARENT")
+	}
+
+	if event.Organizer != nil && event.Organizer.Email != "" {
+		lw.line("ORGANIZER" + cnParam(event.Organizer.DisplayName) + ":" + mailtoPrefix + event.Organizer.Email)
+	}
+	for _, attendee := range event.Attendees {
+		role := "REQ-PARTICIPANT"
+		if attendee.Optional {
+			role = "OPT-PARTICIPANT"
+		}
+		lw.line(fmt.Sprintf("ATTENDEE%s;ROLE=%s;PARTSTAT=%s:%s%s",
+			cnParam(attendee.DisplayName), role, partStat(attendee.ResponseStatus), mailtoPrefix, attendee.Email))
+	}
+
+	if event.Reminders != nil {
+		for _, reminder := range event.Reminders.Overrides {
+			enc.encodeAlarm(event, reminder)
+		}
+	}
+
+	lw.line("END:VEVENT")
+	return nil
+}
+
+// encodeAlarm writes a reminder as a VALARM: email reminders go to the
+// organizer, popups are displayed
+func (enc *encoder) encodeAlarm(event *calendar.Event, reminder *calendar.EventReminder) {
+	lw := enc.lw
+	lw.line("BEGIN:VALARM")
+	if reminder.Method == "email" {
+		lw.line("ACTION:EMAIL")
+		lw.line("SUMMARY:" + escapeText(event.Summary))
+		if event.Organizer != nil && event.Organizer.Email != "" {
+			lw.line("ATTENDEE:" + mailtoPrefix + event.Organizer.Email)
+		}
+	} else {
+		lw.line("ACTION:DISPLAY")
+	}
+	lw.line("DESCRIPTION:" + escapeText(event.Summary))
+	lw.line(fmt.Sprintf("TRIGGER:-PT%dM", reminder.Minutes))
+	lw.line("END:VALARM")
+}
+
+// formatDateTime renders an event time as a property line. Timed events
+// are written in UTC unless local times were asked for and their zone has
+// a VTIMEZONE; all-day events as VALUE=DATE.
+func (enc *encoder) formatDateTime(name string, dt *calendar.EventDateTime) (string, error) {
+	if dt == nil {
+		return "", fmt.Errorf("missing %s", name)
+	}
+	if dt.Date != "" {
+		date, err := time.Parse("2006-01-02", dt.Date)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %v", name, err)
+		}
+		return name + ";VALUE=DATE:" + date.Format(dateLayout), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, dt.DateTime)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %v", name, err)
+	}
+	if zone := enc.zones[eventZone(dt, enc.opts.TimeZone)]; zone != nil {
+		return name + ";TZID=" + zone.name + ":" + t.In(zone.loc).Format(localLayout), nil
+	}
+	return name + ":" + t.UTC().Format(utcLayout), nil
+}
+
+func cnParam(name string) string {
+	if name == "" {
+		return ""
+	}
+	return `;CN="` + strings.ReplaceAll(name, `"`, "'") + `"`
+}
+
+// partStat maps Google response statuses onto iCalendar PARTSTAT values
+func partStat(status string) string {
+	switch status {
+	case "accepted":
+		return "ACCEPTED"
+	case "declined":
+		return "DECLINED"
+	case "tentative":
+		return "TENTATIVE"
+	}
+	return "NEEDS-ACTION"
+}
+
+func responseStatus(partStat string) string {
+	switch strings.ToUpper(partStat) {
+	case "ACCEPTED":
+		return "accepted"
+	case "DECLINED":
+		return "declined"
+	case "TENTATIVE":
+		return "tentative"
+	}
+	return "needsAction"
+}
+
+func escapeText(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// lineWriter writes CRLF-terminated content lines, folding them at 75
+// octets as RFC 5545 requires
+type lineWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (lw *lineWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > maxLineOctets {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	_, lw.err = io.WriteString(lw.w, b.String())
+}
+
+// property is a parsed content line
+type property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// SkippedEvent is a VEVENT DecodeLenient left out because it couldn't be
+// read, e.g. for a time in a zone it doesn't know
+type SkippedEvent struct {
+	UID     string
+	Summary string
+	// Line is where the VEVENT begins
+	Line int
+	Err  error
+}
+
+// Decode parses every VEVENT in an iCalendar stream. Event IDs are left
+// empty; the UID is returned in ICalUID. Any VEVENT that can't be read
+// fails the whole stream.
+func Decode(r io.Reader) ([]*calendar.Event, error) {
+	events, skipped, err := DecodeLenient(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		return nil, skipped[0].Err
+	}
+	return events, nil
+}
+
+// DecodeLenient is Decode that leaves out the VEVENTs it can't read and
+// reports them, so one bad event doesn't lose the rest. A malformed stream
+// still fails as a whole.
+func DecodeLenient(r io.Reader) ([]*calendar.Event, []SkippedEvent, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	zones := &zoneResolver{defined: parseTimeZones(lines)}
+
+	var events []*calendar.Event
+	var skipped []SkippedEvent
+	var current *calendar.Event
+	// begin is the line of the current VEVENT and eventErr the first
+	// error reading it
+	var begin int
+	var eventErr error
+	// alarm collects the VALARM being read, if any
+	var alarm *calendar.EventReminder
+	depth := 0
+	for n, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VEVENT"):
+			current = &calendar.Event{Status: "confirmed"}
+			begin, eventErr = n+1, nil
+			depth = 0
+		case current == nil:
+			continue
+		case prop.Name == "BEGIN":
+			// Nested components; only VALARMs are read
+			if depth == 0 && strings.EqualFold(prop.Value, "VALARM") {
+				alarm = &calendar.EventReminder{Method: "popup", Minutes: -1}
+			}
+			depth++
+		case prop.Name == "END" && depth > 0:
+			depth--
+			if depth == 0 && alarm != nil {
+				addReminder(current, alarm)
+				alarm = nil
+			}
+		case depth == 1 && alarm != nil:
+			applyAlarmProperty(alarm, prop)
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VEVENT"):
+			if eventErr == nil && current.Start == nil {
+				eventErr = fmt.Errorf("line %d: VEVENT without DTSTART", n+1)
+			}
+			if eventErr != nil {
+				skipped = append(skipped, SkippedEvent{UID: current.ICalUID, Summary: current.Summary, Line: begin, Err: eventErr})
+				current = nil
+				continue
+			}
+			if current.End == nil {
+				current.End = defaultEnd(current.Start)
+			}
+			events = append(events, current)
+			current = nil
+		case depth == 0:
+			// Keep reading after an error so the skipped event can be
+			// reported by UID and summary
+			if err := applyProperty(current, prop, line, zones); err != nil && eventErr == nil {
+				eventErr = fmt.Errorf("line %d: %v", n+1, err)
+			}
+		}
+	}
+
+	if current != nil {
+		return nil, nil, fmt.Errorf("unterminated VEVENT")
+	}
+	return events, skipped, nil
+}
+
+// applyAlarmProperty reads the action and trigger of a VALARM. Triggers
+// other than a time before the start leave Minutes at -1.
+func applyAlarmProperty(alarm *calendar.EventReminder, prop property) {
+	switch prop.Name {
+	case "ACTION":
+		if strings.EqualFold(prop.Value, "EMAIL") {
+			alarm.Method = "email"
+		}
+	case "TRIGGER":
+		if prop.Params["VALUE"] != "" || (prop.Params["RELATED"] != "" && !strings.EqualFold(prop.Params["RELATED"], "START")) {
+			return
+		}
+		before := strings.HasPrefix(prop.Value, "-")
+		d, days, err := parseDuration(strings.TrimPrefix(prop.Value, "-"))
+		if err != nil || (!before && (d != 0 || days != 0)) {
+			return
+		}
+		alarm.Minutes = int64(days)*24*60 + int64(d/time.Minute)
+	}
+}
+
+// addReminder adds a VALARM that was read to the event's reminders
+func addReminder(event *calendar.Event, alarm *calendar.EventReminder) {
+	if alarm.Minutes < 0 {
+		return
+	}
+	if event.Reminders == nil {
+		event.Reminders = &calendar.EventReminders{ForceSendFields: []string{"UseDefault"}}
+	}
+	event.Reminders.Overrides = append(event.Reminders.Overrides, alarm)
+}
+
+func applyProperty(event *calendar.Event, prop property, raw string, zones *zoneResolver) error {
+	var err error
+	switch prop.Name {
+	case "UID":
+		event.ICalUID = prop.Value
+	case "SUMMARY":
+		event.Summary = unescapeText(prop.Value)
+	case "DESCRIPTION":
+		event.Description = unescapeText(prop.Value)
+	case "LOCATION":
+		event.Location = unescapeText(prop.Value)
+	case "URL":
+		event.HtmlLink = prop.Value
+	case "DTSTART":
+		event.Start, err = parseDateTime(prop, zones)
+	case "DTEND":
+		event.End, err = parseDateTime(prop, zones)
+	case "DURATION":
+		if event.Start != nil {
+			event.End, err = addDuration(event.Start, prop.Value)
+		}
+	case "RECURRENCE-ID":
+		event.OriginalStartTime, err = parseDateTime(prop, zones)
+	case "STATUS":
+		switch strings.ToUpper(prop.Value) {
+		case "CANCELLED":
+			event.Status = "cancelled"
+		case "TENTATIVE":
+			event.Status = "tentative"
+		}
+	case "TRANSP":
+		if strings.EqualFold(prop.Value, "TRANSPARENT") {
+			event.Transparency = "transparent"
+		}
+	case "ORGANIZER":
+		event.Organizer = &calendar.EventOrganizer{
+			Email:       trimMailto(prop.Value),
+			DisplayName: prop.Params["CN"],
+		}
+	case "ATTENDEE":
+		event.Attendees = append(event.Attendees, &calendar.EventAttendee{
+			Email:          trimMailto(prop.Value),
+			DisplayName:    prop.Params["CN"],
+			Optional:       strings.EqualFold(prop.Params["ROLE"], "OPT-PARTICIPANT"),
+			ResponseStatus: responseStatus(prop.Params["PARTSTAT"]),
+		})
+	case "RRULE", "EXRULE":
+		// Google takes recurrence lines verbatim
+		event.Recurrence = append(event.Recurrence, raw)
+	case "RDATE", "EXDATE":
+		var line string
+		if line, err = zones.normalizeRecurrence(prop, raw); err == nil {
+			event.Recurrence = append(event.Recurrence, line)
+		}
+	}
+	return err
+}
+
+// parseDateTime reads a DTSTART-style property into an event time. TZIDs
+// are resolved by zones.
+func parseDateTime(prop property, zones *zoneResolver) (*calendar.EventDateTime, error) {
+	value := prop.Value
+	if strings.EqualFold(prop.Params["VALUE"], "DATE") || len(value) == len(dateLayout) {
+		date, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", prop.Name, err)
+		}
+		return &calendar.EventDateTime{Date: date.Format("2006-01-02")}, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(utcLayout, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", prop.Name, err)
+		}
+		return &calendar.EventDateTime{DateTime: t.Format(time.RFC3339), TimeZone: "UTC"}, nil
+	}
+
+	// Local time in the given zone, or floating (treated as UTC)
+	t, err := time.Parse(localLayout, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", prop.Name, err)
+	}
+	tzid := prop.Params["TZID"]
+	if tzid == "" {
+		return &calendar.EventDateTime{DateTime: t.Format(time.RFC3339)}, nil
+	}
+
+	loc, name, err := zones.resolve(tzid, t)
+	if err != nil {
+		return nil, err
+	}
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+	return &calendar.EventDateTime{DateTime: t.Format(time.RFC3339), TimeZone: name}, nil
+}
+
+// defaultEnd applies RFC 5545's rule for events without DTEND: all-day
+// events last one day, timed events are instantaneous
+func defaultEnd(start *calendar.EventDateTime) *calendar.EventDateTime {
+	if start.Date != "" {
+		date, _ := time.Parse("2006-01-02", start.Date)
+		return &calendar.EventDateTime{Date: date.AddDate(0, 0, 1).Format("2006-01-02")}
+	}
+	end := *start
+	return &end
+}
+
+// addDuration computes DTEND from DTSTART and an RFC 5545 DURATION such as PT1H30M
+func addDuration(start *calendar.EventDateTime, value string) (*calendar.EventDateTime, error) {
+	d, days, err := parseDuration(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if start.Date != "" {
+		date, err := time.Parse("2006-01-02", start.Date)
+		if err != nil {
+			return nil, err
+		}
+		return &calendar.EventDateTime{Date: date.AddDate(0, 0, days).Format("2006-01-02")}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, start.DateTime)
+	if err != nil {
+		return nil, err
+	}
+	return &calendar.EventDateTime{
+		DateTime: t.AddDate(0, 0, days).Add(d).Format(time.RFC3339),
+		TimeZone: start.TimeZone,
+	}, nil
+}
+
+func parseDuration(value string) (time.Duration, int, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P")
+	if s == value || strings.HasPrefix(value, "-") {
+		return 0, 0, fmt.Errorf("invalid DURATION %q", value)
+	}
+
+	var d time.Duration
+	days := 0
+	inTime := false
+	num := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			num = num*10 + int(r-'0')
+			continue
+		case r == 'T':
+			inTime = true
+		case r == 'W':
+			days += num * 7
+		case r == 'D':
+			days += num
+		case r == 'H' && inTime:
+			d += time.Duration(num) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(num) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(num) * time.Second
+		default:
+			return 0, 0, fmt.Errorf("invalid DURATION %q", value)
+		}
+		num = 0
+	}
+	return d, days, nil
+}
+
+func trimMailto(value string) string {
+	if strings.HasPrefix(strings.ToLower(value), mailtoPrefix) {
+		return value[len(mailtoPrefix):]
+	}
+	return value
+}
+
+// unfold joins folded content lines
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine splits a content line into name, parameters and value,
+// honouring quoted parameter values
+func parseLine(line string) (property, error) {
+	prop := property{Params: map[string]string{}}
+
+	inQuotes := false
+	valueStart := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		}
+		if r == ':' && !inQuotes {
+			valueStart = i
+			break
+		}
+	}
+	if valueStart < 0 {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+
+	prop.Value = line[valueStart+1:]
+	parts := splitParams(line[:valueStart])
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+func splitParams(s string) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ';' && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
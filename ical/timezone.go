@@ -0,0 +1,188 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// recurringZoneYears is how many years past the last listed event the
+// VTIMEZONE of a recurring event covers, since its series goes on
+const recurringZoneYears = 5
+
+// zoneSpan is a time zone used by the events being written, and the
+// period its VTIMEZONE has to cover
+type zoneSpan struct {
+	name     string
+	loc      *time.Location
+	from, to time.Time
+	recurs   bool
+}
+
+func (z *zoneSpan) include(t time.Time) {
+	if z.from.IsZero() || t.Before(z.from) {
+		z.from = t
+	}
+	if z.to.IsZero() || t.After(z.to) {
+		z.to = t
+	}
+}
+
+// eventZone is the zone an event time is written in
+func eventZone(dt *calendar.EventDateTime, fallback string) string {
+	if dt.TimeZone != "" {
+		return dt.TimeZone
+	}
+	return fallback
+}
+
+// usedZones collects the zones of the timed events, leaving out UTC and
+// names Go doesn't know. Zones named in recurrence lines are included so
+// their TZIDs can be resolved.
+func usedZones(events []*calendar.Event, fallback string) map[string]*zoneSpan {
+	zones := map[string]*zoneSpan{}
+	use := func(name string, t time.Time, recurs bool) {
+		if name == "" || name == "UTC" {
+			return
+		}
+		zone, ok := zones[name]
+		if !ok {
+			loc, err := time.LoadLocation(name)
+			if err != nil || name == "Local" {
+				return
+			}
+			zone = &zoneSpan{name: name, loc: loc}
+			zones[name] = zone
+		}
+		zone.include(t)
+		zone.recurs = zone.recurs || recurs
+	}
+
+	for _, event := range events {
+		recurs := len(event.Recurrence) > 0
+		var start time.Time
+		for _, dt := range []*calendar.EventDateTime{event.Start, event.End, event.OriginalStartTime} {
+			if dt == nil || dt.DateTime == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, dt.DateTime)
+			if err != nil {
+				continue
+			}
+			if start.IsZero() {
+				start = t
+			}
+			use(eventZone(dt, fallback), t, recurs)
+		}
+
+		for _, line := range event.Recurrence {
+			prop, err := parseLine(line)
+			if err == nil && prop.Params["TZID"] != "" && !start.IsZero() {
+				use(prop.Params["TZID"], start, recurs)
+			}
+		}
+	}
+	return zones
+}
+
+func sortedZoneNames(zones map[string]*zoneSpan) []string {
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeTimeZone writes a VTIMEZONE listing every offset change of the zone
+// from the start of the first year it is used in to the end of the last
+func writeTimeZone(lw *lineWriter, zone *zoneSpan) {
+	endYear := zone.to.Year() + 1
+	if zone.recurs {
+		endYear += recurringZoneYears
+	}
+	start := time.Date(zone.from.Year(), 1, 1, 0, 0, 0, 0, zone.loc)
+	end := time.Date(endYear, 1, 1, 0, 0, 0, 0, zone.loc)
+
+	lw.line("BEGIN:VTIMEZONE")
+	lw.line("TZID:" + zone.name)
+
+	// The offset in force at the start, then each change
+	_, offset := start.Zone()
+	writeObservance(lw, zone.loc, start, offset)
+	for _, transition := range zoneTransitions(zone.loc, start, end) {
+		_, before := transition.Add(-time.Second).In(zone.loc).Zone()
+		writeObservance(lw, zone.loc, transition, before)
+	}
+
+	lw.line("END:VTIMEZONE")
+}
+
+// writeObservance writes the STANDARD or DAYLIGHT component for the offset
+// that takes effect at the given time, replacing offsetFrom
+func writeObservance(lw *lineWriter, loc *time.Location, at time.Time, offsetFrom int) {
+	local := at.In(loc)
+	name, offsetTo := local.Zone()
+
+	kind := "STANDARD"
+	if local.IsDST() {
+		kind = "DAYLIGHT"
+	}
+
+	lw.line("BEGIN:" + kind)
+	// The onset is given in the local time of the offset being replaced
+	lw.line("DTSTART:" + at.UTC().Add(time.Duration(offsetFrom)*time.Second).Format(localLayout))
+	lw.line("TZOFFSETFROM:" + formatOffset(offsetFrom))
+	lw.line("TZOFFSETTO:" + formatOffset(offsetTo))
+	if name != "" {
+		lw.line("TZNAME:" + escapeText(name))
+	}
+	lw.line("END:" + kind)
+}
+
+// zoneTransitions finds the instants in [start, end) at which the zone's
+// offset changes
+func zoneTransitions(loc *time.Location, start, end time.Time) []time.Time {
+	const step = 12 * time.Hour
+
+	var transitions []time.Time
+	_, prev := start.In(loc).Zone()
+	for t := start; t.Before(end); t = t.Add(step) {
+		next := t.Add(step)
+		_, offset := next.In(loc).Zone()
+		if offset == prev {
+			continue
+		}
+
+		// Narrow the change down to the second
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+			if _, o := mid.In(loc).Zone(); o == prev {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		transitions = append(transitions, hi)
+		prev = offset
+	}
+	return transitions
+}
+
+// formatOffset writes a UTC offset in seconds as ±HHMM, or ±HHMMSS when
+// it isn't a whole number of minutes
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	formatted := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		formatted += fmt.Sprintf("%02d", seconds%60)
+	}
+	return formatted
+}
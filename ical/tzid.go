@@ -0,0 +1,420 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// windowsZones maps the Windows time zone names Outlook and Exchange use
+// as TZIDs to IANA zones (CLDR windowsZones, territory 001)
+var windowsZones = map[string]string{
+	"Dateline Standard Time":          "Etc/GMT+12",
+	"UTC-11":                          "Etc/GMT+11",
+	"Aleutian Standard Time":          "America/Adak",
+	"Hawaiian Standard Time":          "Pacific/Honolulu",
+	"Marquesas Standard Time":         "Pacific/Marquesas",
+	"Alaskan Standard Time":           "America/Anchorage",
+	"UTC-09":                          "Etc/GMT+9",
+	"Pacific Standard Time (Mexico)":  "America/Tijuana",
+	"UTC-08":                          "Etc/GMT+8",
+	"Pacific Standard Time":           "America/Los_Angeles",
+	"US Mountain Standard Time":       "America/Phoenix",
+	"Mountain Standard Time (Mexico)": "America/Mazatlan",
+	"Mountain Standard Time":          "America/Denver",
+	"Yukon Standard Time":             "America/Whitehorse",
+	"Central America Standard Time":   "America/Guatemala",
+	"Central Standard Time":           "America/Chicago",
+	"Easter Island Standard Time":     "Pacific/Easter",
+	"Central Standard Time (Mexico)":  "America/Mexico_City",
+	"Canada Central Standard Time":    "America/Regina",
+	"SA Pacific Standard Time":        "America/Bogota",
+	"Eastern Standard Time (Mexico)":  "America/Cancun",
+	"Eastern Standard Time":           "America/New_York",
+	"Haiti Standard Time":             "America/Port-au-Prince",
+	"Cuba Standard Time":              "America/Havana",
+	"US Eastern Standard Time":        "America/Indiana/Indianapolis",
+	"Turks And Caicos Standard Time":  "America/Grand_Turk",
+	"Paraguay Standard Time":          "America/Asuncion",
+	"Atlantic Standard Time":          "America/Halifax",
+	"Venezuela Standard Time":         "America/Caracas",
+	"Central Brazilian Standard Time": "America/Cuiaba",
+	"SA Western Standard Time":        "America/La_Paz",
+	"Pacific SA Standard Time":        "America/Santiago",
+	"Newfoundland Standard Time":      "America/St_Johns",
+	"Tocantins Standard Time":         "America/Araguaina",
+	"E. South America Standard Time":  "America/Sao_Paulo",
+	"SA Eastern Standard Time":        "America/Cayenne",
+	"Argentina Standard Time":         "America/Argentina/Buenos_Aires",
+	"Greenland Standard Time":         "America/Nuuk",
+	"Montevideo Standard Time":        "America/Montevideo",
+	"Magallanes Standard Time":        "America/Punta_Arenas",
+	"Saint Pierre Standard Time":      "America/Miquelon",
+	"Bahia Standard Time":             "America/Bahia",
+	"UTC-02":                          "Etc/GMT+2",
+	"Azores Standard Time":            "Atlantic/Azores",
+	"Cape Verde Standard Time":        "Atlantic/Cape_Verde",
+	"Coordinated Universal Time":      "Etc/UTC",
+	"GMT Standard Time":               "Europe/London",
+	"Greenwich Standard Time":         "Atlantic/Reykjavik",
+	"Sao Tome Standard Time":          "Africa/Sao_Tome",
+	"Morocco Standard Time":           "Africa/Casablanca",
+	"W. Europe Standard Time":         "Europe/Berlin",
+	"Central Europe Standard Time":    "Europe/Budapest",
+	"Romance Standard Time":           "Europe/Paris",
+	"Central European Standard Time":  "Europe/Warsaw",
+	"W. Central Africa Standard Time": "Africa/Lagos",
+	"Jordan Standard Time":            "Asia/Amman",
+	"GTB Standard Time":               "Europe/Bucharest",
+	"Middle East Standard Time":       "Asia/Beirut",
+	"Egypt Standard Time":             "Africa/Cairo",
+	"E. Europe Standard Time":         "Europe/Chisinau",
+	"Syria Standard Time":             "Asia/Damascus",
+	"West Bank Standard Time":         "Asia/Hebron",
+	"South Africa Standard Time":      "Africa/Johannesburg",
+	"FLE Standard Time":               "Europe/Kiev",
+	"Israel Standard Time":            "Asia/Jerusalem",
+	"South Sudan Standard Time":       "Africa/Juba",
+	"Kaliningrad Standard Time":       "Europe/Kaliningrad",
+	"Sudan Standard Time":             "Africa/Khartoum",
+	"Libya Standard Time":             "Africa/Tripoli",
+	"Namibia Standard Time":           "Africa/Windhoek",
+	"Arabic Standard Time":            "Asia/Baghdad",
+	"Turkey Standard Time":            "Europe/Istanbul",
+	"Arab Standard Time":              "Asia/Riyadh",
+	"Belarus Standard Time":           "Europe/Minsk",
+	"Russian Standard Time":           "Europe/Moscow",
+	"E. Africa Standard Time":         "Africa/Nairobi",
+	"Volgograd Standard Time":         "Europe/Volgograd",
+	"Iran Standard Time":              "Asia/Tehran",
+	"Arabian Standard Time":           "Asia/Dubai",
+	"Astrakhan Standard Time":         "Europe/Astrakhan",
+	"Azerbaijan Standard Time":        "Asia/Baku",
+	"Russia Time Zone 3":              "Europe/Samara",
+	"Mauritius Standard Time":         "Indian/Mauritius",
+	"Saratov Standard Time":           "Europe/Saratov",
+	"Georgian Standard Time":          "Asia/Tbilisi",
+	"Caucasus Standard Time":          "Asia/Yerevan",
+	"Afghanistan Standard Time":       "Asia/Kabul",
+	"West Asia Standard Time":         "Asia/Tashkent",
+	"Ekaterinburg Standard Time":      "Asia/Yekaterinburg",
+	"Pakistan Standard Time":          "Asia/Karachi",
+	"Qyzylorda Standard Time":         "Asia/Qyzylorda",
+	"India Standard Time":             "Asia/Kolkata",
+	"Sri Lanka Standard Time":         "Asia/Colombo",
+	"Nepal Standard Time":             "Asia/Kathmandu",
+	"Central Asia Standard Time":      "Asia/Almaty",
+	"Bangladesh Standard Time":        "Asia/Dhaka",
+	"Omsk Standard Time":              "Asia/Omsk",
+	"Myanmar Standard Time":           "Asia/Yangon",
+	"SE Asia Standard Time":           "Asia/Bangkok",
+	"Altai Standard Time":             "Asia/Barnaul",
+	"W. Mongolia Standard Time":       "Asia/Hovd",
+	"North Asia Standard Time":        "Asia/Krasnoyarsk",
+	"N. Central Asia Standard Time":   "Asia/Novosibirsk",
+	"Tomsk Standard Time":             "Asia/Tomsk",
+	"China Standard Time":             "Asia/Shanghai",
+	"North Asia East Standard Time":   "Asia/Irkutsk",
+	"Singapore Standard Time":         "Asia/Singapore",
+	"W. Australia Standard Time":      "Australia/Perth",
+	"Taipei Standard Time":            "Asia/Taipei",
+	"Ulaanbaatar Standard Time":       "Asia/Ulaanbaatar",
+	"Aus Central W. Standard Time":    "Australia/Eucla",
+	"Transbaikal Standard Time":       "Asia/Chita",
+	"Tokyo Standard Time":             "Asia/Tokyo",
+	"North Korea Standard Time":       "Asia/Pyongyang",
+	"Korea Standard Time":             "Asia/Seoul",
+	"Yakutsk Standard Time":           "Asia/Yakutsk",
+	"Cen. Australia Standard Time":    "Australia/Adelaide",
+	"AUS Central Standard Time":       "Australia/Darwin",
+	"E. Australia Standard Time":      "Australia/Brisbane",
+	"AUS Eastern Standard Time":       "Australia/Sydney",
+	"West Pacific Standard Time":      "Pacific/Port_Moresby",
+	"Tasmania Standard Time":          "Australia/Hobart",
+	"Vladivostok Standard Time":       "Asia/Vladivostok",
+	"Lord Howe Standard Time":         "Australia/Lord_Howe",
+	"Bougainville Standard Time":      "Pacific/Bougainville",
+	"Russia Time Zone 10":             "Asia/Srednekolymsk",
+	"Magadan Standard Time":           "Asia/Magadan",
+	"Norfolk Standard Time":           "Pacific/Norfolk",
+	"Sakhalin Standard Time":          "Asia/Sakhalin",
+	"Central Pacific Standard Time":   "Pacific/Guadalcanal",
+	"Russia Time Zone 11":             "Asia/Kamchatka",
+	"New Zealand Standard Time":       "Pacific/Auckland",
+	"UTC+12":                          "Etc/GMT-12",
+	"Fiji Standard Time":              "Pacific/Fiji",
+	"Chatham Islands Standard Time":   "Pacific/Chatham",
+	"UTC+13":                          "Etc/GMT-13",
+	"Tonga Standard Time":             "Pacific/Tongatapu",
+	"Samoa Standard Time":             "Pacific/Apia",
+	"Line Islands Standard Time":      "Pacific/Kiritimati",
+}
+
+// observance is a STANDARD or DAYLIGHT component of a VTIMEZONE. Onsets
+// are local wall-clock times, kept in UTC so they compare as such.
+type observance struct {
+	start      time.Time
+	offsetFrom int
+	offsetTo   int
+	rule       *rrule.ROption
+	rdates     []time.Time
+}
+
+// lastOnset returns the latest onset at or before the wall-clock time
+func (o *observance) lastOnset(wall time.Time) (time.Time, bool) {
+	var last time.Time
+	found := false
+	consider := func(t time.Time) {
+		if !t.After(wall) && (!found || t.After(last)) {
+			last, found = t, true
+		}
+	}
+
+	consider(o.start)
+	if o.rule != nil {
+		opts := *o.rule
+		opts.Dtstart = o.start
+		// rrule-go stops about 290 years after DTSTART and zones often
+		// start in 1601, so begin shortly before the time asked for
+		if opts.Count == 0 && wall.Year()-2 > o.start.Year() {
+			opts.Dtstart = time.Date(wall.Year()-2, o.start.Month(), o.start.Day(), o.start.Hour(), o.start.Minute(), o.start.Second(), 0, time.UTC)
+		}
+		if rule, err := rrule.NewRRule(opts); err == nil {
+			if t := rule.Before(wall, true); !t.IsZero() {
+				consider(t)
+			}
+		}
+	}
+	for _, t := range o.rdates {
+		consider(t)
+	}
+	return last, found
+}
+
+// vtimezone is a time zone defined in the file being read
+type vtimezone struct {
+	// location is the IANA name some writers add as X-LIC-LOCATION
+	location    string
+	observances []*observance
+}
+
+// offsetAt returns the UTC offset in seconds in force at a wall-clock time
+func (z *vtimezone) offsetAt(wall time.Time) (int, bool) {
+	if len(z.observances) == 0 {
+		return 0, false
+	}
+
+	var latest time.Time
+	offset, found := 0, false
+	for _, o := range z.observances {
+		if onset, ok := o.lastOnset(wall); ok && (!found || onset.After(latest)) {
+			latest, offset, found = onset, o.offsetTo, true
+		}
+	}
+	if found {
+		return offset, true
+	}
+
+	// Before the first onset the offset it replaces applies
+	first := z.observances[0]
+	for _, o := range z.observances[1:] {
+		if o.start.Before(first.start) {
+			first = o
+		}
+	}
+	return first.offsetFrom, true
+}
+
+// zoneResolver turns TZIDs into locations: IANA names as they are, then
+// Windows names, then the VTIMEZONEs of the file
+type zoneResolver struct {
+	defined map[string]*vtimezone
+}
+
+// ianaName returns the IANA zone a TZID stands for, if there is one
+func (z *zoneResolver) ianaName(tzid string) (string, bool) {
+	if _, err := time.LoadLocation(tzid); err == nil && tzid != "Local" {
+		return tzid, true
+	}
+	if name, ok := windowsZones[tzid]; ok {
+		return name, true
+	}
+	// Some writers prefix the zone, e.g. /mozilla.org/20050126_1/Europe/Berlin
+	parts := strings.Split(strings.Trim(tzid, "/"), "/")
+	for i := 1; i < len(parts)-1; i++ {
+		suffix := strings.Join(parts[i:], "/")
+		if _, err := time.LoadLocation(suffix); err == nil {
+			return suffix, true
+		}
+	}
+	if defined, ok := z.defined[tzid]; ok && defined.location != "" {
+		if _, err := time.LoadLocation(defined.location); err == nil {
+			return defined.location, true
+		}
+	}
+	return "", false
+}
+
+// resolve returns the location of a wall-clock time in the zone, and the
+// IANA name to store with it. Zones only known from a VTIMEZONE resolve
+// to the fixed offset in force at that time, without a name.
+func (z *zoneResolver) resolve(tzid string, wall time.Time) (*time.Location, string, error) {
+	if name, ok := z.ianaName(tzid); ok {
+		loc, err := time.LoadLocation(name)
+		return loc, name, err
+	}
+	if defined, ok := z.defined[tzid]; ok {
+		if offset, ok := defined.offsetAt(wall); ok {
+			return time.FixedZone(tzid, offset), "", nil
+		}
+	}
+	return nil, "", fmt.Errorf("unknown TZID %q", tzid)
+}
+
+// parseTimeZones reads the VTIMEZONE components of an unfolded stream.
+// Components it can't make sense of are left out.
+func parseTimeZones(lines []string) map[string]*vtimezone {
+	zones := map[string]*vtimezone{}
+
+	var zone *vtimezone
+	var tzid string
+	var current *observance
+	for _, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VTIMEZONE"):
+			zone, tzid = &vtimezone{}, ""
+		case zone == nil:
+			continue
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VTIMEZONE"):
+			if tzid != "" {
+				zones[tzid] = zone
+			}
+			zone = nil
+		case prop.Name == "BEGIN" && (strings.EqualFold(prop.Value, "STANDARD") || strings.EqualFold(prop.Value, "DAYLIGHT")):
+			current = &observance{}
+		case prop.Name == "END" && current != nil:
+			if !current.start.IsZero() {
+				zone.observances = append(zone.observances, current)
+			}
+			current = nil
+		case current != nil:
+			applyObservanceProperty(current, prop)
+		case prop.Name == "TZID":
+			tzid = prop.Value
+		case prop.Name == "X-LIC-LOCATION":
+			zone.location = prop.Value
+		}
+	}
+	return zones
+}
+
+func applyObservanceProperty(o *observance, prop property) {
+	switch prop.Name {
+	case "DTSTART":
+		if t, err := time.Parse(localLayout, strings.TrimSuffix(prop.Value, "Z")); err == nil {
+			o.start = t
+		}
+	case "TZOFFSETFROM":
+		if offset, err := parseOffset(prop.Value); err == nil {
+			o.offsetFrom = offset
+		}
+	case "TZOFFSETTO":
+		if offset, err := parseOffset(prop.Value); err == nil {
+			o.offsetTo = offset
+		}
+	case "RRULE":
+		if rule, err := rrule.StrToROption(prop.Value); err == nil {
+			o.rule = rule
+		}
+	case "RDATE":
+		for _, value := range strings.Split(prop.Value, ",") {
+			if t, err := time.Parse(localLayout, strings.TrimSuffix(value, "Z")); err == nil {
+				o.rdates = append(o.rdates, t)
+			}
+		}
+	}
+}
+
+// parseOffset reads a UTC offset written as ±HHMM or ±HHMMSS
+func parseOffset(value string) (int, error) {
+	if len(value) != 5 && len(value) != 7 || (value[0] != '+' && value[0] != '-') {
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+	digits, err := strconv.Atoi(value[1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid UTC offset %q", value)
+	}
+	if len(value) == 5 {
+		digits *= 100
+	}
+	seconds := digits/10000*3600 + digits/100%100*60 + digits%100
+	if value[0] == '-' {
+		seconds = -seconds
+	}
+	return seconds, nil
+}
+
+// normalizeRecurrence rewrites an RDATE or EXDATE whose TZID isn't an
+// IANA name, so providers and rrule can read it: known zones get their
+// IANA name, zones only defined in the file are converted to UTC
+func (z *zoneResolver) normalizeRecurrence(prop property, raw string) (string, error) {
+	tzid := prop.Params["TZID"]
+	if tzid == "" {
+		return raw, nil
+	}
+	if _, err := time.LoadLocation(tzid); err == nil && tzid != "Local" {
+		return raw, nil
+	}
+
+	if name, ok := z.ianaName(tzid); ok {
+		prop.Params["TZID"] = name
+		return formatProperty(prop), nil
+	}
+
+	values := strings.Split(prop.Value, ",")
+	for i, value := range values {
+		wall, err := time.Parse(localLayout, value)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %v", prop.Name, err)
+		}
+		loc, _, err := z.resolve(tzid, wall)
+		if err != nil {
+			return "", err
+		}
+		local := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+		values[i] = local.UTC().Format(utcLayout)
+	}
+	delete(prop.Params, "TZID")
+	prop.Value = strings.Join(values, ",")
+	return formatProperty(prop), nil
+}
+
+// formatProperty writes a property back as a content line
+func formatProperty(prop property) string {
+	keys := make([]string, 0, len(prop.Params))
+	for key := range prop.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(prop.Name)
+	for _, key := range keys {
+		value := prop.Params[key]
+		if strings.ContainsAny(value, ":;,") {
+			value = `"` + value + `"`
+		}
+		b.WriteString(";" + key + "=" + value)
+	}
+	b.WriteString(":" + prop.Value)
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// vcalendar wraps content lines into a VCALENDAR stream
+func vcalendar(lines ...string) string {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//test//EN"}, lines...)
+	return strings.Join(append(all, "END:VCALENDAR", ""), "\r\n")
+}
+
+// customZone is an Outlook-style VTIMEZONE for Central European time
+var customZone = []string{
+	"BEGIN:VTIMEZONE",
+	"TZID:Office Time",
+	"BEGIN:STANDARD",
+	"DTSTART:16010101T030000",
+	"TZOFFSETFROM:+0200",
+	"TZOFFSETTO:+0100",
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10",
+	"END:STANDARD",
+	"BEGIN:DAYLIGHT",
+	"DTSTART:16010101T020000",
+	"TZOFFSETFROM:+0100",
+	"TZOFFSETTO:+0200",
+	"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3",
+	"END:DAYLIGHT",
+	"END:VTIMEZONE",
+}
+
+func event(uid, dtstart string, extra ...string) []string {
+	lines := []string{"BEGIN:VEVENT", "UID:" + uid, "SUMMARY:Event " + uid, dtstart, "DURATION:PT1H"}
+	return append(append(lines, extra...), "END:VEVENT")
+}
+
+func TestDecodeTimeZones(t *testing.T) {
+	tests := []struct {
+		name     string
+		dtstart  string
+		extra    []string
+		start    string
+		timeZone string
+	}{
+		{"IANA", "DTSTART;TZID=Europe/Berlin:20260715T090000", nil, "2026-07-15T09:00:00+02:00", "Europe/Berlin"},
+		{"Windows name", `DTSTART;TZID="W. Europe Standard Time":20260115T090000`, nil, "2026-01-15T09:00:00+01:00", "Europe/Berlin"},
+		{"Windows name, US", "DTSTART;TZID=Pacific Standard Time:20260715T090000", nil, "2026-07-15T09:00:00-07:00", "America/Los_Angeles"},
+		{"prefixed IANA", "DTSTART;TZID=/mozilla.org/20050126_1/America/New_York:20260115T090000", nil, "2026-01-15T09:00:00-05:00", "America/New_York"},
+		{"VTIMEZONE in winter", "DTSTART;TZID=Office Time:20260115T090000", nil, "2026-01-15T09:00:00+01:00", ""},
+		{"VTIMEZONE in summer", "DTSTART;TZID=Office Time:20260715T090000", nil, "2026-07-15T09:00:00+02:00", ""},
+		{"VTIMEZONE after the change", "DTSTART;TZID=Office Time:20261025T090000", nil, "2026-10-25T09:00:00+01:00", ""},
+		{"UTC", "DTSTART:20260715T090000Z", nil, "2026-07-15T09:00:00Z", "UTC"},
+		{"floating", "DTSTART:20260715T090000", nil, "2026-07-15T09:00:00Z", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := append(append([]string{}, customZone...), event("a", tt.dtstart, tt.extra...)...)
+			events, err := Decode(strings.NewReader(vcalendar(lines...)))
+			if err != nil {
+				t.Fatalf("Decode() = %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			start := events[0].Start
+			if start.DateTime != tt.start || start.TimeZone != tt.timeZone {
+				t.Errorf("start = %s in %q, want %s in %q", start.DateTime, start.TimeZone, tt.start, tt.timeZone)
+			}
+		})
+	}
+}
+
+func TestDecodeRecurrenceTimeZones(t *testing.T) {
+	tests := []struct {
+		name   string
+		exdate string
+		want   string
+	}{
+		{"IANA kept", "EXDATE;TZID=Europe/Berlin:20260722T090000", "EXDATE;TZID=Europe/Berlin:20260722T090000"},
+		{"Windows name mapped", "EXDATE;TZID=W. Europe Standard Time:20260722T090000", "EXDATE;TZID=Europe/Berlin:20260722T090000"},
+		{"VTIMEZONE in UTC", "EXDATE;TZID=Office Time:20260722T090000,20261223T090000", "EXDATE:20260722T070000Z,20261223T080000Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := append(append([]string{}, customZone...),
+				event("a", "DTSTART;TZID=Europe/Berlin:20260715T090000", "RRULE:FREQ=WEEKLY", tt.exdate)...)
+			events, err := Decode(strings.NewReader(vcalendar(lines...)))
+			if err != nil {
+				t.Fatalf("Decode() = %v", err)
+			}
+			recurrence := events[0].Recurrence
+			if len(recurrence) != 2 || recurrence[1] != tt.want {
+				t.Errorf("recurrence = %q, want RRULE and %q", recurrence, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLenientSkipsUnreadableEvents(t *testing.T) {
+	stream := vcalendar(append(append(
+		event("good", "DTSTART;TZID=Europe/Berlin:20260715T090000"),
+		event("bad-zone", "DTSTART;TZID=Atlantis Standard Time:20260715T090000")...),
+		"BEGIN:VEVENT", "UID:no-start", "SUMMARY:No start", "END:VEVENT")...)
+
+	events, skipped, err := DecodeLenient(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("DecodeLenient() = %v", err)
+	}
+	if len(events) != 1 || events[0].ICalUID != "good" {
+		t.Fatalf("got %d events, want only good", len(events))
+	}
+
+	want := map[string]string{"bad-zone": "Atlantis Standard Time", "no-start": "without DTSTART"}
+	if len(skipped) != len(want) {
+		t.Fatalf("skipped %d events, want %d", len(skipped), len(want))
+	}
+	for _, s := range skipped {
+		if !strings.Contains(s.Err.Error(), want[s.UID]) || s.Summary == "" || s.Line == 0 {
+			t.Errorf("skipped %+v, want error mentioning %q", s, want[s.UID])
+		}
+	}
+
+	// Decode keeps failing the whole stream
+	if _, err := Decode(strings.NewReader(stream)); err == nil {
+		t.Error("Decode() = nil, want an error")
+	}
+	// A malformed stream still fails as a whole
+	if _, _, err := DecodeLenient(strings.NewReader("BEGIN:VCALENDAR\r\nnot a content line\r\n")); err == nil {
+		t.Error("DecodeLenient() of a malformed stream = nil, want an error")
+	}
+}
+
+func TestWindowsZonesLoad(t *testing.T) {
+	for windows, iana := range windowsZones {
+		if _, err := time.LoadLocation(iana); err != nil {
+			t.Errorf("%s maps to %s: %v", windows, iana, err)
+		}
+	}
+}
@@ -13,10 +13,18 @@ import (
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
 	"github.com/markbates/goth/providers/google"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
 )
 
 var userRepo *db.UserRepository
 
+const (
+	// JWTIssuer and JWTAudience identify the session tokens minted by this service
+	JWTIssuer   = "goauthDemo"
+	JWTAudience = "goauthDemo-api"
+)
+
 const (
 	key    = "randomstring"
 	maxAge = 86400 * 30
@@ -38,9 +46,33 @@ func NewAuth() {
 	store.Options.Secure = isProd
 
 	gothic.Store = store
-	goth.UseProviders(
-		google.New(googleClientId, googleClientSecret, "http://localhost:8080/auth/google/callback", "email", "profile", "https://www.googleapis.com/auth/calendar.events"),
-	)
+	googleProvider := google.New(googleClientId, googleClientSecret, "http://localhost:8080/auth/google/callback", "email", "profile", "https://www.googleapis.com/auth/calendar.events", "https://www.googleapis.com/auth/calendar.freebusy", "https://www.googleapis.com/auth/calendar.settings.readonly", "https://www.googleapis.com/auth/calendar.calendarlist.readonly")
+	// Force the consent screen so Google always returns a refresh token
+	googleProvider.SetPrompt("consent")
+	goth.UseProviders(googleProvider)
+
+	// Same client credentials, used to refresh stored tokens outside of goth
+	oauthConfigs["google"] = &oauth2.Config{
+		ClientID:     googleClientId,
+		ClientSecret: googleClientSecret,
+		Endpoint:     endpoints.Google,
+	}
+
+	// Microsoft 365 sign-in is optional
+	microsoftClientId := os.Getenv("MICROSOFT_CLIENT_ID")
+	microsoftClientSecret := os.Getenv("MICROSOFT_CLIENT_SECRET")
+	if microsoftClientId != "" && microsoftClientSecret != "" {
+		// Signing in goes through BeginMicrosoftAuth, not goth, so the
+		// refresh token is kept
+		oauthConfigs[MicrosoftProvider] = &oauth2.Config{
+			ClientID:     microsoftClientId,
+			ClientSecret: microsoftClientSecret,
+			Endpoint:     endpoints.AzureAD("common"),
+			RedirectURL:  "http://localhost:8080/auth/microsoftonline/callback",
+			Scopes:       microsoftScopes,
+		}
+		log.Println("Microsoft sign-in enabled")
+	}
 
 	if db.DB == nil {
 		log.Fatal("Database not initialized")
@@ -49,8 +81,8 @@ func NewAuth() {
 	log.Println("Auth initialized successfully")
 }
 
-// SaveUserToDB saves the user details to the database
-func SaveUserToDB(user goth.User) error {
+// SaveUserToDB saves the user details to the database and returns the stored record
+func SaveUserToDB(user goth.User) (*models.User, error) {
 	// Calculate token expiry (if the provider doesn't provide it)
 	tokenExpiry := time.Now().Add(time.Hour)
 	if exp := user.ExpiresAt; !exp.IsZero() {
@@ -58,7 +90,7 @@ func SaveUserToDB(user goth.User) error {
 	}
 
 	dbUser := &models.User{
-		GoogleID:     user.UserID,
+		Provider:     user.Provider,
 		Email:        user.Email,
 		Name:         user.Name,
 		AccessToken:  user.AccessToken,
@@ -66,11 +98,21 @@ func SaveUserToDB(user goth.User) error {
 		TokenExpiry:  tokenExpiry,
 	}
 
-	return userRepo.CreateOrUpdateUser(dbUser)
+	if user.Provider == MicrosoftProvider {
+		dbUser.MicrosoftID = user.UserID
+	} else {
+		dbUser.GoogleID = user.UserID
+	}
+
+	if err := userRepo.CreateOrUpdateUser(dbUser); err != nil {
+		return nil, err
+	}
+	return dbUser, nil
 }
 
-// GenerateJWT generates a JWT token for authenticated users
-func GenerateJWT(userID, accessToken string) (string, error) {
+// GenerateJWT generates a JWT token for authenticated users. It only carries
+// our own user identity; Google credentials stay in the users table.
+func GenerateJWT(userID int) (string, error) {
 	jwtSecret := []byte(os.Getenv("SECRET_KEY"))
 	
 	if len(jwtSecret) == 0 {
@@ -79,10 +121,13 @@ func GenerateJWT(userID, accessToken string) (string, error) {
 		log.Printf("Using JWT secret key (length: %d)", len(jwtSecret))
 	}
 	
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id":      userID,
-		"access_token": accessToken,
-		"exp":          time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
+		"user_id": userID,
+		"iss":     JWTIssuer,
+		"aud":     JWTAudience,
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Hour * 24).Unix(), // Token expires in 24 hours
 	}
 	
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"goauthDemo/calendar"
+	db "goauthDemo/database"
+	"goauthDemo/models"
+
+	"golang.org/x/oauth2"
+)
+
+// oauthConfigs holds the client credentials of each sign-in provider, keyed
+// by goth provider name, used to refresh stored tokens outside of goth
+var oauthConfigs = map[string]*oauth2.Config{}
+
+// persistedTokenSource serves a user's OAuth token from the users table,
+// refreshing it through their provider's OAuth config once it expires and
+// writing the new token back so other requests pick it up
+type persistedTokenSource struct {
+	repo   *db.UserRepository
+	userID int
+}
+
+// NewUserTokenSource returns a token source for the given user that
+// refreshes the stored access token when needed
+func NewUserTokenSource(userID int) (oauth2.TokenSource, error) {
+	if userRepo == nil {
+		return nil, fmt.Errorf("auth not initialized")
+	}
+
+	// Reuse keeps the valid token in memory so the users table is only
+	// read again once it is about to expire
+	return oauth2.ReuseTokenSource(nil, &persistedTokenSource{
+		repo:   userRepo,
+		userID: userID,
+	}), nil
+}
+
+// Token returns a valid access token, refreshing and persisting it if expired
+func (s *persistedTokenSource) Token() (*oauth2.Token, error) {
+	user, err := s.repo.GetUserByID(s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load user tokens: %v", err)
+	}
+
+	current := &oauth2.Token{
+		AccessToken:  user.AccessToken,
+		RefreshToken: user.RefreshToken,
+		Expiry:       user.TokenExpiry,
+		TokenType:    "Bearer",
+	}
+	if current.Valid() {
+		return current, nil
+	}
+
+	// Users who signed in before refresh tokens were kept have to sign in
+	// again once the access token expires
+	if user.RefreshToken == "" {
+		return nil, fmt.Errorf("access token expired and no refresh token stored, please sign in again")
+	}
+
+	config, ok := oauthConfigs[user.Provider]
+	if !ok {
+		return nil, fmt.Errorf("no OAuth config for provider %q", user.Provider)
+	}
+
+	refreshed, err := config.TokenSource(context.Background(), current).Token()
+	if err != nil {
+		return nil, fmt.Errorf("unable to refresh access token: %v", err)
+	}
+
+	// Providers don't always rotate the refresh token
+	refreshToken := refreshed.RefreshToken
+	if refreshToken == "" {
+		refreshToken = user.RefreshToken
+	}
+
+	if err := s.repo.UpdateUserToken(user.ID, refreshed.AccessToken, refreshToken, refreshed.Expiry); err != nil {
+		// The refreshed token is still usable for this request
+		log.Printf("Error persisting refreshed token: %v", err)
+	}
+	log.Printf("Refreshed %s access token for user %d (expires %v)", user.Provider, user.ID, refreshed.Expiry)
+
+	return refreshed, nil
+}
+
+// GoogleCalendarProvider is the calendar.ProviderFactory used in production:
+// it talks to Google Calendar with the user's stored, refreshing credentials
+func GoogleCalendarProvider(ctx context.Context, user *models.User) (calendar.CalendarProvider, error) {
+	tokenSource, err := NewUserTokenSource(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return calendar.NewGoogleProvider(ctx, tokenSource)
+}
+
+// MicrosoftCalendarProvider talks to the user's Outlook calendar through
+// Microsoft Graph with their stored credentials
+func MicrosoftCalendarProvider(ctx context.Context, user *models.User) (calendar.CalendarProvider, error) {
+	tokenSource, err := NewUserTokenSource(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return calendar.NewMicrosoftProvider(ctx, tokenSource), nil
+}
+
+// CalendarProviderForUser routes to the calendar backend the user chose,
+// defaulting to the calendar of whichever provider they signed in with
+func CalendarProviderForUser(ctx context.Context, user *models.User) (calendar.CalendarProvider, error) {
+	if user.CalendarBackend == "caldav" {
+		return calendar.NewCalDAVProvider(user.CalDAVURL, user.CalDAVUsername, user.CalDAVPassword, user.Email), nil
+	}
+
+	switch user.Provider {
+	case MicrosoftProvider:
+		return MicrosoftCalendarProvider(ctx, user)
+	case "google", "":
+		return GoogleCalendarProvider(ctx, user)
+	}
+	return nil, fmt.Errorf("no calendar provider for %q", user.Provider)
+}
+
+// SeedTimeZone fills in a user's time zone from their calendar settings
+// the first time they sign in. Failures are only logged.
+func SeedTimeZone(ctx context.Context, user *models.User) {
+	if user.TimeZone != "" {
+		return
+	}
+
+	provider, err := CalendarProviderForUser(ctx, user)
+	if err != nil {
+		log.Printf("Error seeding time zone for user %d: %v", user.ID, err)
+		return
+	}
+	reader, ok := provider.(calendar.TimeZoneReader)
+	if !ok {
+		return
+	}
+
+	timeZone, err := reader.CalendarTimeZone(ctx)
+	if err != nil {
+		log.Printf("Error seeding time zone for user %d: %v", user.ID, err)
+		return
+	}
+	if _, err := calendar.LoadTimeZone(timeZone); err != nil {
+		log.Printf("Ignoring calendar time zone for user %d: %v", user.ID, err)
+		return
+	}
+
+	if err := userRepo.UpdateUserTimeZone(user.ID, timeZone); err != nil {
+		log.Printf("Error saving time zone for user %d: %v", user.ID, err)
+		return
+	}
+	user.TimeZone = timeZone
+	log.Printf("Seeded time zone %s for user %d", timeZone, user.ID)
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"goauthDemo/calendar"
+	db "goauthDemo/database"
+	"goauthDemo/models"
+)
+
+// watches registers push notification channels; nil unless
+// WEBHOOK_BASE_URL is set, since Google only calls public HTTPS addresses
+var watches *calendar.WatchManager
+
+// NewWatchManager sets up calendar push notifications to
+// WEBHOOK_BASE_URL/webhooks/google-calendar. Returns nil when the variable
+// isn't set. Call after NewAuth.
+func NewWatchManager() *calendar.WatchManager {
+	baseURL := strings.TrimSuffix(os.Getenv("WEBHOOK_BASE_URL"), "/")
+	if baseURL == "" {
+		log.Println("WEBHOOK_BASE_URL not set, calendar push notifications disabled")
+		return nil
+	}
+
+	watches = &calendar.WatchManager{
+		Store:       db.NewWatchRepository(db.DB),
+		Users:       userRepo,
+		Calendars:   CalendarProviderForUser,
+		Address:     baseURL + "/webhooks/google-calendar",
+		TTL:         7 * 24 * time.Hour,
+		RenewBefore: 24 * time.Hour,
+	}
+	log.Printf("Calendar push notifications go to %s", watches.Address)
+	return watches
+}
+
+// WatchCalendar opens push notification channels for the user's primary
+// and default calendars, if notifications are enabled. Failures are only
+// logged.
+func WatchCalendar(ctx context.Context, user *models.User) {
+	if watches == nil {
+		return
+	}
+
+	calendarIDs := []string{calendar.PrimaryCalendar}
+	if user.DefaultCalendarID != "" {
+		calendarIDs = append(calendarIDs, user.DefaultCalendarID)
+	}
+	for _, calendarID := range calendarIDs {
+		if err := watches.Watch(ctx, user, calendarID); err != nil {
+			log.Printf("Error watching calendar %s of user %d: %v", calendarID, user.ID, err)
+		}
+	}
+}
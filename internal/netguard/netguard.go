@@ -0,0 +1,103 @@
+// Package netguard keeps requests to user-supplied URLs (CalDAV servers,
+// reminder webhooks) away from the server's own network
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked is returned for addresses that aren't publicly routable
+var ErrBlocked = errors.New("address is not publicly routable")
+
+// blockedPrefixes are ranges not covered by the netip.Addr predicates
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, may reach private IPv4
+}
+
+// Allowed reports whether addr is a public unicast address
+func Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL validates an http(s) URL and makes sure its host only resolves
+// to public addresses. The dialer of NewClient checks again at connect
+// time, since DNS answers can change in between.
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("must be an http(s) URL")
+	}
+
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if !Allowed(addr) {
+			return ErrBlocked
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !Allowed(addr) {
+			return ErrBlocked
+		}
+	}
+	return nil
+}
+
+// control runs after DNS resolution, right before each connection is made
+func control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("unable to parse dial address %q: %w", address, err)
+	}
+	if !Allowed(addrPort.Addr()) {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client that refuses to connect to
+// non-public addresses, including after redirects
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: control,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy: it would make the connection on our behalf
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := Allowed(netip.MustParseAddr(tt.addr)); got != tt.allowed {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.addr, got, tt.allowed)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		blocked bool
+		invalid bool
+	}{
+		{"https://93.184.216.34/dav/", false, false},
+		{"http://127.0.0.1:8080/", true, false},
+		{"http://[::1]/", true, false},
+		{"http://169.254.169.254/latest/meta-data/", true, false},
+		{"http://localhost/", true, false},
+		{"ftp://93.184.216.34/", false, true},
+		{"not a url", false, true},
+	}
+
+	for _, tt := range tests {
+		err := CheckURL(context.Background(), tt.url)
+		switch {
+		case tt.blocked && !errors.Is(err, ErrBlocked):
+			t.Errorf("CheckURL(%s) = %v, want ErrBlocked", tt.url, err)
+		case tt.invalid && (err == nil || errors.Is(err, ErrBlocked)):
+			t.Errorf("CheckURL(%s) = %v, want invalid URL", tt.url, err)
+		case !tt.blocked && !tt.invalid && err != nil:
+			t.Errorf("CheckURL(%s) = %v, want nil", tt.url, err)
+		}
+	}
+}
+
+func TestClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrBlocked) {
+		t.Fatalf("Get(%s) error = %v, want ErrBlocked", server.URL, err)
+	}
+}
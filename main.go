@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"goauthDemo/calendar"
 	db "goauthDemo/database"
 	"goauthDemo/internal/auth"
 	"goauthDemo/middleware"
+	"goauthDemo/notify"
 	"goauthDemo/routes"
 	"log"
 	"net/http"
@@ -34,6 +37,11 @@ func main() {
 	}
 	log.Println("DB_URL is set")
 
+	// Third-party credentials (CalDAV passwords) are encrypted with it
+	if err := db.SetCredentialsKey(os.Getenv("CREDENTIALS_KEY")); err != nil {
+		log.Fatal("CREDENTIALS_KEY environment variable is not set")
+	}
+
 	// Initialize database
 	db.InitDB()
 	log.Println("Database initialized")
@@ -51,11 +59,119 @@ func main() {
 	r.HandleFunc("/auth/{provider}/callback", routes.AuthCallback).Methods("GET")
 	r.HandleFunc("/schedule-meeting", routes.ScheduleMeeting).Methods("GET")
 
+	// Meeting handlers get their calendar backend injected. Listings are
+	// served from a local copy of the calendar that is kept up to date
+	// with incremental syncs.
+	calendars := calendar.NewCachingFactory(auth.CalendarProviderForUser, db.NewEventRepository(db.DB), time.Minute)
+	if os.Getenv("CALENDAR_PROVIDER") == "memory" {
+		// A process-local fake in place of every user's calendar is only
+		// for development
+		if !devBuild {
+			log.Fatal("CALENDAR_PROVIDER=memory is only allowed in dev builds (go build -tags dev)")
+		}
+		log.Println("Using in-memory calendar provider")
+		calendars = calendar.NewMemoryProviderFactory()
+	}
+	h := routes.NewHandler(db.NewUserRepository(db.DB), calendars)
+
+	// Push notifications keep the cache fresh without polling; channels
+	// are opened on sign-in and renewed in the background
+	h.Watches = db.NewWatchRepository(db.DB)
+	if watches := auth.NewWatchManager(); watches != nil {
+		go watches.Run(context.Background(), time.Hour)
+	}
+	r.HandleFunc("/webhooks/google-calendar", h.GoogleCalendarWebhook).Methods("POST")
+
+	// Subscribable calendar feeds are authenticated by the secret in their
+	// URL, so guessing is slowed down per client
+	h.Feeds = db.NewFeedRepository(db.DB)
+	feeds := r.PathPrefix("/feeds").Subrouter()
+	feeds.Use(middleware.RateLimit(30, 10))
+	feeds.HandleFunc("/{token}.ics", h.CalendarFeed).Methods("GET")
+
+	// Booking pages are public, so guests can book without an account
+	h.Bookings = db.NewBookingRepository(db.DB)
+	book := r.PathPrefix("/book").Subrouter()
+	book.Use(middleware.RateLimit(60, 20))
+	book.HandleFunc("/{user}/{type}", h.BookingPage).Methods("GET")
+	book.HandleFunc("/{user}/{type}/slots", h.BookingSlots).Methods("GET")
+	book.HandleFunc("/{user}/{type}", h.BookSlot).Methods("POST")
+
+	// Poll participants vote through the poll's secret link
+	h.Polls = db.NewPollRepository(db.DB)
+	vote := r.PathPrefix("/vote").Subrouter()
+	vote.Use(middleware.RateLimit(60, 20))
+	vote.HandleFunc("/{token}", h.PollPage).Methods("GET")
+	vote.HandleFunc("/{token}/results", h.PollResults).Methods("GET")
+	vote.HandleFunc("/{token}", h.VotePoll).Methods("POST")
+
+	// Our own reminders are sent in the background, by email when SMTP is
+	// configured, or to webhooks and Slack. SMTP also has attendees
+	// emailed invites when meetings are created, moved or cancelled.
+	reminders := db.NewReminderRepository(db.DB)
+	h.Reminders = reminders
+	notifiers := map[string]notify.Notifier{
+		notify.ChannelWebhook: &notify.WebhookNotifier{},
+		notify.ChannelSlack:   &notify.SlackNotifier{},
+	}
+	if smtpConfig := notify.SMTPConfigFromEnv(); smtpConfig != nil {
+		sender := &notify.SMTPSender{Config: smtpConfig}
+		notifiers[notify.ChannelEmail] = &notify.EmailNotifier{Sender: sender}
+		h.Mail = &notify.Mailer{Sender: sender}
+		log.Printf("Sending email through %s:%s", smtpConfig.Host, smtpConfig.Port)
+	} else {
+		log.Println("SMTP_HOST not set, email reminders and meeting emails disabled")
+	}
+	scheduler := &notify.Scheduler{
+		Store:        reminders,
+		Users:        db.NewUserRepository(db.DB),
+		Calendars:    calendars,
+		Notifiers:    notifiers,
+		Lookahead:    5 * time.Minute,
+		MaxAttempts:  3,
+		RetryDelay:   time.Minute,
+		ClaimTimeout: 5 * time.Minute,
+		Retention:    30 * 24 * time.Hour,
+	}
+	go scheduler.Run(context.Background(), time.Minute)
+
 	// API routes (protected by JWT)
 	apiRouter := r.PathPrefix("").Subrouter()
 	apiRouter.Use(middleware.JWTAuthMiddleware)
-	apiRouter.HandleFunc("/create-meeting", routes.CreateMeeting).Methods("POST")
-	apiRouter.HandleFunc("/upcoming-meetings", routes.GetUpcomingMeetings).Methods("GET")
+	apiRouter.HandleFunc("/create-meeting", h.CreateMeeting).Methods("POST")
+	apiRouter.HandleFunc("/upcoming-meetings", h.GetUpcomingMeetings).Methods("GET")
+	apiRouter.HandleFunc("/meetings.ics", h.ExportMeetings).Methods("GET")
+	apiRouter.HandleFunc("/meetings/import", h.ImportMeetings).Methods("POST")
+	apiRouter.HandleFunc("/freebusy", h.FreeBusy).Methods("POST")
+	apiRouter.HandleFunc("/meetings/suggest", h.SuggestMeetingTimes).Methods("POST")
+	apiRouter.HandleFunc("/meetings/{id}/instances", h.ListMeetingInstances).Methods("GET")
+	apiRouter.HandleFunc("/meetings/{id}/rsvp", h.RespondToMeeting).Methods("POST")
+	apiRouter.HandleFunc("/meetings/{id}", h.GetMeeting).Methods("GET")
+	apiRouter.HandleFunc("/meetings/{id}", h.UpdateMeeting).Methods("PUT")
+	apiRouter.HandleFunc("/meetings/{id}", h.PatchMeeting).Methods("PATCH")
+	apiRouter.HandleFunc("/meetings/{id}", h.DeleteMeeting).Methods("DELETE")
+	apiRouter.HandleFunc("/calendar-backend", h.GetCalendarBackend).Methods("GET")
+	apiRouter.HandleFunc("/calendar-backend", h.SetCalendarBackend).Methods("PUT")
+	apiRouter.HandleFunc("/time-zone", h.GetTimeZone).Methods("GET")
+	apiRouter.HandleFunc("/time-zone", h.SetTimeZone).Methods("PUT")
+	apiRouter.HandleFunc("/calendars", h.ListCalendars).Methods("GET")
+	apiRouter.HandleFunc("/default-calendar", h.SetDefaultCalendar).Methods("PUT")
+	apiRouter.HandleFunc("/feed", h.GetFeed).Methods("GET")
+	apiRouter.HandleFunc("/feed/rotate", h.RotateFeed).Methods("POST")
+	apiRouter.HandleFunc("/feed", h.RevokeFeed).Methods("DELETE")
+	apiRouter.HandleFunc("/booking-types", h.ListBookingTypes).Methods("GET")
+	apiRouter.HandleFunc("/booking-types", h.CreateBookingType).Methods("POST")
+	apiRouter.HandleFunc("/booking-types/{slug}", h.UpdateBookingType).Methods("PUT")
+	apiRouter.HandleFunc("/booking-types/{slug}", h.DeleteBookingType).Methods("DELETE")
+	apiRouter.HandleFunc("/polls", h.ListPolls).Methods("GET")
+	apiRouter.HandleFunc("/polls", h.CreatePoll).Methods("POST")
+	apiRouter.HandleFunc("/polls/{id}", h.GetPoll).Methods("GET")
+	apiRouter.HandleFunc("/polls/{id}/finalize", h.FinalizePoll).Methods("POST")
+	apiRouter.HandleFunc("/polls/{id}", h.DeletePoll).Methods("DELETE")
+	apiRouter.HandleFunc("/reminders", h.ListReminderRules).Methods("GET")
+	apiRouter.HandleFunc("/reminders", h.CreateReminderRule).Methods("POST")
+	apiRouter.HandleFunc("/reminders/jobs", h.ListReminderJobs).Methods("GET")
+	apiRouter.HandleFunc("/reminders/{id}", h.DeleteReminderRule).Methods("DELETE")
 
 	// Add some basic middleware for all routes
 	// Similar to what Gin provides by default
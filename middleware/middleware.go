@@ -8,6 +8,8 @@ import (
 	"os"
 	"strings"
 
+	"goauthDemo/internal/auth"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -51,7 +53,11 @@ func ValidateJWT(tokenStr string) (jwt.MapClaims, error) {
 			return nil, errors.New("unexpected signing method")
 		}
 		return jwtSecret, nil
-	})
+	},
+		jwt.WithIssuer(auth.JWTIssuer),
+		jwt.WithAudience(auth.JWTAudience),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		log.Printf("JWT Parsing Error: %v", err)
@@ -70,4 +76,20 @@ func ValidateJWT(tokenStr string) (jwt.MapClaims, error) {
 	// Log claim details for debugging without exposing sensitive information
 	log.Printf("JWT Claims successfully validated for user_id: %v", claims["user_id"])
 	return claims, nil
-}
\ No newline at end of file
+}
+
+// UserIDFromContext returns the authenticated user's ID from the JWT claims
+// stored in the request context by JWTAuthMiddleware
+func UserIDFromContext(ctx context.Context) (int, error) {
+	claims, ok := ctx.Value(UserCtxKey).(jwt.MapClaims)
+	if !ok {
+		return 0, errors.New("user context missing")
+	}
+
+	// JSON numbers decode as float64
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errors.New("user ID missing from claims")
+	}
+	return int(userID), nil
+}
@@ -7,12 +7,224 @@ import (
 // User represents a user record in the database
 type User struct {
 	ID           int       `json:"id"`
+	Provider     string    `json:"provider" gorm:"default:google"` // goth provider the user signed in with
 	GoogleID     string    `json:"google_id"`
+	MicrosoftID  string    `json:"microsoft_id"`
 	Email        string    `json:"email"`
 	Name         string    `json:"name"`
+	TimeZone     string    `json:"time_zone"` // IANA zone, e.g. "Europe/Berlin"
 	AccessToken  string    `json:"-"`
 	RefreshToken string    `json:"-"`
 	TokenExpiry  time.Time `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// CalendarBackend overrides where meetings are stored; empty means the
+	// calendar of the sign-in provider, "caldav" uses the CalDAV settings
+	CalendarBackend string `json:"calendar_backend"`
+	CalDAVURL       string `json:"caldav_url" gorm:"column:caldav_url"`
+	CalDAVUsername  string `json:"caldav_username" gorm:"column:caldav_username"`
+	CalDAVPassword  string `json:"-" gorm:"column:caldav_password;serializer:encrypted"` // app password for the CalDAV server, encrypted at rest
+	// DefaultCalendarID is the calendar meetings go to when a request
+	// doesn't name one; empty means the user's primary calendar
+	DefaultCalendarID string    `json:"default_calendar_id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// CachedEvent is a copy of a calendar event kept by the sync engine, so
+// listings can be served without asking the provider
+type CachedEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     int       `json:"user_id" gorm:"uniqueIndex:idx_cached_event;index:idx_cached_event_window"`
+	CalendarID string    `json:"calendar_id" gorm:"uniqueIndex:idx_cached_event;index:idx_cached_event_window"`
+	EventID    string    `json:"event_id" gorm:"uniqueIndex:idx_cached_event"`
+	StartTime  time.Time `json:"start_time" gorm:"index:idx_cached_event_window"`
+	EndTime    time.Time `json:"end_time"`
+	Data       string    `json:"-"` // the event as Google Calendar JSON
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SyncState records how far the sync engine got with one of a user's calendars
+type SyncState struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	UserID     int    `json:"user_id" gorm:"uniqueIndex:idx_sync_state"`
+	CalendarID string `json:"calendar_id" gorm:"uniqueIndex:idx_sync_state"`
+	// SyncToken continues from the last sync; empty forces a full sync
+	SyncToken string    `json:"-"`
+	SyncedAt  time.Time `json:"synced_at"`
+	// Stale is set when the calendar is known to have changed since SyncedAt
+	Stale     bool      `json:"stale"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WatchChannel is a push notification channel registered with Google for
+// one of a user's calendars
+type WatchChannel struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	UserID     int    `json:"user_id" gorm:"index:idx_watch_channel_calendar"`
+	CalendarID string `json:"calendar_id" gorm:"index:idx_watch_channel_calendar"`
+	ChannelID  string `json:"channel_id" gorm:"uniqueIndex"`
+	// ResourceID is Google's ID of the watched resource, needed to stop the channel
+	ResourceID string `json:"resource_id"`
+	// Token is echoed back in every notification to prove it came from Google
+	Token      string    `json:"-"`
+	Expiration time.Time `json:"expiration" gorm:"index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FeedToken is the secret in a user's subscribable calendar feed URL.
+// Only its SHA-256 hash is stored.
+type FeedToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     int        `json:"user_id" gorm:"uniqueIndex"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BookingType is a kind of meeting external guests can book with a user
+// through their public booking page, such as a 30 minute intro call
+type BookingType struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	UserID int  `json:"user_id" gorm:"uniqueIndex:idx_booking_type_slug"`
+	// Slug names the booking type in its /book/{user}/{slug} URL
+	Slug            string `json:"slug" gorm:"uniqueIndex:idx_booking_type_slug"`
+	Title           string `json:"title"`
+	Description     string `json:"description"`
+	DurationMinutes int    `json:"duration_minutes"`
+	// Availability lists the weekly windows slots are offered in, as
+	// times of day in TimeZone
+	Availability        []AvailabilityWindow `json:"availability" gorm:"serializer:json"`
+	TimeZone            string               `json:"time_zone"`
+	BufferBeforeMinutes int                  `json:"buffer_before_minutes"`
+	BufferAfterMinutes  int                  `json:"buffer_after_minutes"`
+	MinNoticeMinutes    int                  `json:"min_notice_minutes"`
+	// HorizonDays is how many days ahead slots are offered
+	HorizonDays int `json:"horizon_days"`
+	// MaxPerDay limits the bookings per day; 0 means no limit
+	MaxPerDay int               `json:"max_per_day"`
+	Questions []BookingQuestion `json:"questions" gorm:"serializer:json"`
+	Active    bool              `json:"active"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// AvailabilityWindow is a weekly period in which a booking type can be
+// booked, such as 09:00 to 12:00 on Mondays and Wednesdays
+type AvailabilityWindow struct {
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// BookingQuestion is asked of guests when they book
+type BookingQuestion struct {
+	ID       string `json:"id"`
+	Label    string `json:"label"`
+	Required bool   `json:"required"`
+}
+
+// Booking is a meeting a guest booked through a booking page. A slot
+// has at most one active booking.
+type Booking struct {
+	ID            uint              `json:"id" gorm:"primaryKey"`
+	BookingTypeID uint              `json:"booking_type_id" gorm:"uniqueIndex:idx_booking_open_slot,where:cancelled_at IS NULL"`
+	UserID        int               `json:"user_id" gorm:"index"`
+	EventID       string            `json:"event_id"` // empty while the event is being created
+	GuestName     string            `json:"guest_name"`
+	GuestEmail    string            `json:"guest_email"`
+	Answers       map[string]string `json:"answers" gorm:"serializer:json"`
+	StartTime     time.Time         `json:"start_time" gorm:"uniqueIndex:idx_booking_open_slot,where:cancelled_at IS NULL"`
+	EndTime       time.Time         `json:"end_time"`
+	// CancelledAt is set once the booked event was cancelled, deleted or
+	// moved, which frees the slot
+	CancelledAt *time.Time `json:"cancelled_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Poll asks people whose calendars can't be read which of several
+// candidate times suit them, until the organizer picks one
+type Poll struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	UserID int  `json:"user_id" gorm:"index"`
+	// TokenHash is the SHA-256 of the secret in the poll's shareable
+	// /vote/{token} URL; the token itself is only shown on creation
+	TokenHash   string `json:"-" gorm:"uniqueIndex"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+	TimeZone    string `json:"time_zone"`
+	// Status is open while votes are taken and finalized once a time is picked
+	Status string `json:"status"`
+	// Deadline is when voting ends, if set
+	Deadline *time.Time `json:"deadline"`
+	// FinalOptionID and EventID are set when the poll is finalized
+	FinalOptionID *uint        `json:"final_option_id"`
+	EventID       string       `json:"event_id"`
+	Options       []PollOption `json:"options"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// PollOption is a candidate time of a poll
+type PollOption struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	PollID    uint      `json:"poll_id" gorm:"index"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// PollParticipant is someone who voted on a poll. Participants change
+// their votes with the token they got when they first voted; only its
+// SHA-256 hash is stored.
+type PollParticipant struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	PollID    uint       `json:"poll_id" gorm:"uniqueIndex:idx_poll_participant"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email" gorm:"uniqueIndex:idx_poll_participant"`
+	TokenHash string     `json:"-"`
+	Votes     []PollVote `json:"votes" gorm:"foreignKey:ParticipantID"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// PollVote is a participant's answer for one option: yes, maybe or no
+type PollVote struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	ParticipantID uint   `json:"participant_id" gorm:"index"`
+	OptionID      uint   `json:"option_id"`
+	Choice        string `json:"choice"`
+}
+
+// ReminderRule asks for a reminder of every event in a user's default
+// calendar, sent by the server some minutes before the event starts
+type ReminderRule struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	UserID int  `json:"user_id" gorm:"index"`
+	// Channel is "email", "webhook" or "slack"
+	Channel string `json:"channel"`
+	// Target is the email address, webhook URL or Slack incoming webhook
+	// URL reminders are sent to
+	Target        string    `json:"target"`
+	MinutesBefore int       `json:"minutes_before"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ReminderJob is a reminder the scheduler has planned for one occurrence
+// of an event. Jobs are unique per rule, event and start time, so a
+// restart neither loses nor repeats them.
+type ReminderJob struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RuleID    uint      `json:"rule_id" gorm:"uniqueIndex:idx_reminder_job"`
+	UserID    int       `json:"user_id" gorm:"index"`
+	EventID   string    `json:"event_id" gorm:"uniqueIndex:idx_reminder_job"`
+	StartTime time.Time `json:"start_time" gorm:"uniqueIndex:idx_reminder_job"`
+	Title     string    `json:"title"`
+	// SendAt is when the reminder is due, or retried after a failure
+	SendAt time.Time `json:"send_at" gorm:"index:idx_reminder_job_due,priority:2"`
+	// Status is pending, sending, sent, failed or skipped
+	Status    string     `json:"status" gorm:"index:idx_reminder_job_due,priority:1"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error"`
+	SentAt    *time.Time `json:"sent_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"os"
+)
+
+// SMTPConfig says how to reach the mail server
+type SMTPConfig struct {
+	Host string
+	Port string
+	// Username and Password are optional; without them mail is sent
+	// unauthenticated, as to a local relay
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPConfigFromEnv reads SMTP_HOST, SMTP_PORT (default 587),
+// SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM. Returns nil when SMTP_HOST
+// isn't set.
+func SMTPConfigFromEnv() *SMTPConfig {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+	config := &SMTPConfig{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	if config.From == "" {
+		config.From = config.Username
+	}
+	return config
+}
+
+// EmailNotifier sends reminders as emails with the meeting attached as an
+// .ics file
+type EmailNotifier struct {
+	Sender Sender
+}
+
+// Notify emails the reminder to its target
+func (n *EmailNotifier) Notify(ctx context.Context, reminder *Reminder) error {
+	data := newMailData(reminder.User, reminder.Event, reminder.Location)
+	data.Lead = reminder.lead()
+	subject, text, err := render(MailReminder, data)
+	if err != nil {
+		return err
+	}
+	attachment, err := invite(reminder.User, reminder.Event, "PUBLISH")
+	if err != nil {
+		return err
+	}
+
+	return n.Sender.Send(ctx, &Message{
+		To:          []string{reminder.Target},
+		Subject:     subject,
+		Text:        text,
+		Attachments: []Attachment{attachment},
+	})
+}
@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email with optional attachments
+type Message struct {
+	To      []string
+	Subject string
+	// Text is the plain text body
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a Message
+type Attachment struct {
+	Filename string
+	// ContentType may carry parameters, as in text/calendar; method=REQUEST
+	ContentType string
+	Data        []byte
+}
+
+// Sender sends emails
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// smtpTimeout bounds sending one email when the context has no deadline
+const smtpTimeout = 30 * time.Second
+
+// SMTPSender sends emails through an SMTP server. Pointing it at a local
+// mail catcher such as MailHog (SMTP_HOST=localhost, SMTP_PORT=1025)
+// shows the emails without delivering them.
+type SMTPSender struct {
+	Config *SMTPConfig
+}
+
+// Send delivers the message to all its recipients. The whole conversation
+// with the server ends when ctx is done, or after smtpTimeout.
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.encode(s.Config.From)
+	if err != nil {
+		return fmt.Errorf("unable to build email: %w", err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Config.Host, s.Config.Port))
+	if err != nil {
+		return fmt.Errorf("unable to connect to mail server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// Cancelling ctx interrupts whatever the connection is waiting for
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, s.Config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("unable to send email: %w", err)
+	}
+	defer client.Close()
+
+	if err := s.deliver(client, msg.To, data); err != nil {
+		return fmt.Errorf("unable to send email: %w", err)
+	}
+	return nil
+}
+
+// deliver runs the SMTP conversation as smtp.SendMail does: STARTTLS when
+// the server offers it, authentication if configured, then the message
+func (s *SMTPSender) deliver(client *smtp.Client, to []string, data []byte) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.Config.Host}); err != nil {
+			return err
+		}
+	}
+	if s.Config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Config.Username, s.Config.Password, s.Config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.Config.From); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// encode renders the message as MIME: plain text, or multipart/mixed when
+// there are attachments
+func (msg *Message) encode(from string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", headerText(msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(msg.Attachments) == 0 {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", parts.Boundary())
+
+	text, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(text, msg.Text); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, attachment.Data)
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable writes text with CRLF line endings, so any mail
+// server accepts it whatever characters it holds
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n") + "\r\n")); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+// headerText keeps a header value on one line, encoding it if it isn't ASCII
+func headerText(s string) string {
+	return mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", " ", "\n", " ").Replace(s))
+}
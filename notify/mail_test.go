@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer is a stand-in mail server on loopback that accepts one
+// message, or answers nothing at all when silent. received gets the
+// message data.
+func smtpServer(t *testing.T, silent bool) (*SMTPConfig, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if silent {
+			// Hold the connection open without a greeting
+			conn.Read(make([]byte, 1))
+			return
+		}
+
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ready")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- string(data)
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return &SMTPConfig{Host: host, Port: port, From: "meetings@example.com"}, received
+}
+
+func TestSMTPSenderSends(t *testing.T) {
+	config, received := smtpServer(t, false)
+	sender := &SMTPSender{Config: config}
+
+	err := sender.Send(context.Background(), &Message{To: []string{"bob@example.com"}, Subject: "Planning", Text: "Agenda"})
+	if err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	select {
+	case data := <-received:
+		headers, _ := textproto.NewReader(bufio.NewReader(strings.NewReader(data))).ReadMIMEHeader()
+		if headers.Get("To") != "bob@example.com" || headers.Get("Subject") != "Planning" {
+			t.Errorf("server received headers %v", headers)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server received no message")
+	}
+}
+
+func TestSMTPSenderStopsWithContext(t *testing.T) {
+	config, _ := smtpServer(t, true)
+	sender := &SMTPSender{Config: config}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := sender.Send(ctx, &Message{To: []string{"bob@example.com"}, Subject: "Planning", Text: "Agenda"})
+	if err == nil {
+		t.Fatal("Send() = nil, want an error from a server that never answers")
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Send() = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("Send() took %v after its context ended", elapsed)
+	}
+}
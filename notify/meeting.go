@@ -0,0 +1,251 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/ical"
+	"goauthDemo/models"
+	"strings"
+	"text/template"
+	"time"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// Meeting emails, named after their templates
+const (
+	MailCreated     = "created"
+	MailRescheduled = "rescheduled"
+	MailCancelled   = "cancelled"
+	MailReminder    = "reminder"
+)
+
+//go:embed templates/*.txt
+var templateFiles embed.FS
+
+// mailTemplates holds a template per kind of email. Each defines a
+// "subject" next to the body and can use the shared "details".
+var mailTemplates = parseMailTemplates(MailCreated, MailRescheduled, MailCancelled, MailReminder)
+
+func parseMailTemplates(kinds ...string) map[string]*template.Template {
+	funcs := template.FuncMap{"join": strings.Join}
+	templates := map[string]*template.Template{}
+	for _, kind := range kinds {
+		templates[kind] = template.Must(template.New(kind+".txt").Funcs(funcs).
+			ParseFS(templateFiles, "templates/"+kind+".txt", "templates/details.txt"))
+	}
+	return templates
+}
+
+// mailData is what the email templates see
+type mailData struct {
+	Title     string
+	Organizer string
+	// When and PreviousWhen are the meeting's times in the organizer's zone
+	When         string
+	PreviousWhen string
+	Where        string
+	Join         string
+	Details      string
+	Description  string
+	Attendees    []string
+	// Lead says when a reminded meeting starts, as in "starts in 15 minutes"
+	Lead string
+}
+
+func newMailData(user *models.User, event *calendarapi.Event, loc *time.Location) *mailData {
+	data := &mailData{
+		Title:       event.Summary,
+		Organizer:   user.Email,
+		When:        formatWhen(event, loc),
+		Where:       event.Location,
+		Join:        event.HangoutLink,
+		Details:     event.HtmlLink,
+		Description: event.Description,
+	}
+	if user.Name != "" {
+		data.Organizer = user.Name
+	}
+	for _, attendee := range event.Attendees {
+		if !attendee.Resource {
+			data.Attendees = append(data.Attendees, attendee.Email)
+		}
+	}
+	return data
+}
+
+// render fills in the kind's template
+func render(kind string, data *mailData) (string, string, error) {
+	tmpl := mailTemplates[kind]
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", fmt.Errorf("unable to render %s email: %w", kind, err)
+	}
+	if err := tmpl.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("unable to render %s email: %w", kind, err)
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()), nil
+}
+
+// invite renders the event as an .ics attachment for the iTIP method,
+// such as REQUEST or CANCEL. The sender's own reminders are left out.
+func invite(user *models.User, event *calendarapi.Event, method string) (Attachment, error) {
+	copied := *event
+	copied.Reminders = nil
+	if copied.Organizer == nil {
+		copied.Organizer = &calendarapi.EventOrganizer{Email: user.Email, DisplayName: user.Name}
+	}
+	if method == "CANCEL" {
+		// A cancellation supersedes the last invite
+		copied.Status = "cancelled"
+		copied.Sequence++
+	}
+
+	var buf bytes.Buffer
+	if err := ical.EncodeWithOptions(&buf, []*calendarapi.Event{&copied}, ical.Options{Method: method}); err != nil {
+		return Attachment{}, fmt.Errorf("unable to encode invite: %w", err)
+	}
+	return Attachment{
+		Filename:    "invite.ics",
+		ContentType: "text/calendar; charset=UTF-8; method=" + method,
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// Mailer emails attendees when their meetings are created, rescheduled
+// or cancelled, attaching the meeting as an .ics invite their calendar
+// apps can apply
+type Mailer struct {
+	Sender Sender
+}
+
+// MeetingCreated invites the attendees of a new meeting. sendUpdates is
+// all or externalOnly, which leaves out attendees in the organizer's
+// domain, as for the other methods.
+func (m *Mailer) MeetingCreated(ctx context.Context, user *models.User, event *calendarapi.Event, sendUpdates string) error {
+	return m.send(ctx, MailCreated, user, event, nil, recipients(user, event, sendUpdates))
+}
+
+// MeetingUpdated tells attendees about a changed meeting: new attendees
+// are invited, removed ones get a cancellation and the others hear of it
+// only if moved, that is if its times changed
+func (m *Mailer) MeetingUpdated(ctx context.Context, user *models.User, previous, event *calendarapi.Event, moved bool, sendUpdates string) error {
+	before := map[string]bool{}
+	for _, email := range recipients(user, previous, sendUpdates) {
+		before[email] = true
+	}
+
+	var added, kept []string
+	for _, email := range recipients(user, event, sendUpdates) {
+		if before[email] {
+			kept = append(kept, email)
+			delete(before, email)
+		} else {
+			added = append(added, email)
+		}
+	}
+	var removed []string
+	for _, email := range recipients(user, previous, sendUpdates) {
+		if before[email] {
+			removed = append(removed, email)
+		}
+	}
+
+	if err := m.send(ctx, MailCreated, user, event, nil, added); err != nil {
+		return err
+	}
+	if err := m.send(ctx, MailCancelled, user, previous, nil, removed); err != nil {
+		return err
+	}
+	if moved {
+		return m.send(ctx, MailRescheduled, user, event, previous, kept)
+	}
+	return nil
+}
+
+// MeetingCancelled tells the attendees of a deleted meeting, as it was
+// before deletion, that it is off
+func (m *Mailer) MeetingCancelled(ctx context.Context, user *models.User, event *calendarapi.Event, sendUpdates string) error {
+	return m.send(ctx, MailCancelled, user, event, nil, recipients(user, event, sendUpdates))
+}
+
+func (m *Mailer) send(ctx context.Context, kind string, user *models.User, event, previous *calendarapi.Event, to []string) error {
+	if len(to) == 0 {
+		return nil
+	}
+
+	loc := userLocation(user)
+	data := newMailData(user, event, loc)
+	if previous != nil {
+		data.PreviousWhen = formatWhen(previous, loc)
+	}
+	subject, text, err := render(kind, data)
+	if err != nil {
+		return err
+	}
+
+	method := "REQUEST"
+	if kind == MailCancelled {
+		method = "CANCEL"
+	}
+	attachment, err := invite(user, event, method)
+	if err != nil {
+		return err
+	}
+
+	return m.Sender.Send(ctx, &Message{
+		To:          to,
+		Subject:     subject,
+		Text:        text,
+		Attachments: []Attachment{attachment},
+	})
+}
+
+// recipients lists the attendees to email about an event: everyone but
+// the organizer and rooms, and for externalOnly also no one in the
+// organizer's domain
+func recipients(user *models.User, event *calendarapi.Event, sendUpdates string) []string {
+	var emails []string
+	for _, attendee := range event.Attendees {
+		if attendee.Self || attendee.Resource || attendee.Email == "" || strings.EqualFold(attendee.Email, user.Email) {
+			continue
+		}
+		if sendUpdates == calendar.SendUpdatesExternalOnly && strings.EqualFold(emailDomain(attendee.Email), emailDomain(user.Email)) {
+			continue
+		}
+		emails = append(emails, attendee.Email)
+	}
+	return emails
+}
+
+// emailDomain is the part of an address after the @
+func emailDomain(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
+
+// formatWhen renders when an event starts, such as
+// "Mon, Jan 2, 2006 03:04 PM (Europe/Berlin)"
+func formatWhen(event *calendarapi.Event, loc *time.Location) string {
+	if event.Start != nil && event.Start.Date != "" {
+		day, err := time.Parse("2006-01-02", event.Start.Date)
+		if err == nil {
+			return day.Format("Mon, Jan 2, 2006") + " (all day)"
+		}
+	}
+	start, err := calendar.ParseEventDateTime(event.Start)
+	if err != nil {
+		return "an unknown time"
+	}
+	return fmt.Sprintf("%s (%s)", start.In(loc).Format("Mon, Jan 2, 2006 03:04 PM"), loc)
+}
+
+// userLocation is the user's zone, or UTC if they haven't set a valid one
+func userLocation(user *models.User) *time.Location {
+	if loc, err := calendar.LoadTimeZone(user.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"goauthDemo/models"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// testSender keeps the messages it is asked to send
+type testSender struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func (s *testSender) Send(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// testMeeting is a meeting of alice's with the attendees, alice included
+func testMeeting(start string, attendees ...string) *calendarapi.Event {
+	event := &calendarapi.Event{
+		Id:      "planning",
+		Summary: "Planning",
+		Start:   &calendarapi.EventDateTime{DateTime: start, TimeZone: "UTC"},
+		End:     &calendarapi.EventDateTime{DateTime: strings.Replace(start, "T09", "T10", 1), TimeZone: "UTC"},
+		Attendees: []*calendarapi.EventAttendee{
+			{Email: "alice@example.com", Self: true},
+		},
+	}
+	for _, email := range attendees {
+		event.Attendees = append(event.Attendees, &calendarapi.EventAttendee{Email: email})
+	}
+	return event
+}
+
+func TestMailer(t *testing.T) {
+	user := &models.User{ID: 1, Name: "Alice", Email: "alice@example.com", TimeZone: "UTC"}
+	planning := testMeeting("2030-03-10T09:00:00Z", "bob@example.com", "carol@example.com")
+
+	// sent is an email the test expects: who to, what kind and the iTIP
+	// method of its invite
+	type sent struct {
+		to      []string
+		subject string
+		method  string
+	}
+	tests := []struct {
+		name string
+		send func(m *Mailer) error
+		want []sent
+	}{
+		{"created", func(m *Mailer) error {
+			return m.MeetingCreated(context.Background(), user, planning, "all")
+		}, []sent{{[]string{"bob@example.com", "carol@example.com"}, "Invitation", "REQUEST"}}},
+		{"cancelled", func(m *Mailer) error {
+			return m.MeetingCancelled(context.Background(), user, planning, "all")
+		}, []sent{{[]string{"bob@example.com", "carol@example.com"}, "Cancelled", "CANCEL"}}},
+		{"moved", func(m *Mailer) error {
+			moved := testMeeting("2030-03-11T09:00:00Z", "bob@example.com", "carol@example.com")
+			return m.MeetingUpdated(context.Background(), user, planning, moved, true, "all")
+		}, []sent{{[]string{"bob@example.com", "carol@example.com"}, "Rescheduled", "REQUEST"}}},
+		{"attendees changed", func(m *Mailer) error {
+			changed := testMeeting("2030-03-10T09:00:00Z", "bob@example.com", "dave@example.com")
+			return m.MeetingUpdated(context.Background(), user, planning, changed, false, "all")
+		}, []sent{
+			{[]string{"dave@example.com"}, "Invitation", "REQUEST"},
+			{[]string{"carol@example.com"}, "Cancelled", "CANCEL"},
+		}},
+		{"only the organizer", func(m *Mailer) error {
+			return m.MeetingCreated(context.Background(), user, testMeeting("2030-03-10T09:00:00Z"), "all")
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &testSender{}
+			if err := tt.send(&Mailer{Sender: sender}); err != nil {
+				t.Fatalf("send = %v", err)
+			}
+			if len(sender.messages) != len(tt.want) {
+				t.Fatalf("%d emails sent, want %d", len(sender.messages), len(tt.want))
+			}
+			for i, want := range tt.want {
+				msg := sender.messages[i]
+				if !reflect.DeepEqual(msg.To, want.to) {
+					t.Errorf("email %d went to %v, want %v", i, msg.To, want.to)
+				}
+				if !strings.Contains(msg.Subject, want.subject) {
+					t.Errorf("email %d subject = %q, want it to contain %q", i, msg.Subject, want.subject)
+				}
+				if len(msg.Attachments) != 1 || !strings.Contains(string(msg.Attachments[0].Data), "METHOD:"+want.method) {
+					t.Errorf("email %d has no %s invite attached", i, want.method)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package notify sends the server's own meeting reminders through
+// pluggable channels such as email, webhooks and Slack
+package notify
+
+import (
+	"context"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"time"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// Reminder channels, as stored in models.ReminderRule.Channel
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+)
+
+// Notifier delivers reminders over one channel
+type Notifier interface {
+	Notify(ctx context.Context, reminder *Reminder) error
+}
+
+// Reminder is a reminder of an upcoming meeting, addressed to the target
+// of the rule that asked for it
+type Reminder struct {
+	User  *models.User
+	Event *calendarapi.Event
+	// Target is the address the rule sends to
+	Target        string
+	Start         time.Time
+	MinutesBefore int
+	// Location is the zone times are written in
+	Location *time.Location
+}
+
+// Meeting is the event as the meeting endpoints show it
+func (r *Reminder) Meeting() *calendar.Meeting {
+	return calendar.NewMeeting(r.Event, r.Location)
+}
+
+// Text is the reminder as plain text
+func (r *Reminder) Text() string {
+	text := fmt.Sprintf("%s %s, at %s (%s).",
+		r.Event.Summary, r.lead(), r.Start.In(r.Location).Format("Mon, Jan 2, 2006 03:04 PM"), r.Location)
+	if r.Event.Location != "" {
+		text += "\nWhere: " + r.Event.Location
+	}
+	if r.Event.HangoutLink != "" {
+		text += "\nJoin: " + r.Event.HangoutLink
+	}
+	if r.Event.HtmlLink != "" {
+		text += "\nDetails: " + r.Event.HtmlLink
+	}
+	return text
+}
+
+// lead says when the meeting starts, as in "starts in 15 minutes"
+func (r *Reminder) lead() string {
+	if r.MinutesBefore > 0 {
+		return "starts in " + formatMinutes(r.MinutesBefore)
+	}
+	return "is starting now"
+}
+
+// formatMinutes renders a lead time such as "15 minutes" or "2 hours"
+func formatMinutes(minutes int) string {
+	switch {
+	case minutes%(24*60) == 0:
+		return plural(minutes/(24*60), "day")
+	case minutes%60 == 0:
+		return plural(minutes/60, "hour")
+	}
+	return plural(minutes, "minute")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,304 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"log"
+	"time"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// Reminder job statuses
+const (
+	JobPending = "pending"
+	// JobSending is a job a scheduler has claimed
+	JobSending = "sending"
+	JobSent    = "sent"
+	JobFailed  = "failed"
+	// JobSkipped is a job whose event was cancelled, moved or already began
+	JobSkipped = "skipped"
+)
+
+// ReminderStore keeps reminder rules and the jobs planned from them.
+// *database.ReminderRepository satisfies it.
+type ReminderStore interface {
+	ListReminderRules() ([]models.ReminderRule, error)
+	// GetReminderRule returns nil if the rule was deleted
+	GetReminderRule(id uint) (*models.ReminderRule, error)
+	// PlanReminderJob does nothing if the rule already has a job for the
+	// event and start time
+	PlanReminderJob(job *models.ReminderJob) error
+	ListDueReminderJobs(now time.Time, limit int) ([]models.ReminderJob, error)
+	// ClaimReminderJob marks a pending job as sending, returning false if
+	// it was no longer pending
+	ClaimReminderJob(id uint, now time.Time) (bool, error)
+	SaveReminderJob(job *models.ReminderJob) error
+	ReleaseReminderJobs(claimedBefore time.Time) error
+	DeleteReminderJobs(startedBefore time.Time) error
+}
+
+// Scheduler sends reminders of upcoming events in users' default
+// calendars, as their reminder rules ask. Jobs are planned ahead in the
+// store and claimed before sending, so several server processes and
+// restarts neither drop nor repeat reminders.
+type Scheduler struct {
+	Store     ReminderStore
+	Users     calendar.UserLookup
+	Calendars calendar.ProviderFactory
+	// Notifiers maps channels to the notifiers delivering them
+	Notifiers map[string]Notifier
+	// Lookahead is how far beyond now jobs are planned; it should exceed
+	// the interval Run is called with
+	Lookahead time.Duration
+	// MaxAttempts is how often sending a reminder is tried
+	MaxAttempts int
+	// RetryDelay grows with each failed attempt
+	RetryDelay time.Duration
+	// ClaimTimeout is after how long a claimed job is assumed lost with
+	// its scheduler and handed out again
+	ClaimTimeout time.Duration
+	// Retention is how long jobs are kept after their event started
+	Retention time.Duration
+}
+
+// dueBatch bounds the jobs sent per run
+const dueBatch = 100
+
+// Run plans and sends reminders every interval until ctx is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if err := s.Plan(ctx, now); err != nil {
+			log.Printf("Error planning reminders: %v", err)
+		}
+		if err := s.Dispatch(ctx, now); err != nil {
+			log.Printf("Error sending reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Plan creates the jobs for reminders due before now plus Lookahead, for
+// events that haven't started yet
+func (s *Scheduler) Plan(ctx context.Context, now time.Time) error {
+	rules, err := s.Store.ListReminderRules()
+	if err != nil {
+		return fmt.Errorf("unable to load reminder rules: %w", err)
+	}
+
+	byUser := map[int][]models.ReminderRule{}
+	var users []int
+	for _, rule := range rules {
+		if _, ok := byUser[rule.UserID]; !ok {
+			users = append(users, rule.UserID)
+		}
+		byUser[rule.UserID] = append(byUser[rule.UserID], rule)
+	}
+
+	for _, userID := range users {
+		if err := s.planUser(ctx, userID, byUser[userID], now); err != nil {
+			log.Printf("Error planning reminders of user %d: %v", userID, err)
+		}
+	}
+
+	if s.Retention > 0 {
+		if err := s.Store.DeleteReminderJobs(now.Add(-s.Retention)); err != nil {
+			log.Printf("Error deleting old reminders: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) planUser(ctx context.Context, userID int, rules []models.ReminderRule, now time.Time) error {
+	user, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		return fmt.Errorf("unable to load user: %w", err)
+	}
+	provider, err := s.userCalendar(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	longest := 0
+	for _, rule := range rules {
+		if rule.MinutesBefore > longest {
+			longest = rule.MinutesBefore
+		}
+	}
+	page, err := provider.ListEvents(ctx, calendar.ListOptions{
+		TimeMin: now,
+		TimeMax: now.Add(s.Lookahead + time.Duration(longest)*time.Minute),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, event := range page.Items {
+		if !remindable(event) {
+			continue
+		}
+		start, err := calendar.ParseEventDateTime(event.Start)
+		if err != nil || !start.After(now) {
+			continue
+		}
+		for _, rule := range rules {
+			sendAt := start.Add(-time.Duration(rule.MinutesBefore) * time.Minute)
+			if sendAt.After(now.Add(s.Lookahead)) {
+				continue
+			}
+			job := &models.ReminderJob{
+				RuleID:    rule.ID,
+				UserID:    user.ID,
+				EventID:   event.Id,
+				StartTime: start,
+				Title:     event.Summary,
+				SendAt:    sendAt,
+				Status:    JobPending,
+			}
+			if err := s.Store.PlanReminderJob(job); err != nil {
+				return fmt.Errorf("unable to plan reminder: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Dispatch sends the reminders that are due. Jobs claimed by a scheduler
+// that didn't finish them within ClaimTimeout are sent again.
+func (s *Scheduler) Dispatch(ctx context.Context, now time.Time) error {
+	if s.ClaimTimeout > 0 {
+		if err := s.Store.ReleaseReminderJobs(now.Add(-s.ClaimTimeout)); err != nil {
+			return fmt.Errorf("unable to release stale reminders: %w", err)
+		}
+	}
+
+	jobs, err := s.Store.ListDueReminderJobs(now, dueBatch)
+	if err != nil {
+		return fmt.Errorf("unable to load due reminders: %w", err)
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		claimed, err := s.Store.ClaimReminderJob(job.ID, now)
+		if err != nil {
+			return fmt.Errorf("unable to claim reminder: %w", err)
+		}
+		if !claimed {
+			continue
+		}
+
+		status, sendErr := s.send(ctx, job, now)
+		job.Attempts++
+		job.Status = status
+		job.LastError = ""
+		if sendErr != nil {
+			job.LastError = sendErr.Error()
+			log.Printf("Reminder %d for event %s of user %d: %s: %v", job.ID, job.EventID, job.UserID, status, sendErr)
+		}
+		if status == JobFailed && job.Attempts < s.MaxAttempts && job.StartTime.After(now) {
+			// Try again, unless that would be after the event started
+			job.Status = JobPending
+			job.SendAt = now.Add(time.Duration(job.Attempts) * s.RetryDelay)
+		}
+		if status == JobSent {
+			sentAt := now
+			job.SentAt = &sentAt
+			log.Printf("Sent reminder %d for event %s to user %d", job.ID, job.EventID, job.UserID)
+		}
+		if err := s.Store.SaveReminderJob(job); err != nil {
+			log.Printf("Error saving reminder %d: %v", job.ID, err)
+		}
+	}
+	return nil
+}
+
+// send delivers a claimed job, returning its new status. The event is
+// looked up again so reminders of cancelled or moved events aren't sent;
+// moved events get a job of their own when they are planned again.
+func (s *Scheduler) send(ctx context.Context, job *models.ReminderJob, now time.Time) (string, error) {
+	if !job.StartTime.After(now) {
+		return JobSkipped, errors.New("event already started")
+	}
+
+	rule, err := s.Store.GetReminderRule(job.RuleID)
+	if err != nil {
+		return JobFailed, err
+	}
+	if rule == nil {
+		return JobSkipped, errors.New("rule was deleted")
+	}
+	notifier, ok := s.Notifiers[rule.Channel]
+	if !ok {
+		return JobFailed, fmt.Errorf("channel %s is not configured", rule.Channel)
+	}
+
+	user, err := s.Users.GetUserByID(job.UserID)
+	if err != nil {
+		return JobFailed, fmt.Errorf("unable to load user: %w", err)
+	}
+	provider, err := s.userCalendar(ctx, user)
+	if err != nil {
+		return JobFailed, err
+	}
+	event, err := provider.GetEvent(ctx, job.EventID)
+	if errors.Is(err, calendar.ErrNotFound) {
+		return JobSkipped, errors.New("event was deleted")
+	}
+	if err != nil {
+		return JobFailed, err
+	}
+	start, err := calendar.ParseEventDateTime(event.Start)
+	if !remindable(event) || err != nil || !start.Equal(job.StartTime) {
+		return JobSkipped, errors.New("event was cancelled or moved")
+	}
+
+	reminder := &Reminder{
+		User:          user,
+		Event:         event,
+		Target:        rule.Target,
+		Start:         start,
+		MinutesBefore: rule.MinutesBefore,
+		Location:      userLocation(user),
+	}
+	if err := notifier.Notify(ctx, reminder); err != nil {
+		return JobFailed, err
+	}
+	return JobSent, nil
+}
+
+// userCalendar opens the user's default calendar
+func (s *Scheduler) userCalendar(ctx context.Context, user *models.User) (calendar.CalendarProvider, error) {
+	provider, err := s.Calendars(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create calendar provider: %w", err)
+	}
+	if user.DefaultCalendarID == "" {
+		return provider, nil
+	}
+	return provider.WithCalendar(ctx, user.DefaultCalendarID)
+}
+
+// remindable reports whether an event gets reminders: timed events that
+// aren't cancelled or declined by the user
+func remindable(event *calendarapi.Event) bool {
+	if event.Status == "cancelled" || event.Start == nil || event.Start.DateTime == "" {
+		return false
+	}
+	for _, attendee := range event.Attendees {
+		if attendee.Self && attendee.ResponseStatus == "declined" {
+			return false
+		}
+	}
+	return true
+}
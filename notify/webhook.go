@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"goauthDemo/internal/netguard"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts reminders as JSON to the target URL
+type WebhookNotifier struct {
+	// Client defaults to one with a 10 second timeout that only connects
+	// to public addresses
+	Client *http.Client
+}
+
+// Notify posts the reminder with the meeting as the meeting endpoints
+// show it
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder *Reminder) error {
+	return postJSON(ctx, n.Client, reminder.Target, map[string]interface{}{
+		"type":          "meeting.reminder",
+		"minutesBefore": reminder.MinutesBefore,
+		"text":          reminder.Text(),
+		"meeting":       reminder.Meeting(),
+	})
+}
+
+// SlackNotifier posts reminders to a Slack incoming webhook
+type SlackNotifier struct {
+	// Client defaults to one with a 10 second timeout
+	Client *http.Client
+}
+
+// Notify posts the reminder as a Slack message
+func (n *SlackNotifier) Notify(ctx context.Context, reminder *Reminder) error {
+	return postJSON(ctx, n.Client, reminder.Target, map[string]interface{}{
+		"text": reminder.Text(),
+	})
+}
+
+// defaultClient refuses private addresses, since webhook URLs are chosen
+// by users
+var defaultClient = netguard.NewClient(10 * time.Second)
+
+// postJSON posts body to url, failing unless the response is a 2xx. The
+// response body is left out of errors, which users see in their reminder
+// history.
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	if client == nil {
+		client = defaultClient
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post reminder: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("reminder rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goauthDemo/internal/netguard"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+func testReminder(target string) *Reminder {
+	return &Reminder{
+		Event:         &calendarapi.Event{Summary: "Planning"},
+		Target:        target,
+		Start:         time.Date(2030, 3, 10, 9, 0, 0, 0, time.UTC),
+		MinutesBefore: 15,
+		Location:      time.UTC,
+	}
+}
+
+func TestPostJSONLeavesOutResponseBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "internal detail: secret-token-123")
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{Client: server.Client()}
+	err := notifier.Notify(context.Background(), testReminder(server.URL))
+	if err == nil {
+		t.Fatal("Notify() = nil, want an error")
+	}
+	if !strings.Contains(err.Error(), "status 500") {
+		t.Errorf("error %q doesn't name the status", err)
+	}
+	if strings.Contains(err.Error(), "secret-token-123") {
+		t.Errorf("error %q contains the response body", err)
+	}
+}
+
+func TestWebhookRefusesPrivateAddresses(t *testing.T) {
+	posted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted = true
+	}))
+	defer server.Close()
+
+	err := (&WebhookNotifier{}).Notify(context.Background(), testReminder(server.URL))
+	if !errors.Is(err, netguard.ErrBlocked) {
+		t.Errorf("Notify() = %v, want %v", err, netguard.ErrBlocked)
+	}
+	if posted {
+		t.Error("reminder was posted to a loopback address")
+	}
+}
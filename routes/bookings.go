@@ -0,0 +1,788 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultHorizonDays is how far ahead booking pages offer slots unless
+	// the booking type says otherwise
+	defaultHorizonDays = 60
+	// maxHorizonDays bounds the horizonDays of a booking type
+	maxHorizonDays = 366
+	// bookingPendingTimeout is how long a booking may wait for its event
+	// before its slot is given up, e.g. after a crash while creating it
+	bookingPendingTimeout = 5 * time.Minute
+	// maxAnswerLength bounds a guest's answer to a booking question, in
+	// characters
+	maxAnswerLength = 1000
+)
+
+// bookingSlugPattern is what booking type slugs may look like, since they
+// are part of the booking page URL
+var bookingSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// bookingTypeRequest is the body of the booking type endpoints
+type bookingTypeRequest struct {
+	Slug            string `json:"slug"`
+	Title           string `json:"title"`
+	Description     string `json:"description"`
+	DurationMinutes int    `json:"durationMinutes"`
+	// Availability defaults to 09:00 to 17:00, Monday to Friday
+	Availability []models.AvailabilityWindow `json:"availability"`
+	// TimeZone the availability is in; defaults to the user's
+	TimeZone            string                   `json:"timeZone"`
+	BufferBeforeMinutes int                      `json:"bufferBeforeMinutes"`
+	BufferAfterMinutes  int                      `json:"bufferAfterMinutes"`
+	MinNoticeMinutes    int                      `json:"minNoticeMinutes"`
+	HorizonDays         int                      `json:"horizonDays"`
+	MaxPerDay           int                      `json:"maxPerDay"`
+	Questions           []models.BookingQuestion `json:"questions"`
+	// Active defaults to true; inactive booking types have no public page
+	Active *bool `json:"active"`
+}
+
+// ListBookingTypes lists the signed-in user's booking types with their
+// public URLs
+func (h *Handler) ListBookingTypes(w http.ResponseWriter, r *http.Request) {
+	if !h.bookingsEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	types, err := h.Bookings.ListBookingTypes(user.ID)
+	if err != nil {
+		log.Printf("Error listing booking types of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to list booking types", http.StatusInternalServerError)
+		return
+	}
+
+	formatted := []map[string]interface{}{}
+	for i := range types {
+		formatted = append(formatted, bookingTypeResponse(&types[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bookingTypes": formatted,
+	})
+}
+
+// CreateBookingType adds a booking type, which gets a public booking page
+// at /book/{user ID}/{slug}
+func (h *Handler) CreateBookingType(w http.ResponseWriter, r *http.Request) {
+	if !h.bookingsEnabled(w) {
+		return
+	}
+
+	var request bookingTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !bookingSlugPattern.MatchString(request.Slug) {
+		http.Error(w, "slug must be up to 64 lowercase letters, digits and dashes", http.StatusBadRequest)
+		return
+	}
+	existing, err := h.Bookings.GetBookingType(user.ID, request.Slug)
+	if err != nil {
+		log.Printf("Error loading booking type: %v", err)
+		http.Error(w, "Failed to create booking type", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "A booking type with this slug already exists", http.StatusConflict)
+		return
+	}
+
+	bookingType := &models.BookingType{UserID: user.ID, Slug: request.Slug}
+	if !applyBookingType(w, bookingType, request, user) {
+		return
+	}
+	if err := h.Bookings.SaveBookingType(bookingType); err != nil {
+		log.Printf("Error saving booking type: %v", err)
+		http.Error(w, "Failed to create booking type", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d created booking type %s", user.ID, bookingType.Slug)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/booking-types/"+bookingType.Slug)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(bookingTypeResponse(bookingType))
+}
+
+// UpdateBookingType replaces the settings of a booking type. Its slug
+// can't change, since it is part of links already shared.
+func (h *Handler) UpdateBookingType(w http.ResponseWriter, r *http.Request) {
+	if !h.bookingsEnabled(w) {
+		return
+	}
+
+	var request bookingTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	slug := mux.Vars(r)["slug"]
+	bookingType, err := h.Bookings.GetBookingType(user.ID, slug)
+	if err != nil {
+		log.Printf("Error loading booking type: %v", err)
+		http.Error(w, "Failed to update booking type", http.StatusInternalServerError)
+		return
+	}
+	if bookingType == nil {
+		http.Error(w, "Booking type not found", http.StatusNotFound)
+		return
+	}
+	if request.Slug != "" && request.Slug != slug {
+		http.Error(w, "The slug of a booking type can't be changed", http.StatusBadRequest)
+		return
+	}
+
+	if !applyBookingType(w, bookingType, request, user) {
+		return
+	}
+	if err := h.Bookings.SaveBookingType(bookingType); err != nil {
+		log.Printf("Error saving booking type: %v", err)
+		http.Error(w, "Failed to update booking type", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookingTypeResponse(bookingType))
+}
+
+// DeleteBookingType removes a booking type and its page. Meetings already
+// booked stay in the calendar.
+func (h *Handler) DeleteBookingType(w http.ResponseWriter, r *http.Request) {
+	if !h.bookingsEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Bookings.DeleteBookingType(user.ID, mux.Vars(r)["slug"]); err != nil {
+		log.Printf("Error deleting booking type: %v", err)
+		http.Error(w, "Failed to delete booking type", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Booking type deleted successfully!",
+	})
+}
+
+// applyBookingType validates a booking type request and copies it onto
+// the booking type, filling in defaults. Writes an error response and
+// returns false if the request is invalid.
+func applyBookingType(w http.ResponseWriter, bookingType *models.BookingType, request bookingTypeRequest, user *models.User) bool {
+	duration := time.Duration(request.DurationMinutes) * time.Minute
+	if duration <= 0 || duration > maxMeetingDuration {
+		http.Error(w, "durationMinutes must be between 1 and 1440", http.StatusBadRequest)
+		return false
+	}
+	if strings.TrimSpace(request.Title) == "" {
+		http.Error(w, "title is required", http.StatusBadRequest)
+		return false
+	}
+	if request.BufferBeforeMinutes < 0 || request.BufferAfterMinutes < 0 || request.MinNoticeMinutes < 0 || request.MaxPerDay < 0 {
+		http.Error(w, "Buffers, minNoticeMinutes and maxPerDay can't be negative", http.StatusBadRequest)
+		return false
+	}
+	if request.HorizonDays < 0 || request.HorizonDays > maxHorizonDays {
+		http.Error(w, fmt.Sprintf("horizonDays must be between 1 and %d", maxHorizonDays), http.StatusBadRequest)
+		return false
+	}
+
+	timeZone, ok := eventTimeZone(w, request.TimeZone, user)
+	if !ok {
+		return false
+	}
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+
+	availability := request.Availability
+	if len(availability) == 0 {
+		availability = []models.AvailabilityWindow{{
+			Days:  []string{"mon", "tue", "wed", "thu", "fri"},
+			Start: "09:00",
+			End:   "17:00",
+		}}
+	}
+	if _, err := parseAvailability(availability); err != nil {
+		http.Error(w, "Invalid availability: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	seen := map[string]bool{}
+	for i := range request.Questions {
+		question := &request.Questions[i]
+		if strings.TrimSpace(question.Label) == "" {
+			http.Error(w, "Every question needs a label", http.StatusBadRequest)
+			return false
+		}
+		if question.ID == "" {
+			question.ID = "q" + strconv.Itoa(i+1)
+		}
+		if seen[question.ID] {
+			http.Error(w, fmt.Sprintf("Question ID %q is used twice", question.ID), http.StatusBadRequest)
+			return false
+		}
+		seen[question.ID] = true
+	}
+
+	bookingType.Title = request.Title
+	bookingType.Description = request.Description
+	bookingType.DurationMinutes = request.DurationMinutes
+	bookingType.Availability = availability
+	bookingType.TimeZone = timeZone
+	bookingType.BufferBeforeMinutes = request.BufferBeforeMinutes
+	bookingType.BufferAfterMinutes = request.BufferAfterMinutes
+	bookingType.MinNoticeMinutes = request.MinNoticeMinutes
+	bookingType.HorizonDays = request.HorizonDays
+	if bookingType.HorizonDays == 0 {
+		bookingType.HorizonDays = defaultHorizonDays
+	}
+	bookingType.MaxPerDay = request.MaxPerDay
+	bookingType.Questions = request.Questions
+	bookingType.Active = request.Active == nil || *request.Active
+	return true
+}
+
+// parseAvailability converts the availability windows of a booking type
+func parseAvailability(windows []models.AvailabilityWindow) ([]calendar.WorkingHours, error) {
+	var availability []calendar.WorkingHours
+	for _, window := range windows {
+		var days []time.Weekday
+		for _, name := range window.Days {
+			day, ok := parseWeekday(name)
+			if !ok {
+				return nil, fmt.Errorf("invalid day %q", name)
+			}
+			days = append(days, day)
+		}
+		hours, err := calendar.ParseWorkingHours(window.Start, window.End, days)
+		if err != nil {
+			return nil, err
+		}
+		availability = append(availability, hours)
+	}
+	return availability, nil
+}
+
+func bookingTypeResponse(bookingType *models.BookingType) map[string]interface{} {
+	return map[string]interface{}{
+		"slug":                bookingType.Slug,
+		"url":                 bookingURL(bookingType.UserID, bookingType.Slug),
+		"title":               bookingType.Title,
+		"description":         bookingType.Description,
+		"durationMinutes":     bookingType.DurationMinutes,
+		"availability":        bookingType.Availability,
+		"timeZone":            bookingType.TimeZone,
+		"bufferBeforeMinutes": bookingType.BufferBeforeMinutes,
+		"bufferAfterMinutes":  bookingType.BufferAfterMinutes,
+		"minNoticeMinutes":    bookingType.MinNoticeMinutes,
+		"horizonDays":         bookingType.HorizonDays,
+		"maxPerDay":           bookingType.MaxPerDay,
+		"questions":           bookingType.Questions,
+		"active":              bookingType.Active,
+	}
+}
+
+// BookingPage serves the public page on which guests pick a slot
+func (h *Handler) BookingPage(w http.ResponseWriter, r *http.Request) {
+	owner, bookingType, ok := h.bookingTarget(w, r)
+	if !ok {
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/book.html")
+	if err != nil {
+		log.Printf("Error parsing booking page template: %v", err)
+		http.Error(w, "Failed to load booking page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Owner":       owner.Name,
+		"Title":       bookingType.Title,
+		"Description": bookingType.Description,
+		"Duration":    bookingType.DurationMinutes,
+		"Questions":   bookingType.Questions,
+	})
+	if err != nil {
+		log.Printf("Error executing booking page template: %v", err)
+	}
+}
+
+// BookingSlots lists the free slots of a booking type. The window defaults
+// to the next week and can be set with from/to (RFC3339 or YYYY-MM-DD);
+// timeZone picks the zone dates are read and times written in.
+func (h *Handler) BookingSlots(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	owner, bookingType, ok := h.bookingTarget(w, r)
+	if !ok {
+		return
+	}
+
+	loc, err := calendar.LoadTimeZone(bookingType.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	if name := query.Get("timeZone"); name != "" {
+		if loc, err = calendar.LoadTimeZone(name); err != nil {
+			http.Error(w, "Invalid timeZone: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now().In(loc)
+	from, err := parseTimeParam(query.Get("from"), now, loc)
+	if err != nil {
+		http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"), from.AddDate(0, 0, 7), loc)
+	if err != nil {
+		http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if horizon := now.AddDate(0, 0, bookingType.HorizonDays); to.After(horizon) {
+		to = horizon
+	}
+	if from.Before(now) {
+		from = now
+	}
+	if to.Sub(from) > maxFreeBusyWindow {
+		http.Error(w, "The requested window may span at most 62 days", http.StatusBadRequest)
+		return
+	}
+
+	slots := []map[string]interface{}{}
+	if to.After(from) {
+		open, err := h.openSlots(r.Context(), owner, bookingType, from, to)
+		if err != nil {
+			log.Printf("Error finding slots of booking type %s of user %d: %v", bookingType.Slug, owner.ID, err)
+			http.Error(w, "Failed to load availability", calendarErrorStatus(err))
+			return
+		}
+		for _, slot := range open {
+			slots = append(slots, map[string]interface{}{
+				"startTime": slot.Start.In(loc).Format(time.RFC3339),
+				"endTime":   slot.End.In(loc).Format(time.RFC3339),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"title":           bookingType.Title,
+		"durationMinutes": bookingType.DurationMinutes,
+		"timeZone":        loc.String(),
+		"slots":           slots,
+	})
+}
+
+// BookSlot books a slot of a booking type for a guest. The meeting is
+// created in the owner's default calendar with the guest invited, so the
+// calendar provider emails them the invitation.
+func (h *Handler) BookSlot(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		StartTime string `json:"startTime"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		// Answers maps question IDs to the guest's answers
+		Answers map[string]string `json:"answers"`
+	}
+
+	if !decodePublicJSON(w, r, &request) {
+		return
+	}
+
+	owner, bookingType, ok := h.bookingTarget(w, r)
+	if !ok {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, request.StartTime)
+	if err != nil {
+		http.Error(w, "startTime must be an RFC3339 time", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	address, err := mail.ParseAddress(request.Email)
+	if err != nil {
+		http.Error(w, "Invalid email: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	answers, err := bookingAnswers(bookingType, request.Answers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	end := start.Add(time.Duration(bookingType.DurationMinutes) * time.Minute)
+	if start.After(time.Now().AddDate(0, 0, bookingType.HorizonDays)) {
+		http.Error(w, "This slot is too far ahead", http.StatusBadRequest)
+		return
+	}
+
+	// Check the slot is still free and book it before anyone else can.
+	// The lock covers this instance; the booking row, unique per slot,
+	// covers other instances of the server.
+	defer h.bookingLocks.lock(owner.ID)()
+
+	open, err := h.openSlots(r.Context(), owner, bookingType, start, end)
+	if err != nil {
+		log.Printf("Error checking slot of booking type %s of user %d: %v", bookingType.Slug, owner.ID, err)
+		http.Error(w, "Failed to check availability", calendarErrorStatus(err))
+		return
+	}
+	available := false
+	for _, slot := range open {
+		if slot.Start.Equal(start) {
+			available = true
+			break
+		}
+	}
+	if !available {
+		http.Error(w, "This slot is no longer available", http.StatusConflict)
+		return
+	}
+
+	provider, err := h.Calendars(r.Context(), owner)
+	if err != nil {
+		log.Printf("Error creating calendar provider: %v", err)
+		http.Error(w, "Failed to load calendar credentials", http.StatusInternalServerError)
+		return
+	}
+
+	// Reserve the slot before creating the event
+	booking := &models.Booking{
+		BookingTypeID: bookingType.ID,
+		UserID:        owner.ID,
+		GuestName:     name,
+		GuestEmail:    address.Address,
+		Answers:       answers,
+		StartTime:     start,
+		EndTime:       end,
+	}
+	reserved, err := h.Bookings.CreateBooking(booking)
+	if err != nil {
+		log.Printf("Error saving booking of type %s of user %d: %v", bookingType.Slug, owner.ID, err)
+		http.Error(w, "Failed to book the meeting", http.StatusInternalServerError)
+		return
+	}
+	if !reserved {
+		http.Error(w, "This slot is no longer available", http.StatusConflict)
+		return
+	}
+
+	event := calendar.NewEvent(
+		bookingType.Title+" with "+name,
+		start.Format(time.RFC3339),
+		end.Format(time.RFC3339),
+		bookingDescription(bookingType, name, address.Address, answers),
+		[]string{address.Address},
+		bookingType.TimeZone,
+	)
+	event.Attendees[0].DisplayName = name
+
+	log.Printf("Booking %s for user %d at %s", bookingType.Slug, owner.ID, start.Format(time.RFC3339))
+
+	target := defaultCalendar(r.Context(), owner, provider)
+	created, err := target.CreateEvent(r.Context(), event, calendar.WriteOptions{SendUpdates: h.providerUpdates(target, calendar.SendUpdatesAll)})
+	if err != nil {
+		log.Printf("Error creating booked event: %v", err)
+		if err := h.Bookings.DeleteBooking(booking.ID); err != nil {
+			log.Printf("Error releasing booking %d: %v", booking.ID, err)
+		}
+		http.Error(w, "Failed to book the meeting", calendarErrorStatus(err))
+		return
+	}
+
+	if err := h.Bookings.SetBookingEvent(booking.ID, created.Id); err != nil {
+		// The meeting exists and the slot stays taken; only the link is missing
+		log.Printf("Error saving event %s of booking %d: %v", created.Id, booking.ID, err)
+	}
+	h.mailAttendees(target, owner, created.Id, calendar.SendUpdatesAll, func(ctx context.Context, mailer MeetingMailer) error {
+		return mailer.MeetingCreated(ctx, owner, created, calendar.SendUpdatesAll)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Your meeting is booked. An invitation is on its way to " + address.Address,
+		"title":     event.Summary,
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   end.Format(time.RFC3339),
+	})
+}
+
+// bookingTarget loads the owner and booking type a public booking URL
+// refers to, writing a 404 and returning false if there is no such active
+// booking type
+func (h *Handler) bookingTarget(w http.ResponseWriter, r *http.Request) (*models.User, *models.BookingType, bool) {
+	if !h.bookingsEnabled(w) {
+		return nil, nil, false
+	}
+
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["user"])
+	if err != nil {
+		http.Error(w, "Booking page not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	bookingType, err := h.Bookings.GetBookingType(userID, vars["type"])
+	if err != nil {
+		log.Printf("Error loading booking type: %v", err)
+		http.Error(w, "Failed to load booking page", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if bookingType == nil || !bookingType.Active {
+		http.Error(w, "Booking page not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	owner, err := h.Users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error loading owner %d of booking type: %v", userID, err)
+		http.Error(w, "Booking page not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return owner, bookingType, true
+}
+
+// openSlots finds the bookable slots of a booking type within the window,
+// given the owner's busy times and the bookings already made
+func (h *Handler) openSlots(ctx context.Context, owner *models.User, bookingType *models.BookingType, from, to time.Time) ([]calendar.Interval, error) {
+	availability, err := parseAvailability(bookingType.Availability)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid availability: %v", calendar.ErrInvalidRequest, err)
+	}
+	loc, err := calendar.LoadTimeZone(bookingType.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", calendar.ErrInvalidRequest, err)
+	}
+
+	provider, err := h.Calendars(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	before := time.Duration(bookingType.BufferBeforeMinutes) * time.Minute
+	after := time.Duration(bookingType.BufferAfterMinutes) * time.Minute
+	calendars := []string{owner.Email}
+	if owner.DefaultCalendarID != "" {
+		calendars = append(calendars, owner.DefaultCalendarID)
+	}
+	busy, err := provider.FreeBusy(ctx, from.Add(-after), to.Add(before), calendars)
+	if err != nil {
+		return nil, err
+	}
+	var intervals []calendar.Interval
+	for _, periods := range busy {
+		for _, period := range periods {
+			if interval, err := calendar.ParseTimePeriod(period); err == nil {
+				intervals = append(intervals, interval)
+			}
+		}
+	}
+
+	// Bookings are counted per day in the booking type's zone
+	local := from.In(loc)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	local = to.In(loc)
+	dayEnd := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+	bookings, err := h.Bookings.ListBookings(bookingType.ID, dayStart, dayEnd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load bookings: %w", err)
+	}
+	bookings, err = h.activeBookings(ctx, defaultCalendar(ctx, owner, provider), bookings, dayStart, dayEnd)
+	if err != nil {
+		return nil, err
+	}
+	booked := map[string]int{}
+	for _, booking := range bookings {
+		booked[booking.StartTime.In(loc).Format("2006-01-02")]++
+	}
+
+	return calendar.BookableSlots(calendar.SlotOptions{
+		Duration:     time.Duration(bookingType.DurationMinutes) * time.Minute,
+		Availability: availability,
+		Location:     loc,
+		WindowStart:  from,
+		WindowEnd:    to,
+		Busy:         intervals,
+		BufferBefore: before,
+		BufferAfter:  after,
+		MinNotice:    time.Duration(bookingType.MinNoticeMinutes) * time.Minute,
+		MaxPerDay:    bookingType.MaxPerDay,
+		Booked:       booked,
+	}), nil
+}
+
+// bookingAnswers checks a guest's answers against the booking type's
+// questions and returns them trimmed, without empty ones
+func bookingAnswers(bookingType *models.BookingType, answers map[string]string) (map[string]string, error) {
+	questions := map[string]bool{}
+	for _, question := range bookingType.Questions {
+		questions[question.ID] = true
+	}
+	for id := range answers {
+		if !questions[id] {
+			return nil, fmt.Errorf("%q is not a question of this booking page", id)
+		}
+	}
+
+	cleaned := map[string]string{}
+	for _, question := range bookingType.Questions {
+		answer := strings.TrimSpace(answers[question.ID])
+		if question.Required && answer == "" {
+			return nil, fmt.Errorf("Please answer %q", question.Label)
+		}
+		if utf8.RuneCountInString(answer) > maxAnswerLength {
+			return nil, fmt.Errorf("The answer to %q may be at most %d characters", question.Label, maxAnswerLength)
+		}
+		if answer != "" {
+			cleaned[question.ID] = answer
+		}
+	}
+	return cleaned, nil
+}
+
+// activeBookings leaves out the bookings whose event was cancelled,
+// deleted or moved in the owner's calendar, and cancels them so their
+// slots can be booked again. Bookings still waiting for their event are
+// kept for bookingPendingTimeout.
+func (h *Handler) activeBookings(ctx context.Context, provider calendar.CalendarProvider, bookings []models.Booking, from, to time.Time) ([]models.Booking, error) {
+	if len(bookings) == 0 {
+		return bookings, nil
+	}
+	page, err := provider.ListEvents(ctx, calendar.ListOptions{TimeMin: from, TimeMax: to})
+	if err != nil {
+		return nil, fmt.Errorf("unable to check booked events: %w", err)
+	}
+	starts := map[string]time.Time{}
+	for _, event := range page.Items {
+		if start, err := calendar.ParseEventDateTime(event.Start); err == nil && event.Status != "cancelled" {
+			starts[event.Id] = start
+		}
+	}
+
+	var active []models.Booking
+	for _, booking := range bookings {
+		if booking.EventID == "" {
+			if time.Since(booking.CreatedAt) < bookingPendingTimeout {
+				active = append(active, booking)
+				continue
+			}
+		} else if start, ok := starts[booking.EventID]; ok && start.Equal(booking.StartTime) {
+			active = append(active, booking)
+			continue
+		} else if !ok && !bookedEventGone(ctx, provider, &booking) {
+			// Not listed, but it may only have been missed by a cache
+			active = append(active, booking)
+			continue
+		}
+
+		if err := h.Bookings.CancelBooking(booking.ID); err != nil {
+			return nil, fmt.Errorf("unable to release booking: %w", err)
+		}
+		log.Printf("Released booking %d of user %d at %s: its event is gone", booking.ID, booking.UserID, booking.StartTime.Format(time.RFC3339))
+	}
+	return active, nil
+}
+
+// bookedEventGone asks the calendar whether a booking's event was
+// cancelled, deleted or moved. Errors count as not gone.
+func bookedEventGone(ctx context.Context, provider calendar.CalendarProvider, booking *models.Booking) bool {
+	event, err := provider.GetEvent(ctx, booking.EventID)
+	if errors.Is(err, calendar.ErrNotFound) {
+		return true
+	}
+	if err != nil {
+		log.Printf("Unable to check event %s of booking %d: %v", booking.EventID, booking.ID, err)
+		return false
+	}
+	start, err := calendar.ParseEventDateTime(event.Start)
+	return event.Status == "cancelled" || (err == nil && !start.Equal(booking.StartTime))
+}
+
+// bookingDescription is the description of a booked meeting: the booking
+// type's, followed by who booked it and their answers
+func bookingDescription(bookingType *models.BookingType, name, email string, answers map[string]string) string {
+	var b strings.Builder
+	if bookingType.Description != "" {
+		b.WriteString(bookingType.Description + "\n\n")
+	}
+	fmt.Fprintf(&b, "Booked by %s <%s>", name, email)
+	for _, question := range bookingType.Questions {
+		if answer := strings.TrimSpace(answers[question.ID]); answer != "" {
+			fmt.Fprintf(&b, "\n\n%s\n%s", question.Label, answer)
+		}
+	}
+	return b.String()
+}
+
+// bookingsEnabled writes a 404 and returns false when booking pages are
+// turned off
+func (h *Handler) bookingsEnabled(w http.ResponseWriter) bool {
+	if h.Bookings == nil {
+		http.Error(w, "Booking pages are not enabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// bookingURL is the public page of a booking type
+func bookingURL(userID int, slug string) string {
+	return "/book/" + strconv.Itoa(userID) + "/" + url.PathEscape(slug)
+}
@@ -0,0 +1,334 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// testBookings is a BookingStore in memory with one booking type, "intro"
+// of user 1, and the unique index of the bookings table on active slots
+type testBookings struct {
+	mu       sync.Mutex
+	bookings []models.Booking
+	nextID   uint
+	// questions are asked by the booking type
+	questions []models.BookingQuestion
+}
+
+var introType = models.BookingType{
+	ID:              1,
+	UserID:          1,
+	Slug:            "intro",
+	Title:           "Intro call",
+	DurationMinutes: 30,
+	Availability:    []models.AvailabilityWindow{{Days: []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}, Start: "00:00", End: "23:59"}},
+	TimeZone:        "UTC",
+	HorizonDays:     30,
+	Active:          true,
+}
+
+func (s *testBookings) ListBookingTypes(userID int) ([]models.BookingType, error) {
+	return []models.BookingType{introType}, nil
+}
+
+func (s *testBookings) GetBookingType(userID int, slug string) (*models.BookingType, error) {
+	if userID != introType.UserID || slug != introType.Slug {
+		return nil, nil
+	}
+	bookingType := introType
+	bookingType.Questions = s.questions
+	return &bookingType, nil
+}
+
+func (s *testBookings) SaveBookingType(bookingType *models.BookingType) error { return nil }
+
+func (s *testBookings) DeleteBookingType(userID int, slug string) error { return nil }
+
+func (s *testBookings) ListBookings(bookingTypeID uint, from, to time.Time) ([]models.Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var bookings []models.Booking
+	for _, booking := range s.bookings {
+		if booking.BookingTypeID == bookingTypeID && booking.CancelledAt == nil && !booking.StartTime.Before(from) && booking.StartTime.Before(to) {
+			bookings = append(bookings, booking)
+		}
+	}
+	return bookings, nil
+}
+
+func (s *testBookings) CreateBooking(booking *models.Booking) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.bookings {
+		if existing.BookingTypeID == booking.BookingTypeID && existing.StartTime.Equal(booking.StartTime) && existing.CancelledAt == nil {
+			return false, nil
+		}
+	}
+	s.nextID++
+	booking.ID = s.nextID
+	if booking.CreatedAt.IsZero() {
+		booking.CreatedAt = time.Now()
+	}
+	s.bookings = append(s.bookings, *booking)
+	return true, nil
+}
+
+func (s *testBookings) SetBookingEvent(id uint, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.bookings {
+		if s.bookings[i].ID == id {
+			s.bookings[i].EventID = eventID
+		}
+	}
+	return nil
+}
+
+func (s *testBookings) DeleteBooking(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.bookings {
+		if s.bookings[i].ID == id {
+			s.bookings = append(s.bookings[:i], s.bookings[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *testBookings) CancelBooking(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.bookings {
+		if s.bookings[i].ID == id && s.bookings[i].CancelledAt == nil {
+			now := time.Now()
+			s.bookings[i].CancelledAt = &now
+		}
+	}
+	return nil
+}
+
+// active counts the bookings that hold their slot
+func (s *testBookings) active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, booking := range s.bookings {
+		if booking.CancelledAt == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// failingCalendar refuses to create events
+type failingCalendar struct {
+	calendar.CalendarProvider
+}
+
+func (failingCalendar) CreateEvent(ctx context.Context, event *calendarapi.Event, opts calendar.WriteOptions) (*calendarapi.Event, error) {
+	return nil, errors.New("calendar unavailable")
+}
+
+// bookingJSON is a BookSlot body for the slot starting at start
+func bookingJSON(start time.Time, email string) string {
+	return fmt.Sprintf(`{"startTime":%q,"name":"Guest","email":%q}`, start.Format(time.RFC3339), email)
+}
+
+func TestBookSlot(t *testing.T) {
+	start := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Hour)
+
+	tests := []struct {
+		name string
+		// reserved is a booking of the slot made elsewhere, e.g. by
+		// another server still creating its event
+		reserved  bool
+		failing   bool
+		target    string
+		body      string
+		status    int
+		remaining int
+	}{
+		{"booked", false, false, "/book/1/intro", bookingJSON(start, "guest@example.com"), http.StatusCreated, 1},
+		{"reserved elsewhere", true, false, "/book/1/intro", bookingJSON(start, "guest@example.com"), http.StatusConflict, 1},
+		{"event fails, slot released", false, true, "/book/1/intro", bookingJSON(start, "guest@example.com"), http.StatusInternalServerError, 0},
+		{"unknown booking type", false, false, "/book/1/sales", bookingJSON(start, "guest@example.com"), http.StatusNotFound, 0},
+		{"invalid email", false, false, "/book/1/intro", bookingJSON(start, "guest"), http.StatusBadRequest, 0},
+		{"outside the horizon", false, false, "/book/1/intro", bookingJSON(start.AddDate(0, 0, 60), "guest@example.com"), http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bookings := &testBookings{}
+			if tt.reserved {
+				bookings.CreateBooking(&models.Booking{BookingTypeID: introType.ID, UserID: 1, StartTime: start, EndTime: start.Add(30 * time.Minute)})
+			}
+			calendars := calendar.NewMemoryProviderFactory()
+			if tt.failing {
+				memory := calendars
+				calendars = func(ctx context.Context, user *models.User) (calendar.CalendarProvider, error) {
+					provider, err := memory(ctx, user)
+					return failingCalendar{provider}, err
+				}
+			}
+			h := NewHandler(&testUsers{}, calendars)
+			h.Bookings = bookings
+
+			rec := serve(newBookingRouter(h), 0, "POST", tt.target, tt.body)
+			expectStatus(t, rec, tt.status)
+			if len(bookings.bookings) != tt.remaining {
+				t.Errorf("%d bookings stored, want %d", len(bookings.bookings), tt.remaining)
+			}
+			if tt.status == http.StatusCreated && bookings.bookings[0].EventID == "" {
+				t.Error("booking wasn't linked to its event")
+			}
+		})
+	}
+}
+
+func TestBookSlotConcurrently(t *testing.T) {
+	start := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Hour)
+	h := NewHandler(&testUsers{}, calendar.NewMemoryProviderFactory())
+	bookings := &testBookings{}
+	h.Bookings = bookings
+	router := newBookingRouter(h)
+
+	const guests = 8
+	statuses := make(chan int, guests)
+	var wg sync.WaitGroup
+	for i := 0; i < guests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := serve(router, 0, "POST", "/book/1/intro", bookingJSON(start, fmt.Sprintf("guest%d@example.com", i)))
+			statuses <- rec.Code
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != guests-1 {
+		t.Errorf("statuses = %v, want one %d and %d %d", counts, http.StatusCreated, guests-1, http.StatusConflict)
+	}
+	if len(bookings.bookings) != 1 {
+		t.Errorf("%d bookings stored, want 1", len(bookings.bookings))
+	}
+}
+
+func TestRebookSlotAfterEventIsGone(t *testing.T) {
+	start := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Hour)
+
+	tests := []struct {
+		name string
+		// free makes the slot's booking stale, given the booked event
+		free func(ctx context.Context, provider calendar.CalendarProvider, bookings *testBookings, eventID string) error
+	}{
+		{"event deleted", func(ctx context.Context, provider calendar.CalendarProvider, bookings *testBookings, eventID string) error {
+			return provider.DeleteEvent(ctx, eventID, calendar.WriteOptions{})
+		}},
+		{"event moved", func(ctx context.Context, provider calendar.CalendarProvider, bookings *testBookings, eventID string) error {
+			_, err := provider.PatchEvent(ctx, eventID, &calendarapi.Event{
+				Start: &calendarapi.EventDateTime{DateTime: start.AddDate(0, 0, 1).Format(time.RFC3339)},
+				End:   &calendarapi.EventDateTime{DateTime: start.AddDate(0, 0, 1).Add(30 * time.Minute).Format(time.RFC3339)},
+			}, calendar.WriteOptions{})
+			return err
+		}},
+		{"event never created", func(ctx context.Context, provider calendar.CalendarProvider, bookings *testBookings, eventID string) error {
+			bookings.mu.Lock()
+			defer bookings.mu.Unlock()
+			bookings.bookings[0].EventID = ""
+			bookings.bookings[0].CreatedAt = time.Now().Add(-time.Hour)
+			return provider.DeleteEvent(ctx, eventID, calendar.WriteOptions{})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calendars := calendar.NewMemoryProviderFactory()
+			h := NewHandler(&testUsers{}, calendars)
+			bookings := &testBookings{}
+			h.Bookings = bookings
+			router := newBookingRouter(h)
+
+			rec := serve(router, 0, "POST", "/book/1/intro", bookingJSON(start, "first@example.com"))
+			expectStatus(t, rec, http.StatusCreated)
+			rec = serve(router, 0, "POST", "/book/1/intro", bookingJSON(start, "second@example.com"))
+			expectStatus(t, rec, http.StatusConflict)
+
+			ctx := context.Background()
+			provider, _ := calendars(ctx, &models.User{ID: 1, Email: "user1@example.com"})
+			if err := tt.free(ctx, provider, bookings, bookings.bookings[0].EventID); err != nil {
+				t.Fatal(err)
+			}
+
+			rec = serve(router, 0, "GET", "/book/1/intro/slots?from="+start.Format(time.RFC3339)+"&to="+start.Add(time.Hour).Format(time.RFC3339), "")
+			expectStatus(t, rec, http.StatusOK)
+			if slots, _ := decodeJSON(t, rec)["slots"].([]interface{}); len(slots) == 0 {
+				t.Error("freed slot isn't offered")
+			}
+			rec = serve(router, 0, "POST", "/book/1/intro", bookingJSON(start, "second@example.com"))
+			expectStatus(t, rec, http.StatusCreated)
+			if got := bookings.active(); got != 1 {
+				t.Errorf("%d active bookings, want 1", got)
+			}
+		})
+	}
+}
+
+func TestBookSlotAnswers(t *testing.T) {
+	start := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Hour)
+	body := func(answers string) string {
+		return fmt.Sprintf(`{"startTime":%q,"name":"Guest","email":"guest@example.com","answers":%s}`, start.Format(time.RFC3339), answers)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		stored map[string]string
+	}{
+		{"answered", body(`{"topic":"  Pricing  ","phone":""}`), http.StatusCreated, map[string]string{"topic": "Pricing"}},
+		{"required answer missing", body(`{"phone":"555"}`), http.StatusBadRequest, nil},
+		{"unknown question", body(`{"topic":"Pricing","extra":"x"}`), http.StatusBadRequest, nil},
+		{"answer too long", body(fmt.Sprintf(`{"topic":%q}`, strings.Repeat("a", maxAnswerLength+1))), http.StatusBadRequest, nil},
+		{"body too large", body(fmt.Sprintf(`{"topic":%q}`, strings.Repeat("a", maxPublicBodySize))), http.StatusRequestEntityTooLarge, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler()
+			bookings := &testBookings{questions: []models.BookingQuestion{
+				{ID: "topic", Label: "What would you like to discuss?", Required: true},
+				{ID: "phone", Label: "Phone number"},
+			}}
+			h.Bookings = bookings
+
+			rec := serve(newBookingRouter(h), 0, "POST", "/book/1/intro", tt.body)
+			expectStatus(t, rec, tt.status)
+			if tt.stored == nil {
+				if len(bookings.bookings) != 0 {
+					t.Errorf("%d bookings stored, want none", len(bookings.bookings))
+				}
+				return
+			}
+			if len(bookings.bookings) != 1 || !reflect.DeepEqual(bookings.bookings[0].Answers, tt.stored) {
+				t.Errorf("stored bookings %+v, want answers %v", bookings.bookings, tt.stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"encoding/json"
+	"goauthDemo/calendar"
+	"log"
+	"net/http"
+)
+
+// ListCalendars lists the calendars the signed-in user can schedule
+// meetings in, such as shared team calendars and room calendars, and
+// which of them is their default
+func (h *Handler) ListCalendars(w http.ResponseWriter, r *http.Request) {
+	user, provider, ok := h.primaryCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	calendars, err := provider.ListCalendars(r.Context())
+	if err != nil {
+		log.Printf("Error listing calendars: %v", err)
+		http.Error(w, "Failed to list calendars: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	defaultID := user.DefaultCalendarID
+	if defaultID == "" {
+		for _, info := range calendars {
+			if info.Primary {
+				defaultID = info.ID
+				break
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"calendars":         calendars,
+		"defaultCalendarId": defaultID,
+	})
+}
+
+// SetDefaultCalendar changes the calendar meetings go to when a request
+// has no calendarId. An empty calendarId goes back to the primary calendar.
+func (h *Handler) SetDefaultCalendar(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		CalendarID string `json:"calendarId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, provider, ok := h.primaryCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	if request.CalendarID != "" && request.CalendarID != calendar.PrimaryCalendar {
+		calendars, err := provider.ListCalendars(r.Context())
+		if err != nil {
+			log.Printf("Error listing calendars: %v", err)
+			http.Error(w, "Failed to list calendars: "+err.Error(), calendarErrorStatus(err))
+			return
+		}
+
+		var selected *calendar.CalendarInfo
+		for _, info := range calendars {
+			if info.ID == request.CalendarID {
+				selected = info
+				break
+			}
+		}
+		if selected == nil {
+			http.Error(w, "Calendar not found: "+request.CalendarID, http.StatusNotFound)
+			return
+		}
+		if selected.AccessRole == "reader" || selected.AccessRole == "freeBusyReader" {
+			http.Error(w, "Meetings can't be created in a read-only calendar", http.StatusBadRequest)
+			return
+		}
+		if selected.Primary {
+			request.CalendarID = ""
+		}
+	} else {
+		request.CalendarID = ""
+	}
+
+	if err := h.Users.UpdateDefaultCalendar(user.ID, request.CalendarID); err != nil {
+		log.Printf("Error saving default calendar: %v", err)
+		http.Error(w, "Failed to save default calendar", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d switched default calendar to %q", user.ID, request.CalendarID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Default calendar updated successfully!",
+	})
+}
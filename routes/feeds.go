@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"goauthDemo/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// feedPast and feedAhead are the window a calendar feed covers
+	feedPast  = 30 * 24 * time.Hour
+	feedAhead = 180 * 24 * time.Hour
+)
+
+// GetFeed reports whether the signed-in user has a calendar feed. The URL
+// itself is only shown when the feed is created.
+func (h *Handler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := h.Feeds.GetFeedToken(user.ID)
+	if err != nil {
+		log.Printf("Error loading feed token of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to load feed", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{"enabled": token != nil}
+	if token != nil {
+		response["createdAt"] = token.CreatedAt
+		response["lastUsedAt"] = token.LastUsedAt
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RotateFeed creates a secret feed URL for the signed-in user's default
+// calendar, which calendar apps can subscribe to without signing in. Any
+// earlier URL stops working.
+func (h *Handler) RotateFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		log.Printf("Error generating feed token: %v", err)
+		http.Error(w, "Failed to create feed", http.StatusInternalServerError)
+		return
+	}
+
+	feed := &models.FeedToken{UserID: user.ID, TokenHash: hashToken(token), CreatedAt: time.Now()}
+	if err := h.Feeds.SaveFeedToken(feed); err != nil {
+		log.Printf("Error saving feed token of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to create feed", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d created a new calendar feed URL", user.ID)
+
+	host := r.Host + "/feeds/" + token + ".ics"
+	scheme := "http://"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https://"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Keep this URL secret; anyone who has it can read your calendar",
+		"url":       scheme + host,
+		"webcalUrl": "webcal://" + host,
+		"createdAt": feed.CreatedAt,
+	})
+}
+
+// RevokeFeed turns the signed-in user's calendar feed off
+func (h *Handler) RevokeFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Feeds.DeleteFeedToken(user.ID); err != nil {
+		log.Printf("Error deleting feed token of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to revoke feed", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d revoked their calendar feed", user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Calendar feed revoked",
+	})
+}
+
+// CalendarFeed serves a user's default calendar as an iCalendar feed to
+// anyone with its secret URL, from a month back to half a year ahead
+func (h *Handler) CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsEnabled(w) {
+		return
+	}
+
+	feed, err := h.Feeds.FindFeedToken(hashToken(mux.Vars(r)["token"]))
+	if err != nil {
+		log.Printf("Error loading feed token: %v", err)
+		http.Error(w, "Failed to load feed", http.StatusInternalServerError)
+		return
+	}
+	if feed == nil {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+
+	user, err := h.Users.GetUserByID(feed.UserID)
+	if err != nil {
+		log.Printf("Error loading user %d of feed: %v", feed.UserID, err)
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+	provider, err := h.Calendars(r.Context(), user)
+	if err != nil {
+		log.Printf("Error creating calendar provider: %v", err)
+		http.Error(w, "Failed to load calendar credentials", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	body, err := encodeMeetings(r.Context(), user, defaultCalendar(r.Context(), user, provider), now.Add(-feedPast), now.Add(feedAhead))
+	if err != nil {
+		log.Printf("Error serving calendar feed of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to load calendar", calendarErrorStatus(err))
+		return
+	}
+
+	if err := h.Feeds.TouchFeedToken(feed.ID, now); err != nil {
+		log.Printf("Error recording use of feed of user %d: %v", user.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(body)
+}
+
+// feedsEnabled writes a 404 and returns false when feeds are turned off
+func (h *Handler) feedsEnabled(w http.ResponseWriter) bool {
+	if h.Feeds == nil {
+		http.Error(w, "Calendar feeds are not enabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// newToken generates a secret for a URL, such as a feed token
+func newToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashToken is how secret tokens are stored, so a leaked table doesn't
+// give access to anyone's calendar
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
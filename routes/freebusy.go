@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxFreeBusyCalendars is the most calendars Google answers for at once
+	maxFreeBusyCalendars = 50
+	// maxFreeBusyWindow is the longest range Graph's getSchedule accepts
+	maxFreeBusyWindow = 62 * 24 * time.Hour
+)
+
+// FreeBusy reports when the requested calendars (usually attendee email
+// addresses) are busy. Without calendars the signed-in user's own calendar
+// is checked.
+func (h *Handler) FreeBusy(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		TimeMin   string   `json:"timeMin"`
+		TimeMax   string   `json:"timeMax"`
+		Calendars []string `json:"calendars"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if request.TimeMin == "" || request.TimeMax == "" {
+		http.Error(w, "timeMin and timeMax are required", http.StatusBadRequest)
+		return
+	}
+	if len(request.Calendars) > maxFreeBusyCalendars {
+		http.Error(w, fmt.Sprintf("At most %d calendars can be checked at once", maxFreeBusyCalendars), http.StatusBadRequest)
+		return
+	}
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+	loc := userLocation(user)
+
+	timeMin, err := parseTimeParam(request.TimeMin, time.Time{}, loc)
+	if err != nil {
+		http.Error(w, "Invalid timeMin: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeMax, err := parseTimeParam(request.TimeMax, time.Time{}, loc)
+	if err != nil {
+		http.Error(w, "Invalid timeMax: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !timeMax.After(timeMin) {
+		http.Error(w, "timeMax must be after timeMin", http.StatusBadRequest)
+		return
+	}
+	if timeMax.Sub(timeMin) > maxFreeBusyWindow {
+		http.Error(w, "The requested window may span at most 62 days", http.StatusBadRequest)
+		return
+	}
+
+	calendars := request.Calendars
+	if len(calendars) == 0 {
+		calendars = []string{user.Email}
+	}
+
+	log.Printf("Querying free/busy for user %d: %v", user.ID, calendars)
+
+	busy, err := provider.FreeBusy(r.Context(), timeMin, timeMax, calendars)
+	if err != nil {
+		log.Printf("Error querying free/busy: %v", err)
+		http.Error(w, "Failed to query free/busy: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	// Calendars the provider couldn't look up are reported separately so
+	// they aren't mistaken for free ones
+	unavailable := []string{}
+	for _, id := range calendars {
+		if _, ok := busy[id]; !ok {
+			unavailable = append(unavailable, id)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"timeMin":     timeMin.Format(time.RFC3339),
+		"timeMax":     timeMax.Format(time.RFC3339),
+		"calendars":   busy,
+		"unavailable": unavailable,
+	})
+}
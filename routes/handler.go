@@ -0,0 +1,414 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"goauthDemo/calendar"
+	"goauthDemo/middleware"
+	"goauthDemo/models"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// UserStore looks up and updates the signed-in user.
+// *database.UserRepository satisfies it.
+type UserStore interface {
+	GetUserByID(id int) (*models.User, error)
+	UpdateCalendarBackend(userID int, backend, caldavURL, caldavUsername, caldavPassword string) error
+	UpdateUserTimeZone(userID int, timeZone string) error
+	UpdateDefaultCalendar(userID int, calendarID string) error
+}
+
+// FeedStore keeps the secret tokens of users' calendar feeds.
+// *database.FeedRepository satisfies it.
+type FeedStore interface {
+	// GetFeedToken and FindFeedToken return nil if there is no such token
+	GetFeedToken(userID int) (*models.FeedToken, error)
+	FindFeedToken(tokenHash string) (*models.FeedToken, error)
+	SaveFeedToken(token *models.FeedToken) error
+	DeleteFeedToken(userID int) error
+	TouchFeedToken(id uint, at time.Time) error
+}
+
+// BookingStore keeps users' booking types and the bookings made through
+// them. *database.BookingRepository satisfies it.
+type BookingStore interface {
+	ListBookingTypes(userID int) ([]models.BookingType, error)
+	// GetBookingType returns nil if the user has no such booking type
+	GetBookingType(userID int, slug string) (*models.BookingType, error)
+	SaveBookingType(bookingType *models.BookingType) error
+	DeleteBookingType(userID int, slug string) error
+	// ListBookings leaves out cancelled bookings
+	ListBookings(bookingTypeID uint, from, to time.Time) ([]models.Booking, error)
+	// CreateBooking reports false if the booking type already has a
+	// booking at that start time
+	CreateBooking(booking *models.Booking) (bool, error)
+	SetBookingEvent(id uint, eventID string) error
+	DeleteBooking(id uint) error
+	CancelBooking(id uint) error
+}
+
+// PollStore keeps meeting polls, their options and votes.
+// *database.PollRepository satisfies it.
+type PollStore interface {
+	ListPolls(userID int) ([]models.Poll, error)
+	// GetPoll, FindPollByToken and GetPollParticipant return nil if there
+	// is no such record
+	GetPoll(userID int, id uint) (*models.Poll, error)
+	FindPollByToken(tokenHash string) (*models.Poll, error)
+	CreatePoll(poll *models.Poll) error
+	UpdatePoll(poll *models.Poll) error
+	DeletePoll(userID int, id uint) error
+	ListPollParticipants(pollID uint) ([]models.PollParticipant, error)
+	GetPollParticipant(pollID uint, email string) (*models.PollParticipant, error)
+	SavePollParticipant(participant *models.PollParticipant) error
+}
+
+// ReminderStore keeps users' server reminder rules and the reminders sent
+// for them. *database.ReminderRepository satisfies it.
+type ReminderStore interface {
+	ListUserReminderRules(userID int) ([]models.ReminderRule, error)
+	CreateReminderRule(rule *models.ReminderRule) error
+	// DeleteReminderRule returns false if the user has no such rule
+	DeleteReminderRule(userID int, id uint) (bool, error)
+	ListReminderJobs(userID int, limit int) ([]models.ReminderJob, error)
+}
+
+// MeetingMailer emails attendees about changes to their meetings.
+// *notify.Mailer satisfies it. sendUpdates, all or externalOnly, says
+// which attendees to email.
+type MeetingMailer interface {
+	MeetingCreated(ctx context.Context, user *models.User, event *calendarapi.Event, sendUpdates string) error
+	// MeetingUpdated is told whether the meeting moved to other times
+	MeetingUpdated(ctx context.Context, user *models.User, previous, event *calendarapi.Event, moved bool, sendUpdates string) error
+	MeetingCancelled(ctx context.Context, user *models.User, event *calendarapi.Event, sendUpdates string) error
+}
+
+// Handler serves the meeting API. Its dependencies are injected so the
+// handlers can be exercised end to end against a calendar.MemoryProvider
+// without reaching Google.
+type Handler struct {
+	Users     UserStore
+	Calendars calendar.ProviderFactory
+	// Watches looks up push notification channels; nil disables the
+	// webhook receiver
+	Watches calendar.WatchStore
+	// Feeds keeps the tokens of subscribable calendar feeds; nil disables
+	// the feeds
+	Feeds FeedStore
+	// Bookings keeps booking types and bookings; nil disables booking pages
+	Bookings BookingStore
+	// Polls keeps meeting polls; nil disables them
+	Polls PollStore
+	// Reminders keeps the rules of the reminder scheduler; nil disables
+	// server reminders
+	Reminders ReminderStore
+	// Mail sends our own emails about created, moved and cancelled
+	// meetings instead of the calendar backend; nil, or a backend that
+	// always sends its own (calendar.InviteSender), leaves them to it
+	Mail MeetingMailer
+
+	// bookingLocks keeps two guests from booking the same owner's time at
+	// once; other owners' booking pages aren't held up
+	bookingLocks keyedMutex
+	// pollLocks keeps votes from racing with their poll being finalized,
+	// per poll
+	pollLocks keyedMutex
+}
+
+// keyedMutex hands out one mutex per key, e.g. per user
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[int]*sync.Mutex
+}
+
+// lock locks the mutex of key and returns its unlock function
+func (k *keyedMutex) lock(key int) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[int]*sync.Mutex)
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		k.locks[key] = lock
+	}
+	k.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// NewHandler creates a Handler with the given user store and calendar provider factory
+func NewHandler(users UserStore, calendars calendar.ProviderFactory) *Handler {
+	return &Handler{Users: users, Calendars: calendars}
+}
+
+// currentUser loads the signed-in user, writing an error response and
+// returning false on failure
+func (h *Handler) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	// Get user ID from context (set by middleware)
+	userID, err := middleware.UserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := h.Users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// primaryCalendar loads the signed-in user and their calendar provider
+// without selecting a calendar, writing an error response and returning
+// false on failure
+func (h *Handler) primaryCalendar(w http.ResponseWriter, r *http.Request) (*models.User, calendar.CalendarProvider, bool) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// Calendar credentials are resolved server-side from the users table
+	provider, err := h.Calendars(r.Context(), user)
+	if err != nil {
+		log.Printf("Error creating calendar provider: %v", err)
+		http.Error(w, "Failed to load calendar credentials", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	return user, provider, true
+}
+
+// userCalendar loads the signed-in user and their calendar provider,
+// writing an error response and returning false on failure. The provider
+// works on the calendar named by the calendarId query parameter, else on
+// the user's default calendar.
+func (h *Handler) userCalendar(w http.ResponseWriter, r *http.Request) (*models.User, calendar.CalendarProvider, bool) {
+	user, provider, ok := h.primaryCalendar(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if calendarID := r.URL.Query().Get("calendarId"); calendarID != "" {
+		selected, err := provider.WithCalendar(r.Context(), calendarID)
+		if err != nil {
+			log.Printf("Error opening calendar %q: %v", calendarID, err)
+			http.Error(w, "Unable to open calendar "+calendarID, calendarErrorStatus(err))
+			return nil, nil, false
+		}
+		return user, selected, true
+	}
+
+	return user, defaultCalendar(r.Context(), user, provider), true
+}
+
+// defaultCalendar selects the user's default calendar on their provider
+func defaultCalendar(ctx context.Context, user *models.User, provider calendar.CalendarProvider) calendar.CalendarProvider {
+	if user.DefaultCalendarID == "" {
+		return provider
+	}
+	selected, err := provider.WithCalendar(ctx, user.DefaultCalendarID)
+	if err != nil {
+		// The calendar may have been unshared; fall back to the primary one
+		log.Printf("Ignoring default calendar %q of user %d: %v", user.DefaultCalendarID, user.ID, err)
+		return provider
+	}
+	return selected
+}
+
+// eventTimeZone picks the zone for a new or changed event: the one in the
+// request if given, otherwise the user's. Writes an error response and
+// returns false if the requested zone isn't a valid IANA name.
+func eventTimeZone(w http.ResponseWriter, requested string, user *models.User) (string, bool) {
+	if requested == "" {
+		return user.TimeZone, true
+	}
+	if _, err := calendar.LoadTimeZone(requested); err != nil {
+		http.Error(w, "Invalid timeZone: "+err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return requested, true
+}
+
+// userLocation returns the zone response times are rendered in for the
+// user, falling back to the server's zone when none is stored
+func userLocation(user *models.User) *time.Location {
+	if user.TimeZone == "" {
+		return time.Local
+	}
+	loc, err := calendar.LoadTimeZone(user.TimeZone)
+	if err != nil {
+		log.Printf("Ignoring invalid time zone %q of user %d: %v", user.TimeZone, user.ID, err)
+		return time.Local
+	}
+	return loc
+}
+
+// maxPublicBodySize bounds the request bodies of the endpoints guests
+// use without signing in
+const maxPublicBodySize = 64 << 10
+
+// decodePublicJSON decodes the JSON body of a public endpoint into v,
+// refusing bodies over maxPublicBodySize. Writes an error response and
+// returns false if it can't.
+func decodePublicJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPublicBodySize)
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body is too large", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// sendUpdatesParam reads the sendUpdates query parameter, which decides
+// whether attendees are emailed about the change: by us when meeting
+// emails are on, otherwise by the calendar backend. Defaults to "all".
+func sendUpdatesParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	sendUpdates := r.URL.Query().Get("sendUpdates")
+	if sendUpdates == "" {
+		return calendar.SendUpdatesAll, true
+	}
+
+	if !calendar.ValidSendUpdates(sendUpdates) {
+		http.Error(w, "Invalid sendUpdates value: must be all, externalOnly or none", http.StatusBadRequest)
+		return "", false
+	}
+	return sendUpdates, true
+}
+
+// ownMail reports whether we email attendees about changes made through
+// provider ourselves: meeting emails must be on, and the backend must be
+// one that can be told not to send its own invitations
+func (h *Handler) ownMail(provider calendar.CalendarProvider) bool {
+	return h.Mail != nil && !calendar.SendsOwnInvites(provider)
+}
+
+// providerUpdates is the sendUpdates to pass to the calendar backend. When
+// we email attendees ourselves the backend is told not to, so they don't
+// get every invitation twice.
+func (h *Handler) providerUpdates(provider calendar.CalendarProvider, sendUpdates string) string {
+	if h.ownMail(provider) {
+		return calendar.SendUpdatesNone
+	}
+	return sendUpdates
+}
+
+// scopeParam reads the scope query parameter, which decides whether a
+// change to one instance of a recurring meeting also applies to the
+// following instances or the whole series. Defaults to "this".
+func scopeParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		return calendar.ScopeThis, true
+	}
+
+	if !calendar.ValidScope(scope) {
+		http.Error(w, "Invalid scope value: must be this, following or all", http.StatusBadRequest)
+		return "", false
+	}
+	return scope, true
+}
+
+// setRecurrence validates the recurrence of a meeting request and adds it
+// to the event. Recurring events need a time zone to expand in, so UTC is
+// used if none was chosen. Writes an error response and returns false if
+// the rules are invalid.
+func setRecurrence(w http.ResponseWriter, event *calendarapi.Event, recurrence []string) bool {
+	if len(recurrence) == 0 {
+		return true
+	}
+	if err := calendar.ValidateRecurrence(recurrence); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	event.Recurrence = recurrence
+	for _, dt := range []*calendarapi.EventDateTime{event.Start, event.End} {
+		if dt != nil && dt.TimeZone == "" {
+			dt.TimeZone = "UTC"
+		}
+	}
+	return true
+}
+
+// setReminders sets the reminders of an event, writing an error response
+// and returning false if they are invalid. Nil leaves them as they are.
+func setReminders(w http.ResponseWriter, event *calendarapi.Event, reminders *calendar.MeetingReminders) bool {
+	if reminders == nil {
+		return true
+	}
+	converted, err := calendar.NewReminders(reminders)
+	if err != nil {
+		http.Error(w, "Invalid reminders: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	event.Reminders = converted
+	return true
+}
+
+// mailTimeout bounds how long sending one meeting email may take
+const mailTimeout = time.Minute
+
+// mailAttendees runs send in the background if we email the attendees of
+// provider's events and sendUpdates doesn't turn it off, so a slow mail
+// server doesn't hold up the response
+func (h *Handler) mailAttendees(provider calendar.CalendarProvider, user *models.User, eventID, sendUpdates string, send func(ctx context.Context, mailer MeetingMailer) error) {
+	if !h.ownMail(provider) || sendUpdates == calendar.SendUpdatesNone {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := send(ctx, h.Mail); err != nil {
+			log.Printf("Error emailing attendees of event %s of user %d: %v", eventID, user.ID, err)
+		}
+	}()
+}
+
+// previousEvent loads an event before it is changed, for the emails
+// about the change. Returns nil if meeting emails are off or it can't be
+// loaded, which skips them.
+func (h *Handler) previousEvent(ctx context.Context, provider calendar.CalendarProvider, eventID, sendUpdates string) *calendarapi.Event {
+	if !h.ownMail(provider) || sendUpdates == calendar.SendUpdatesNone {
+		return nil
+	}
+	event, err := provider.GetEvent(ctx, eventID)
+	if err != nil {
+		log.Printf("Not emailing attendees of event %s: %v", eventID, err)
+		return nil
+	}
+	return event
+}
+
+// calendarErrorStatus maps calendar provider errors onto the status code
+// we should answer with
+func calendarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, calendar.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, calendar.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, calendar.ErrInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, calendar.ErrNotSupported):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/middleware"
+	"goauthDemo/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// testUsers is a UserStore in which every user ID exists, with the email
+// user<ID>@example.com
+type testUsers struct {
+	mu    sync.Mutex
+	users map[int]*models.User
+}
+
+func (s *testUsers) user(id int) *models.User {
+	if s.users == nil {
+		s.users = map[int]*models.User{}
+	}
+	if s.users[id] == nil {
+		s.users[id] = &models.User{ID: id, Email: fmt.Sprintf("user%d@example.com", id), Name: fmt.Sprintf("User %d", id)}
+	}
+	return s.users[id]
+}
+
+func (s *testUsers) GetUserByID(id int) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *s.user(id)
+	return &copied, nil
+}
+
+func (s *testUsers) UpdateCalendarBackend(userID int, backend, caldavURL, caldavUsername, caldavPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.user(userID)
+	user.CalendarBackend, user.CalDAVURL, user.CalDAVUsername, user.CalDAVPassword = backend, caldavURL, caldavUsername, caldavPassword
+	return nil
+}
+
+func (s *testUsers) UpdateUserTimeZone(userID int, timeZone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user(userID).TimeZone = timeZone
+	return nil
+}
+
+func (s *testUsers) UpdateDefaultCalendar(userID int, calendarID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user(userID).DefaultCalendarID = calendarID
+	return nil
+}
+
+// newTestHandler returns a Handler on in-memory calendars
+func newTestHandler() *Handler {
+	return NewHandler(&testUsers{}, calendar.NewMemoryProviderFactory())
+}
+
+// newTestRouter routes the signed-in API as main does, without the JWT
+// middleware; serve puts the user into the request instead
+func newTestRouter(h *Handler) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/create-meeting", h.CreateMeeting).Methods("POST")
+	r.HandleFunc("/upcoming-meetings", h.GetUpcomingMeetings).Methods("GET")
+	r.HandleFunc("/meetings/import", h.ImportMeetings).Methods("POST")
+	r.HandleFunc("/meetings/{id}/instances", h.ListMeetingInstances).Methods("GET")
+	r.HandleFunc("/meetings/{id}/rsvp", h.RespondToMeeting).Methods("POST")
+	r.HandleFunc("/meetings/{id}", h.GetMeeting).Methods("GET")
+	r.HandleFunc("/meetings/{id}", h.UpdateMeeting).Methods("PUT")
+	r.HandleFunc("/meetings/{id}", h.PatchMeeting).Methods("PATCH")
+	r.HandleFunc("/meetings/{id}", h.DeleteMeeting).Methods("DELETE")
+	r.HandleFunc("/calendar-backend", h.GetCalendarBackend).Methods("GET")
+	r.HandleFunc("/calendar-backend", h.SetCalendarBackend).Methods("PUT")
+	r.HandleFunc("/polls", h.CreatePoll).Methods("POST")
+	r.HandleFunc("/polls/{id}", h.GetPoll).Methods("GET")
+	r.HandleFunc("/polls/{id}/finalize", h.FinalizePoll).Methods("POST")
+	r.HandleFunc("/vote/{token}", h.VotePoll).Methods("POST")
+	r.HandleFunc("/vote/{token}/results", h.PollResults).Methods("GET")
+	r.HandleFunc("/reminders", h.CreateReminderRule).Methods("POST")
+	return r
+}
+
+// newBookingRouter routes the public booking pages as main does
+func newBookingRouter(h *Handler) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/book/{user}/{type}/slots", h.BookingSlots).Methods("GET")
+	r.HandleFunc("/book/{user}/{type}", h.BookSlot).Methods("POST")
+	return r
+}
+
+// serve sends a request signed in as userID, or signed out if it is 0
+func serve(handler http.Handler, userID int, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if userID != 0 {
+		claims := jwt.MapClaims{"user_id": float64(userID)}
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserCtxKey, claims))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeJSON decodes a JSON object response
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not a JSON object: %v: %s", err, rec.Body.String())
+	}
+	return body
+}
+
+// expectStatus fails the test unless the response has the status
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/ical"
+	"goauthDemo/models"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportSize bounds the iCalendar files /meetings/import accepts
+const maxImportSize = 5 << 20
+
+// maxImportEvents bounds the events of one import, each of which takes
+// calendar requests to look up and create
+const maxImportEvents = 500
+
+// ExportMeetings returns the meetings of /upcoming-meetings as an
+// iCalendar file that other calendar apps can import. The from/to
+// parameters work the same way.
+func (h *Handler) ExportMeetings(w http.ResponseWriter, r *http.Request) {
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+	loc := userLocation(user)
+
+	from, to, ok := listWindow(w, r, loc, 0, 7)
+	if !ok {
+		return
+	}
+
+	log.Printf("Exporting calendar events from %s to %s for user: %d", from.Format(time.RFC3339), to.Format(time.RFC3339), user.ID)
+
+	body, err := encodeMeetings(r.Context(), user, provider, from, to)
+	if err != nil {
+		log.Printf("Error exporting meetings: %v", err)
+		http.Error(w, "Failed to export meetings: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="meetings.ics"`)
+	w.Write(body)
+}
+
+// encodeMeetings writes the meetings within the window as an iCalendar
+// file. Recurring meetings are written as their series, with the listed
+// instances as overrides.
+func encodeMeetings(ctx context.Context, user *models.User, provider calendar.CalendarProvider, from, to time.Time) ([]byte, error) {
+	page, err := provider.ListEvents(ctx, calendar.ListOptions{TimeMin: from, TimeMax: to})
+	if err != nil {
+		return nil, err
+	}
+	events := calendar.WithSeries(ctx, provider, page.Items)
+
+	// Times are written in each meeting's own zone, falling back to the user's
+	opts := ical.Options{Name: "Meetings of " + user.Email, LocalTimes: true}
+	if _, err := calendar.LoadTimeZone(user.TimeZone); err == nil {
+		opts.TimeZone = user.TimeZone
+	}
+
+	var body bytes.Buffer
+	if err := ical.EncodeWithOptions(&body, events, opts); err != nil {
+		return nil, fmt.Errorf("unable to encode meetings: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+// ImportMeetings creates the events of an uploaded iCalendar file, sent as
+// the request body or as the "file" field of a multipart form. Events
+// whose UID is already in the calendar are skipped. With dryRun=true
+// nothing is created and the response previews what would be. Attendees
+// aren't emailed unless sendUpdates says so. Files with more than
+// maxImportEvents events are refused.
+func (h *Handler) ImportMeetings(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+	sendUpdates := calendar.SendUpdatesNone
+	if r.URL.Query().Get("sendUpdates") != "" {
+		var ok bool
+		if sendUpdates, ok = sendUpdatesParam(w, r); !ok {
+			return
+		}
+	}
+
+	data, ok := readImport(w, r)
+	if !ok {
+		return
+	}
+	// Events that can't be read are reported rather than failing the file
+	events, skipped, err := ical.DecodeLenient(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "Invalid iCalendar file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(events) == 0 && len(skipped) == 0 {
+		http.Error(w, "The file contains no events", http.StatusBadRequest)
+		return
+	}
+	if len(events)+len(skipped) > maxImportEvents {
+		http.Error(w, fmt.Sprintf("The file contains more than %d events", maxImportEvents), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	log.Printf("Importing %d calendar events for user %d (dry run: %t)", len(events), user.ID, dryRun)
+
+	items, err := calendar.ImportEvents(r.Context(), provider, events, dryRun, calendar.WriteOptions{SendUpdates: sendUpdates})
+	if err != nil {
+		log.Printf("Error importing events: %v", err)
+		http.Error(w, "Failed to import meetings: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	for _, event := range skipped {
+		items = append(items, &calendar.ImportItem{
+			ICalUID: event.UID,
+			Title:   event.Summary,
+			Status:  calendar.ImportInvalid,
+			Reason:  event.Err.Error(),
+		})
+	}
+
+	counts := map[string]int{}
+	for _, item := range items {
+		counts[item.Status]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dryRun": dryRun,
+		"counts": counts,
+		"events": items,
+	})
+}
+
+// readImport returns the uploaded file of an import request. Writes an
+// error response and returns false if there is none or it is too large.
+func readImport(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	defer r.Body.Close()
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Expected an iCalendar file in the file field: "+err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+		defer file.Close()
+		body = file
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "Failed to read iCalendar file: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		http.Error(w, "Expected an iCalendar file", http.StatusBadRequest)
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestImportMeetings(t *testing.T) {
+	calendarFile := func(events ...string) string {
+		return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"
+	}
+	vevent := func(uid, dtstart string) string {
+		return "BEGIN:VEVENT\r\nUID:" + uid + "\r\nSUMMARY:" + uid + "\r\n" + dtstart + "\r\nDURATION:PT1H\r\nEND:VEVENT\r\n"
+	}
+	good := vevent("good", "DTSTART;TZID=W. Europe Standard Time:20300115T090000")
+	bad := vevent("bad", "DTSTART;TZID=Atlantis Standard Time:20300115T090000")
+
+	tests := []struct {
+		name   string
+		query  string
+		body   string
+		status int
+		counts map[string]float64
+	}{
+		{"unknown zone skips only that event", "?dryRun=true", calendarFile(good, bad), http.StatusOK, map[string]float64{"new": 1, "invalid": 1}},
+		{"created", "", calendarFile(good, bad), http.StatusOK, map[string]float64{"created": 1, "invalid": 1}},
+		{"only unreadable events", "", calendarFile(bad), http.StatusOK, map[string]float64{"invalid": 1}},
+		{"no events", "", calendarFile(), http.StatusBadRequest, nil},
+		{"too many events", "?dryRun=true", calendarFile(strings.Repeat(good, maxImportEvents+1)), http.StatusRequestEntityTooLarge, nil},
+		{"malformed", "", "BEGIN:VCALENDAR\r\nnonsense\r\n", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(newTestRouter(newTestHandler()), 1, "POST", "/meetings/import"+tt.query, tt.body)
+			expectStatus(t, rec, tt.status)
+			if tt.counts == nil {
+				return
+			}
+			counts, _ := decodeJSON(t, rec)["counts"].(map[string]interface{})
+			if len(counts) != len(tt.counts) {
+				t.Fatalf("counts = %v, want %v", counts, tt.counts)
+			}
+			for status, want := range tt.counts {
+				if counts[status] != want {
+					t.Errorf("counts = %v, want %v", counts, tt.counts)
+				}
+			}
+		})
+	}
+}
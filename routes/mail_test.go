@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"context"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"goauthDemo/notify"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// testSender hands the emails it is asked to send to sent
+type testSender struct {
+	sent chan *notify.Message
+}
+
+func (s *testSender) Send(ctx context.Context, msg *notify.Message) error {
+	s.sent <- msg
+	return nil
+}
+
+// updatesCalendar records the sendUpdates the backend is asked for.
+// ownInvites makes it a backend that always emails attendees itself.
+type updatesCalendar struct {
+	calendar.CalendarProvider
+	mu         *sync.Mutex
+	updates    *[]string
+	ownInvites bool
+}
+
+func (p updatesCalendar) SendsOwnInvites() bool {
+	return p.ownInvites
+}
+
+func (p updatesCalendar) record(opts calendar.WriteOptions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*p.updates = append(*p.updates, opts.SendUpdates)
+}
+
+func (p updatesCalendar) CreateEvent(ctx context.Context, event *calendarapi.Event, opts calendar.WriteOptions) (*calendarapi.Event, error) {
+	p.record(opts)
+	return p.CalendarProvider.CreateEvent(ctx, event, opts)
+}
+
+func (p updatesCalendar) DeleteEvent(ctx context.Context, eventID string, opts calendar.WriteOptions) error {
+	p.record(opts)
+	return p.CalendarProvider.DeleteEvent(ctx, eventID, opts)
+}
+
+func TestMeetingEmails(t *testing.T) {
+	tests := []struct {
+		name        string
+		mail        bool
+		ownInvites  bool
+		sendUpdates string
+		// backend is what the calendar backend is asked for, emails how
+		// many emails we send ourselves for the creation and deletion,
+		// each to the attendees in to
+		backend []string
+		emails  int
+		to      []string
+	}{
+		{"backend emails", false, false, "", []string{"all", "all"}, 0, nil},
+		{"backend emails external attendees", false, false, "externalOnly", []string{"externalOnly", "externalOnly"}, 0, nil},
+		{"we email", true, false, "", []string{"none", "none"}, 2, []string{"bob@example.com", "guest@partner.org"}},
+		{"we email external attendees", true, false, "externalOnly", []string{"none", "none"}, 2, []string{"guest@partner.org"}},
+		{"nobody emails", true, false, "none", []string{"none", "none"}, 0, nil},
+		{"backend always emails", true, true, "", []string{"all", "all"}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var updates []string
+			memory := calendar.NewMemoryProviderFactory()
+			h := NewHandler(&testUsers{}, func(ctx context.Context, user *models.User) (calendar.CalendarProvider, error) {
+				provider, err := memory(ctx, user)
+				return updatesCalendar{provider, &mu, &updates, tt.ownInvites}, err
+			})
+			sender := &testSender{sent: make(chan *notify.Message, 4)}
+			if tt.mail {
+				h.Mail = &notify.Mailer{Sender: sender}
+			}
+			router := newTestRouter(h)
+
+			query := ""
+			if tt.sendUpdates != "" {
+				query = "?sendUpdates=" + tt.sendUpdates
+			}
+			rec := serve(router, 1, "POST", "/create-meeting"+query, `{"title":"Planning","startTime":"2030-03-10T09:00:00Z","endTime":"2030-03-10T10:00:00Z","attendees":["bob@example.com","guest@partner.org"]}`)
+			expectStatus(t, rec, http.StatusCreated)
+			id, _ := decodeJSON(t, rec)["id"].(string)
+			rec = serve(router, 1, "DELETE", "/meetings/"+id+query, "")
+			expectStatus(t, rec, http.StatusOK)
+
+			for i := 0; i < tt.emails; i++ {
+				select {
+				case msg := <-sender.sent:
+					if !reflect.DeepEqual(msg.To, tt.to) {
+						t.Errorf("email went to %v, want %v", msg.To, tt.to)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("%d emails sent, want %d", i, tt.emails)
+				}
+			}
+			select {
+			case msg := <-sender.sent:
+				t.Errorf("unexpected email %q", msg.Subject)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(updates) != len(tt.backend) {
+				t.Fatalf("backend asked for sendUpdates %v, want %v", updates, tt.backend)
+			}
+			for i := range updates {
+				if updates[i] != tt.backend[i] {
+					t.Errorf("backend asked for sendUpdates %v, want %v", updates, tt.backend)
+					break
+				}
+			}
+		})
+	}
+}
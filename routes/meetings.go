@@ -0,0 +1,648 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// CreateMeeting schedules a meeting and responds with it. The
+// sendUpdates query parameter decides whether attendees are emailed.
+func (h *Handler) CreateMeeting(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Title       string   `json:"title"`
+		Description string   `json:"description"`
+		Attendees   []string `json:"attendees"`
+		StartTime   string   `json:"startTime"`
+		EndTime     string   `json:"endTime"`
+		TimeZone    string   `json:"timeZone"`
+		// Recurrence holds RRULE, EXDATE and RDATE lines for a series
+		Recurrence []string `json:"recurrence"`
+		// CheckConflicts refuses to create the meeting if the organizer or
+		// any attendee is busy at that time
+		CheckConflicts bool `json:"checkConflicts"`
+		// AddGoogleMeet attaches a new Google Meet video conference
+		AddGoogleMeet bool `json:"addGoogleMeet"`
+		// Reminders overrides the calendar's default reminders
+		Reminders *calendar.MeetingReminders `json:"reminders"`
+	}
+
+	// Read the request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// Parse the JSON
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sendUpdates, ok := sendUpdatesParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	timeZone, ok := eventTimeZone(w, request.TimeZone, user)
+	if !ok {
+		return
+	}
+
+	// Log details for debugging
+	log.Printf("Creating calendar event for user %d: Title=%s, Attendees=%v", user.ID, request.Title, request.Attendees)
+
+	event := calendar.NewEvent(request.Title, request.StartTime, request.EndTime, request.Description, request.Attendees, timeZone)
+	if !setRecurrence(w, event, request.Recurrence) || !setReminders(w, event, request.Reminders) {
+		return
+	}
+	if request.AddGoogleMeet {
+		if err := calendar.AddGoogleMeet(event); err != nil {
+			log.Printf("Error requesting Google Meet: %v", err)
+			http.Error(w, "Failed to create meeting: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if request.CheckConflicts {
+		start, startErr := calendar.ParseEventDateTime(event.Start)
+		end, endErr := calendar.ParseEventDateTime(event.End)
+		if startErr != nil || endErr != nil || !end.After(start) {
+			http.Error(w, "startTime and endTime must be RFC3339 times with endTime after startTime", http.StatusBadRequest)
+			return
+		}
+
+		calendars := append([]string{user.Email}, request.Attendees...)
+		conflicts, err := calendar.FindConflicts(r.Context(), provider, start, end, calendars)
+		if err != nil {
+			log.Printf("Error checking conflicts: %v", err)
+			http.Error(w, "Failed to check conflicts: "+err.Error(), calendarErrorStatus(err))
+			return
+		}
+		if len(conflicts) > 0 {
+			log.Printf("Not creating meeting for user %d: %d calendars busy", user.ID, len(conflicts))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":   "The meeting conflicts with existing events",
+				"conflicts": conflicts,
+			})
+			return
+		}
+	}
+
+	createdEvent, err := provider.CreateEvent(r.Context(), event, calendar.WriteOptions{SendUpdates: h.providerUpdates(provider, sendUpdates)})
+	if err != nil {
+		log.Printf("Error creating event: %v", err)
+		http.Error(w, "Failed to create meeting: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+	log.Printf("Meeting Created: %s", createdEvent.HtmlLink)
+	h.mailAttendees(provider, user, createdEvent.Id, sendUpdates, func(ctx context.Context, mailer MeetingMailer) error {
+		return mailer.MeetingCreated(ctx, user, createdEvent, sendUpdates)
+	})
+
+	// Send the created meeting, pointing at it for later changes. A new
+	// Google Meet may still be pending, in which case its link shows up
+	// in /upcoming-meetings shortly after.
+	w.Header().Set("Content-Type", "application/json")
+	location := "/meetings/" + url.PathEscape(createdEvent.Id)
+	if calendarID := r.URL.Query().Get("calendarId"); calendarID != "" {
+		location += "?calendarId=" + url.QueryEscape(calendarID)
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(calendar.NewMeeting(createdEvent, userLocation(user)))
+}
+
+// GetUpcomingMeetings fetches upcoming meetings. The window defaults to the
+// next week and can be set with the from/to query parameters (RFC3339 or
+// YYYY-MM-DD); limit and pageToken page through busy calendars.
+func (h *Handler) GetUpcomingMeetings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+	// Dates in the query and times in the response are in the user's zone
+	loc := userLocation(user)
+
+	from, to, ok := listWindow(w, r, loc, 0, 7)
+	if !ok {
+		return
+	}
+
+	limit, ok := listLimit(w, r)
+	if !ok {
+		return
+	}
+
+	// Log for debugging
+	log.Printf("Fetching calendar events from %s to %s for user: %d", from.Format(time.RFC3339), to.Format(time.RFC3339), user.ID)
+
+	page, err := provider.ListEvents(r.Context(), calendar.ListOptions{
+		TimeMin:    from,
+		TimeMax:    to,
+		MaxResults: limit,
+		PageToken:  query.Get("pageToken"),
+	})
+	if err != nil {
+		log.Printf("Error fetching upcoming meetings: %v", err)
+		http.Error(w, err.Error(), calendarErrorStatus(err))
+		return
+	}
+	events := page.Items
+
+	// Format events for response
+	var formattedEvents []map[string]interface{}
+	for _, event := range events {
+		// Parse start time for formatting
+		var startTime, endTime time.Time
+		var startTimeStr, endTimeStr string
+
+		if event.Start.DateTime != "" {
+			startTime, _ = time.Parse(time.RFC3339, event.Start.DateTime)
+			startTimeStr = startTime.In(loc).Format("Jan 02, 2006 03:04 PM")
+		} else if event.Start.Date != "" {
+			// All-day event
+			startTimeStr = event.Start.Date + " (All day)"
+		}
+
+		if event.End.DateTime != "" {
+			endTime, _ = time.Parse(time.RFC3339, event.End.DateTime)
+			endTimeStr = endTime.In(loc).Format("Jan 02, 2006 03:04 PM")
+		} else if event.End.Date != "" {
+			// All-day event
+			endTimeStr = event.End.Date + " (All day)"
+		}
+
+		formattedEvents = append(formattedEvents, map[string]interface{}{
+			"id":          event.Id,
+			"title":       event.Summary,
+			"description": event.Description,
+			"startTime":   startTimeStr,
+			"endTime":     endTimeStr,
+			"link":        event.HtmlLink,
+			"meetLink":    calendar.MeetLink(event),
+			// Set on instances of a recurring meeting, naming the series
+			"recurringEventId": event.RecurringEventId,
+			"attendees":        calendar.NewMeetingAttendees(event.Attendees),
+		})
+	}
+
+	// Prepare the response
+	response := map[string]interface{}{
+		"events": formattedEvents,
+		"period": map[string]string{
+			"from": from.In(loc).Format("Jan 02, 2006"),
+			"to":   to.In(loc).Format("Jan 02, 2006"),
+		},
+		"timeZone": loc.String(),
+	}
+	if page.NextPageToken != "" {
+		response["nextPageToken"] = page.NextPageToken
+	}
+
+	// Send JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetMeeting returns the full details of a single meeting
+func (h *Handler) GetMeeting(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := provider.GetEvent(r.Context(), eventID)
+	if err != nil {
+		log.Printf("Error fetching event %s: %v", eventID, err)
+		http.Error(w, "Failed to fetch meeting: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar.NewMeeting(event, userLocation(user)))
+}
+
+// RespondToMeeting accepts, declines or tentatively accepts an invitation
+// on behalf of the signed-in user
+func (h *Handler) RespondToMeeting(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+
+	var request struct {
+		Response string `json:"response"`
+		Comment  string `json:"comment"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if !calendar.ValidResponse(request.Response) {
+		http.Error(w, "Invalid response: must be accepted, declined or tentative", http.StatusBadRequest)
+		return
+	}
+
+	sendUpdates, ok := sendUpdatesParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	log.Printf("User %d responding %s to calendar event %s", user.ID, request.Response, eventID)
+
+	event, err := provider.RespondToEvent(r.Context(), eventID, calendar.RSVP{
+		Response: request.Response,
+		Comment:  request.Comment,
+	}, calendar.WriteOptions{SendUpdates: sendUpdates})
+	if err != nil {
+		log.Printf("Error responding to event: %v", err)
+		http.Error(w, "Failed to respond to meeting: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar.NewMeeting(event, userLocation(user)))
+}
+
+// ListMeetingInstances lists the occurrences of a recurring meeting. Like
+// /upcoming-meetings it takes from, to, limit and pageToken query
+// parameters; the window defaults to the next three months.
+func (h *Handler) ListMeetingInstances(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+	loc := userLocation(user)
+
+	from, to, ok := listWindow(w, r, loc, 3, 0)
+	if !ok {
+		return
+	}
+
+	limit, ok := listLimit(w, r)
+	if !ok {
+		return
+	}
+
+	log.Printf("Fetching instances of calendar event %s for user %d", eventID, user.ID)
+
+	page, err := provider.ListInstances(r.Context(), eventID, calendar.ListOptions{
+		TimeMin:    from,
+		TimeMax:    to,
+		MaxResults: limit,
+		PageToken:  query.Get("pageToken"),
+	})
+	if err != nil {
+		log.Printf("Error fetching instances: %v", err)
+		http.Error(w, "Failed to fetch instances: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	instances := []*calendar.Meeting{}
+	for _, event := range page.Items {
+		// Google includes cancelled instances when they were changed before
+		if event.Status == "cancelled" {
+			continue
+		}
+		instances = append(instances, calendar.NewMeeting(event, loc))
+	}
+
+	response := map[string]interface{}{
+		"instances": instances,
+		"timeZone":  loc.String(),
+	}
+	if page.NextPageToken != "" {
+		response["nextPageToken"] = page.NextPageToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateMeeting replaces an existing meeting. For an instance of a
+// recurring meeting the scope query parameter picks which instances change.
+func (h *Handler) UpdateMeeting(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+
+	var request struct {
+		Title       string   `json:"title"`
+		Description string   `json:"description"`
+		Attendees   []string `json:"attendees"`
+		StartTime   string   `json:"startTime"`
+		EndTime     string   `json:"endTime"`
+		TimeZone    string   `json:"timeZone"`
+		// Recurrence holds RRULE, EXDATE and RDATE lines for a series
+		Recurrence []string `json:"recurrence"`
+		// Reminders overrides the calendar's default reminders
+		Reminders *calendar.MeetingReminders `json:"reminders"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if request.Title == "" || request.StartTime == "" || request.EndTime == "" {
+		http.Error(w, "title, startTime and endTime are required", http.StatusBadRequest)
+		return
+	}
+
+	sendUpdates, ok := sendUpdatesParam(w, r)
+	if !ok {
+		return
+	}
+	scope, ok := scopeParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	timeZone, ok := eventTimeZone(w, request.TimeZone, user)
+	if !ok {
+		return
+	}
+
+	log.Printf("Updating calendar event %s (scope %s) for user %d", eventID, scope, user.ID)
+
+	event := calendar.NewEvent(request.Title, request.StartTime, request.EndTime, request.Description, request.Attendees, timeZone)
+	if !setRecurrence(w, event, request.Recurrence) || !setReminders(w, event, request.Reminders) {
+		return
+	}
+	previous := h.previousEvent(r.Context(), provider, eventID, sendUpdates)
+	updatedEvent, err := calendar.UpdateRecurring(r.Context(), provider, eventID, event, scope, calendar.WriteOptions{SendUpdates: h.providerUpdates(provider, sendUpdates)})
+	if err != nil {
+		log.Printf("Error updating event: %v", err)
+		http.Error(w, "Failed to update meeting: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+	h.mailUpdate(provider, user, previous, updatedEvent, event.Start, event.End, sendUpdates)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Meeting updated successfully!",
+		"id":      updatedEvent.Id,
+		"link":    updatedEvent.HtmlLink,
+	})
+}
+
+// PatchMeeting changes only the fields present in the request body, with
+// scope working as for UpdateMeeting
+func (h *Handler) PatchMeeting(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+
+	var request struct {
+		Title       *string   `json:"title"`
+		Description *string   `json:"description"`
+		Attendees   *[]string `json:"attendees"`
+		StartTime   *string   `json:"startTime"`
+		EndTime     *string   `json:"endTime"`
+		TimeZone    *string   `json:"timeZone"`
+		// Recurrence replaces the rules of a series; empty stops it recurring
+		Recurrence *[]string `json:"recurrence"`
+		// Reminders replaces the meeting's reminders
+		Reminders *calendar.MeetingReminders `json:"reminders"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	sendUpdates, ok := sendUpdatesParam(w, r)
+	if !ok {
+		return
+	}
+	scope, ok := scopeParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	requestedZone := ""
+	if request.TimeZone != nil {
+		requestedZone = *request.TimeZone
+	}
+	timeZone, ok := eventTimeZone(w, requestedZone, user)
+	if !ok {
+		return
+	}
+
+	patch := &calendarapi.Event{}
+	if request.Title != nil {
+		patch.Summary = *request.Title
+	}
+	if request.Description != nil {
+		patch.Description = *request.Description
+		// Allow clearing the description, which would otherwise be omitted
+		if patch.Description == "" {
+			patch.ForceSendFields = append(patch.ForceSendFields, "Description")
+		}
+	}
+	if request.StartTime != nil {
+		patch.Start = calendar.NewEventDateTime(*request.StartTime, timeZone)
+	}
+	if request.EndTime != nil {
+		patch.End = calendar.NewEventDateTime(*request.EndTime, timeZone)
+	}
+	if request.Attendees != nil {
+		patch.Attendees = calendar.NewAttendees(*request.Attendees)
+		// An empty list removes every attendee
+		if len(patch.Attendees) == 0 {
+			patch.NullFields = append(patch.NullFields, "Attendees")
+		}
+	}
+
+	if request.Recurrence != nil {
+		if len(*request.Recurrence) == 0 {
+			patch.NullFields = append(patch.NullFields, "Recurrence")
+		} else if !setRecurrence(w, patch, *request.Recurrence) {
+			return
+		}
+	}
+
+	if !setReminders(w, patch, request.Reminders) {
+		return
+	}
+
+	log.Printf("Patching calendar event %s (scope %s) for user %d", eventID, scope, user.ID)
+
+	previous := h.previousEvent(r.Context(), provider, eventID, sendUpdates)
+	patchedEvent, err := calendar.PatchRecurring(r.Context(), provider, eventID, patch, scope, calendar.WriteOptions{SendUpdates: h.providerUpdates(provider, sendUpdates)})
+	if err != nil {
+		log.Printf("Error patching event: %v", err)
+		http.Error(w, "Failed to update meeting: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+	h.mailUpdate(provider, user, previous, patchedEvent, patch.Start, patch.End, sendUpdates)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Meeting updated successfully!",
+		"id":      patchedEvent.Id,
+		"link":    patchedEvent.HtmlLink,
+	})
+}
+
+// DeleteMeeting cancels a meeting, with scope working as for UpdateMeeting
+func (h *Handler) DeleteMeeting(w http.ResponseWriter, r *http.Request) {
+	eventID := mux.Vars(r)["id"]
+
+	sendUpdates, ok := sendUpdatesParam(w, r)
+	if !ok {
+		return
+	}
+	scope, ok := scopeParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	log.Printf("Deleting calendar event %s (scope %s) for user %d", eventID, scope, user.ID)
+
+	previous := h.previousEvent(r.Context(), provider, eventID, sendUpdates)
+	if previous != nil && previous.RecurringEventId != "" && scope == calendar.ScopeAll {
+		// The whole series is cancelled, not just this instance
+		previous = h.previousEvent(r.Context(), provider, previous.RecurringEventId, sendUpdates)
+	}
+	if err := calendar.DeleteRecurring(r.Context(), provider, eventID, scope, calendar.WriteOptions{SendUpdates: h.providerUpdates(provider, sendUpdates)}); err != nil {
+		log.Printf("Error deleting event: %v", err)
+		http.Error(w, "Failed to delete meeting: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+	if previous != nil {
+		h.mailAttendees(provider, user, eventID, sendUpdates, func(ctx context.Context, mailer MeetingMailer) error {
+			return mailer.MeetingCancelled(ctx, user, previous, sendUpdates)
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Meeting deleted successfully!",
+	})
+}
+
+// mailUpdate emails the attendees of an updated meeting, which moved if
+// the requested start or end differ from its previous times
+func (h *Handler) mailUpdate(provider calendar.CalendarProvider, user *models.User, previous, updated *calendarapi.Event, start, end *calendarapi.EventDateTime, sendUpdates string) {
+	if previous == nil {
+		return
+	}
+	moved := (start != nil && !calendar.SameDateTime(start, previous.Start)) ||
+		(end != nil && !calendar.SameDateTime(end, previous.End))
+	h.mailAttendees(provider, user, updated.Id, sendUpdates, func(ctx context.Context, mailer MeetingMailer) error {
+		return mailer.MeetingUpdated(ctx, user, previous, updated, moved, sendUpdates)
+	})
+}
+
+const (
+	// maxListLimit is the largest page size Google accepts
+	maxListLimit = 2500
+	// maxListWindow bounds how far /upcoming-meetings may look at once
+	maxListWindow = 366 * 24 * time.Hour
+)
+
+// listWindow reads the from/to query parameters of a listing; to defaults
+// to the given number of months and days after from. Writes an error
+// response and returns false if they are invalid.
+func listWindow(w http.ResponseWriter, r *http.Request, loc *time.Location, defaultMonths, defaultDays int) (time.Time, time.Time, bool) {
+	query := r.URL.Query()
+
+	now := time.Now().In(loc)
+	from, err := parseTimeParam(query.Get("from"), now, loc)
+	if err != nil {
+		http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	to, err := parseTimeParam(query.Get("to"), from.AddDate(0, defaultMonths, defaultDays), loc)
+	if err != nil {
+		http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) > maxListWindow {
+		http.Error(w, "The requested window may span at most one year", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// listLimit reads the limit query parameter of a listing, 0 if it is
+// absent. Writes an error response and returns false if it is invalid.
+func listLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		http.Error(w, fmt.Sprintf("Invalid limit: must be between 1 and %d", maxListLimit), http.StatusBadRequest)
+		return 0, false
+	}
+	return limit, true
+}
+
+// parseTimeParam reads an RFC3339 timestamp or a YYYY-MM-DD date (midnight
+// in loc) from a query parameter, returning fallback when it is empty
+func parseTimeParam(value string, fallback time.Time, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC3339 time or YYYY-MM-DD date")
+	}
+	return t, nil
+}
@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// meetingJSON is a create-meeting body starting at start, lasting an hour
+func meetingJSON(title string, start time.Time, extra string) string {
+	return fmt.Sprintf(`{"title":%q,"startTime":%q,"endTime":%q%s}`,
+		title, start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339), extra)
+}
+
+func TestCreateMeeting(t *testing.T) {
+	start := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Minute)
+
+	tests := []struct {
+		name     string
+		userID   int
+		body     string
+		status   int
+		contains string
+	}{
+		{"created", 1, meetingJSON("Planning", start, `,"attendees":["guest@example.com"]`), http.StatusCreated, `"title":"Planning"`},
+		{"with reminders", 1, meetingJSON("Planning", start, `,"reminders":{"overrides":[{"method":"popup","minutes":10}]}`), http.StatusCreated, `"minutes":10`},
+		{"signed out", 0, meetingJSON("Planning", start, ""), http.StatusUnauthorized, ""},
+		{"invalid JSON", 1, `{"title":`, http.StatusBadRequest, "Invalid request"},
+		{"end before start", 1, fmt.Sprintf(`{"title":"x","startTime":%q,"endTime":%q}`,
+			start.Format(time.RFC3339), start.Add(-time.Hour).Format(time.RFC3339)), http.StatusBadRequest, "Failed to create meeting"},
+		{"invalid time zone", 1, meetingJSON("x", start, `,"timeZone":"Mars/Base"`), http.StatusBadRequest, ""},
+		{"invalid reminder", 1, meetingJSON("x", start, `,"reminders":{"overrides":[{"method":"sms","minutes":10}]}`), http.StatusBadRequest, "Invalid reminders"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(newTestHandler())
+			rec := serve(router, tt.userID, "POST", "/create-meeting", tt.body)
+			expectStatus(t, rec, tt.status)
+			if !strings.Contains(rec.Body.String(), tt.contains) {
+				t.Errorf("body %s doesn't contain %s", rec.Body.String(), tt.contains)
+			}
+			if tt.status == http.StatusCreated && rec.Header().Get("Location") != "/meetings/mem1" {
+				t.Errorf("Location = %q, want /meetings/mem1", rec.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestMeetingLifecycle(t *testing.T) {
+	router := newTestRouter(newTestHandler())
+	start := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Minute)
+
+	expectStatus(t, serve(router, 1, "POST", "/create-meeting", meetingJSON("Planning", start, "")), http.StatusCreated)
+
+	steps := []struct {
+		method, target, body string
+		status               int
+		title                string
+	}{
+		{"GET", "/meetings/mem1", "", http.StatusOK, "Planning"},
+		{"PATCH", "/meetings/mem1", `{"title":"Review"}`, http.StatusOK, ""},
+		{"GET", "/meetings/mem1", "", http.StatusOK, "Review"},
+		{"PUT", "/meetings/mem1", meetingJSON("Retro", start.Add(time.Hour), ""), http.StatusOK, ""},
+		{"GET", "/meetings/mem1", "", http.StatusOK, "Retro"},
+		{"PUT", "/meetings/mem1", `{"title":"Retro"}`, http.StatusBadRequest, ""},
+		{"PATCH", "/meetings/mem1?sendUpdates=everyone", `{}`, http.StatusBadRequest, ""},
+		{"DELETE", "/meetings/mem1", "", http.StatusOK, ""},
+		{"GET", "/meetings/mem1", "", http.StatusNotFound, ""},
+		{"DELETE", "/meetings/mem1", "", http.StatusNotFound, ""},
+		{"PATCH", "/meetings/mem1", `{"title":"Gone"}`, http.StatusNotFound, ""},
+	}
+	for _, step := range steps {
+		rec := serve(router, 1, step.method, step.target, step.body)
+		if rec.Code != step.status {
+			t.Fatalf("%s %s: status = %d, want %d: %s", step.method, step.target, rec.Code, step.status, rec.Body.String())
+		}
+		if step.title != "" {
+			if title := decodeJSON(t, rec)["title"]; title != step.title {
+				t.Errorf("%s %s: title = %v, want %s", step.method, step.target, title, step.title)
+			}
+		}
+	}
+}
+
+func TestMeetingsAreSeparatePerUser(t *testing.T) {
+	router := newTestRouter(newTestHandler())
+	start := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Minute)
+
+	expectStatus(t, serve(router, 1, "POST", "/create-meeting", meetingJSON("Mine", start, "")), http.StatusCreated)
+	expectStatus(t, serve(router, 2, "GET", "/meetings/mem1", ""), http.StatusNotFound)
+	expectStatus(t, serve(router, 2, "DELETE", "/meetings/mem1", ""), http.StatusNotFound)
+	expectStatus(t, serve(router, 1, "GET", "/meetings/mem1", ""), http.StatusOK)
+}
+
+func TestGetUpcomingMeetings(t *testing.T) {
+	router := newTestRouter(newTestHandler())
+	start := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Minute)
+	for i, offset := range []time.Duration{0, 24 * time.Hour, 30 * 24 * time.Hour} {
+		body := meetingJSON(fmt.Sprintf("Meeting %d", i), start.Add(offset), "")
+		expectStatus(t, serve(router, 1, "POST", "/create-meeting", body), http.StatusCreated)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		status        int
+		events        int
+		nextPageToken bool
+	}{
+		{"next week", "", http.StatusOK, 2, false},
+		{"first page", "?limit=1", http.StatusOK, 1, true},
+		{"second page", "?limit=1&pageToken=1", http.StatusOK, 1, false},
+		{"window", "?from=" + start.Format("2006-01-02") + "&to=" + start.AddDate(0, 2, 0).Format("2006-01-02"), http.StatusOK, 3, false},
+		{"invalid limit", "?limit=0", http.StatusBadRequest, 0, false},
+		{"invalid from", "?from=soon", http.StatusBadRequest, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, 1, "GET", "/upcoming-meetings"+tt.query, "")
+			expectStatus(t, rec, tt.status)
+			if tt.status != http.StatusOK {
+				return
+			}
+			body := decodeJSON(t, rec)
+			events, _ := body["events"].([]interface{})
+			if len(events) != tt.events {
+				t.Errorf("got %d events, want %d", len(events), tt.events)
+			}
+			if _, ok := body["nextPageToken"]; ok != tt.nextPageToken {
+				t.Errorf("nextPageToken present = %v, want %v", ok, tt.nextPageToken)
+			}
+		})
+	}
+}
+
+func TestListMeetingInstances(t *testing.T) {
+	router := newTestRouter(newTestHandler())
+	start := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Minute)
+	expectStatus(t, serve(router, 1, "POST", "/create-meeting", meetingJSON("Weekly", start, `,"recurrence":["RRULE:FREQ=WEEKLY"]`)), http.StatusCreated)
+
+	day := func(offset int) string { return start.AddDate(0, 0, offset).Format("2006-01-02") }
+	tests := []struct {
+		name     string
+		query    string
+		status   int
+		minCount int
+		maxCount int
+	}{
+		{"next three months", "", http.StatusOK, 13, 14},
+		{"window", "?from=" + day(0) + "&to=" + day(15), http.StatusOK, 2, 3},
+		{"first page", "?limit=1", http.StatusOK, 1, 1},
+		{"invalid from", "?from=soon", http.StatusBadRequest, 0, 0},
+		{"to before from", "?from=" + day(7) + "&to=" + day(0), http.StatusBadRequest, 0, 0},
+		{"over a year", "?from=" + day(0) + "&to=" + day(400), http.StatusBadRequest, 0, 0},
+		{"invalid limit", "?limit=0", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, 1, "GET", "/meetings/mem1/instances"+tt.query, "")
+			expectStatus(t, rec, tt.status)
+			if tt.status != http.StatusOK {
+				return
+			}
+			instances, _ := decodeJSON(t, rec)["instances"].([]interface{})
+			if len(instances) < tt.minCount || len(instances) > tt.maxCount {
+				t.Errorf("got %d instances, want %d to %d", len(instances), tt.minCount, tt.maxCount)
+			}
+		})
+	}
+}
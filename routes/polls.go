@@ -0,0 +1,615 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Poll statuses
+const (
+	pollOpen      = "open"
+	pollFinalized = "finalized"
+)
+
+// maxPollOptions bounds the candidate times of a poll
+const maxPollOptions = 50
+
+// pollChoices are the answers a participant can give for an option
+var pollChoices = map[string]bool{"yes": true, "maybe": true, "no": true}
+
+// ListPolls lists the signed-in user's polls with their vote counts
+func (h *Handler) ListPolls(w http.ResponseWriter, r *http.Request) {
+	if !h.pollsEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	polls, err := h.Polls.ListPolls(user.ID)
+	if err != nil {
+		log.Printf("Error listing polls of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to list polls", http.StatusInternalServerError)
+		return
+	}
+
+	formatted := []map[string]interface{}{}
+	for i := range polls {
+		participants, err := h.Polls.ListPollParticipants(polls[i].ID)
+		if err != nil {
+			log.Printf("Error loading votes of poll %d: %v", polls[i].ID, err)
+			http.Error(w, "Failed to list polls", http.StatusInternalServerError)
+			return
+		}
+		formatted = append(formatted, pollResponse(&polls[i], participants, userLocation(user), true))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"polls": formatted,
+	})
+}
+
+// CreatePoll proposes candidate times for a meeting. The response holds
+// the link to share with participants, who vote without signing in; only
+// its hash is stored, so it isn't shown again.
+func (h *Handler) CreatePoll(w http.ResponseWriter, r *http.Request) {
+	if !h.pollsEnabled(w) {
+		return
+	}
+
+	var request struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Location    string `json:"location"`
+		TimeZone    string `json:"timeZone"`
+		Options     []struct {
+			StartTime string `json:"startTime"`
+			EndTime   string `json:"endTime"`
+		} `json:"options"`
+		// Deadline ends voting at an RFC3339 time
+		Deadline string `json:"deadline"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if strings.TrimSpace(request.Title) == "" {
+		http.Error(w, "title is required", http.StatusBadRequest)
+		return
+	}
+	if len(request.Options) == 0 || len(request.Options) > maxPollOptions {
+		http.Error(w, fmt.Sprintf("A poll needs between 1 and %d options", maxPollOptions), http.StatusBadRequest)
+		return
+	}
+	timeZone, ok := eventTimeZone(w, request.TimeZone, user)
+	if !ok {
+		return
+	}
+
+	poll := &models.Poll{
+		UserID:      user.ID,
+		Title:       request.Title,
+		Description: request.Description,
+		Location:    request.Location,
+		TimeZone:    timeZone,
+		Status:      pollOpen,
+	}
+	seen := map[string]bool{}
+	for i, option := range request.Options {
+		start, startErr := time.Parse(time.RFC3339, option.StartTime)
+		end, endErr := time.Parse(time.RFC3339, option.EndTime)
+		if startErr != nil || endErr != nil || !end.After(start) || end.Sub(start) > maxMeetingDuration {
+			http.Error(w, fmt.Sprintf("Option %d needs RFC3339 startTime and endTime, at most 24 hours apart", i+1), http.StatusBadRequest)
+			return
+		}
+		key := start.UTC().String() + end.UTC().String()
+		if seen[key] {
+			http.Error(w, fmt.Sprintf("Option %d is listed twice", i+1), http.StatusBadRequest)
+			return
+		}
+		seen[key] = true
+		poll.Options = append(poll.Options, models.PollOption{StartTime: start, EndTime: end})
+	}
+	if request.Deadline != "" {
+		deadline, err := time.Parse(time.RFC3339, request.Deadline)
+		if err != nil || !deadline.After(time.Now()) {
+			http.Error(w, "deadline must be an RFC3339 time in the future", http.StatusBadRequest)
+			return
+		}
+		poll.Deadline = &deadline
+	}
+
+	token, err := newToken()
+	if err != nil {
+		log.Printf("Error generating poll token: %v", err)
+		http.Error(w, "Failed to create poll", http.StatusInternalServerError)
+		return
+	}
+	poll.TokenHash = hashToken(token)
+
+	if err := h.Polls.CreatePoll(poll); err != nil {
+		log.Printf("Error saving poll: %v", err)
+		http.Error(w, "Failed to create poll", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d created poll %d with %d options", user.ID, poll.ID, len(poll.Options))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/polls/"+strconv.FormatUint(uint64(poll.ID), 10))
+	response := pollResponse(poll, nil, userLocation(user), true)
+	response["url"] = "/vote/" + token
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetPoll shows one of the signed-in user's polls with everyone's votes
+func (h *Handler) GetPoll(w http.ResponseWriter, r *http.Request) {
+	user, poll, ok := h.ownPoll(w, r)
+	if !ok {
+		return
+	}
+
+	participants, err := h.Polls.ListPollParticipants(poll.ID)
+	if err != nil {
+		log.Printf("Error loading votes of poll %d: %v", poll.ID, err)
+		http.Error(w, "Failed to load poll", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pollResponse(poll, participants, userLocation(user), true))
+}
+
+// FinalizePoll picks one of a poll's options and schedules the meeting
+// then, inviting every participant who didn't vote no on it. Voting ends.
+// The calendarId and sendUpdates query parameters work as for
+// /create-meeting.
+func (h *Handler) FinalizePoll(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		OptionID uint `json:"optionId"`
+		// Attendees are invited besides the participants
+		Attendees []string `json:"attendees"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	sendUpdates, ok := sendUpdatesParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, poll, ok := h.ownPoll(w, r)
+	if !ok {
+		return
+	}
+	// Only votes on this poll wait while the meeting is created
+	poll, unlock, ok := h.lockPoll(w, poll)
+	if !ok {
+		return
+	}
+	defer unlock()
+	if poll.Status == pollFinalized {
+		http.Error(w, "This poll has already been finalized", http.StatusConflict)
+		return
+	}
+
+	var option *models.PollOption
+	for i := range poll.Options {
+		if poll.Options[i].ID == request.OptionID {
+			option = &poll.Options[i]
+		}
+	}
+	if option == nil {
+		http.Error(w, "optionId is not an option of this poll", http.StatusBadRequest)
+		return
+	}
+
+	participants, err := h.Polls.ListPollParticipants(poll.ID)
+	if err != nil {
+		log.Printf("Error loading votes of poll %d: %v", poll.ID, err)
+		http.Error(w, "Failed to finalize poll", http.StatusInternalServerError)
+		return
+	}
+	attendees := request.Attendees
+	for _, participant := range participants {
+		if participantChoice(&participant, option.ID) != "no" {
+			attendees = append(attendees, participant.Email)
+		}
+	}
+
+	_, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+
+	event := calendar.NewEvent(
+		poll.Title,
+		option.StartTime.Format(time.RFC3339),
+		option.EndTime.Format(time.RFC3339),
+		poll.Description,
+		attendees,
+		poll.TimeZone,
+	)
+	event.Location = poll.Location
+
+	createdEvent, err := provider.CreateEvent(r.Context(), event, calendar.WriteOptions{SendUpdates: h.providerUpdates(provider, sendUpdates)})
+	if err != nil {
+		log.Printf("Error creating event for poll %d: %v", poll.ID, err)
+		http.Error(w, "Failed to create meeting: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	poll.Status = pollFinalized
+	poll.FinalOptionID = &option.ID
+	poll.EventID = createdEvent.Id
+	if err := h.Polls.UpdatePoll(poll); err != nil {
+		// The meeting exists, so report it rather than fail
+		log.Printf("Error saving finalized poll %d: %v", poll.ID, err)
+	}
+
+	log.Printf("User %d finalized poll %d: %s", user.ID, poll.ID, createdEvent.HtmlLink)
+	h.mailAttendees(provider, user, createdEvent.Id, sendUpdates, func(ctx context.Context, mailer MeetingMailer) error {
+		return mailer.MeetingCreated(ctx, user, createdEvent, sendUpdates)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	location := "/meetings/" + url.PathEscape(createdEvent.Id)
+	if calendarID := r.URL.Query().Get("calendarId"); calendarID != "" {
+		location += "?calendarId=" + url.QueryEscape(calendarID)
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"poll":    pollResponse(poll, participants, userLocation(user), true),
+		"meeting": calendar.NewMeeting(createdEvent, userLocation(user)),
+	})
+}
+
+// DeletePoll removes one of the signed-in user's polls and its votes. A
+// meeting it was finalized into stays in the calendar.
+func (h *Handler) DeletePoll(w http.ResponseWriter, r *http.Request) {
+	user, poll, ok := h.ownPoll(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Polls.DeletePoll(user.ID, poll.ID); err != nil {
+		log.Printf("Error deleting poll %d: %v", poll.ID, err)
+		http.Error(w, "Failed to delete poll", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Poll deleted successfully!",
+	})
+}
+
+// PollPage serves the public page on which participants vote
+func (h *Handler) PollPage(w http.ResponseWriter, r *http.Request) {
+	poll, ok := h.sharedPoll(w, r)
+	if !ok {
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/poll.html")
+	if err != nil {
+		log.Printf("Error parsing poll page template: %v", err)
+		http.Error(w, "Failed to load poll", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Title":       poll.Title,
+		"Description": poll.Description,
+		"Location":    poll.Location,
+	})
+	if err != nil {
+		log.Printf("Error executing poll page template: %v", err)
+	}
+}
+
+// PollResults shows a shared poll with the votes so far. Participants'
+// emails aren't shown; timeZone picks the zone times are written in.
+func (h *Handler) PollResults(w http.ResponseWriter, r *http.Request) {
+	poll, ok := h.sharedPoll(w, r)
+	if !ok {
+		return
+	}
+
+	loc, err := calendar.LoadTimeZone(poll.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	if name := r.URL.Query().Get("timeZone"); name != "" {
+		if loc, err = calendar.LoadTimeZone(name); err != nil {
+			http.Error(w, "Invalid timeZone: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	participants, err := h.Polls.ListPollParticipants(poll.ID)
+	if err != nil {
+		log.Printf("Error loading votes of poll %d: %v", poll.ID, err)
+		http.Error(w, "Failed to load poll", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pollResponse(poll, participants, loc, false))
+}
+
+// VotePoll records a participant's votes on a shared poll. Their first
+// vote returns a participantToken, which they send along to change their
+// votes later; votes under an email that has already voted are refused
+// without it.
+func (h *Handler) VotePoll(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		// Votes maps option IDs to yes, maybe or no; options left out
+		// count as no
+		Votes            map[string]string `json:"votes"`
+		ParticipantToken string            `json:"participantToken"`
+	}
+
+	if !decodePublicJSON(w, r, &request) {
+		return
+	}
+
+	poll, ok := h.sharedPoll(w, r)
+	if !ok {
+		return
+	}
+	poll, unlock, ok := h.lockPoll(w, poll)
+	if !ok {
+		return
+	}
+	defer unlock()
+	if poll.Status != pollOpen || (poll.Deadline != nil && time.Now().After(*poll.Deadline)) {
+		http.Error(w, "Voting on this poll has ended", http.StatusConflict)
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	address, err := mail.ParseAddress(request.Email)
+	if err != nil {
+		http.Error(w, "Invalid email: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	email := strings.ToLower(address.Address)
+
+	options := map[uint]bool{}
+	for _, option := range poll.Options {
+		options[option.ID] = true
+	}
+	var votes []models.PollVote
+	for key, choice := range request.Votes {
+		optionID, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || !options[uint(optionID)] {
+			http.Error(w, fmt.Sprintf("%q is not an option of this poll", key), http.StatusBadRequest)
+			return
+		}
+		if !pollChoices[choice] {
+			http.Error(w, "Votes must be yes, maybe or no", http.StatusBadRequest)
+			return
+		}
+		votes = append(votes, models.PollVote{OptionID: uint(optionID), Choice: choice})
+	}
+
+	participant, err := h.Polls.GetPollParticipant(poll.ID, email)
+	if err != nil {
+		log.Printf("Error loading participant of poll %d: %v", poll.ID, err)
+		http.Error(w, "Failed to save votes", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	token := ""
+	if participant == nil {
+		if token, err = newToken(); err != nil {
+			log.Printf("Error generating participant token: %v", err)
+			http.Error(w, "Failed to save votes", http.StatusInternalServerError)
+			return
+		}
+		participant = &models.PollParticipant{PollID: poll.ID, Email: email, TokenHash: hashToken(token)}
+		status = http.StatusCreated
+	} else if request.ParticipantToken == "" || hashToken(request.ParticipantToken) != participant.TokenHash {
+		http.Error(w, "Someone with this email has already voted; send their participantToken to change the votes", http.StatusForbidden)
+		return
+	}
+	participant.Name = name
+	participant.Votes = votes
+
+	if err := h.Polls.SavePollParticipant(participant); err != nil {
+		log.Printf("Error saving votes on poll %d: %v", poll.ID, err)
+		http.Error(w, "Failed to save votes", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Thanks, your votes are saved",
+	}
+	if token != "" {
+		response["participantToken"] = token
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ownPoll loads the signed-in user's poll named in the URL, writing an
+// error response and returning false if there is no such poll
+func (h *Handler) ownPoll(w http.ResponseWriter, r *http.Request) (*models.User, *models.Poll, bool) {
+	if !h.pollsEnabled(w) {
+		return nil, nil, false
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	poll, err := h.Polls.GetPoll(user.ID, uint(id))
+	if err != nil {
+		log.Printf("Error loading poll %d: %v", id, err)
+		http.Error(w, "Failed to load poll", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if poll == nil {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return user, poll, true
+}
+
+// lockPoll keeps votes on a poll from racing with it being finalized. It
+// locks the poll and reloads it, since it may have changed meanwhile, and
+// returns the unlock function. Writes an error response and returns false
+// if the poll can't be reloaded.
+func (h *Handler) lockPoll(w http.ResponseWriter, poll *models.Poll) (*models.Poll, func(), bool) {
+	unlock := h.pollLocks.lock(int(poll.ID))
+	current, err := h.Polls.GetPoll(poll.UserID, poll.ID)
+	if err != nil {
+		unlock()
+		log.Printf("Error loading poll %d: %v", poll.ID, err)
+		http.Error(w, "Failed to load poll", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if current == nil {
+		unlock()
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	return current, unlock, true
+}
+
+// sharedPoll loads the poll a public voting URL refers to, writing a 404
+// and returning false if there is none
+func (h *Handler) sharedPoll(w http.ResponseWriter, r *http.Request) (*models.Poll, bool) {
+	if !h.pollsEnabled(w) {
+		return nil, false
+	}
+
+	poll, err := h.Polls.FindPollByToken(hashToken(mux.Vars(r)["token"]))
+	if err != nil {
+		log.Printf("Error loading poll: %v", err)
+		http.Error(w, "Failed to load poll", http.StatusInternalServerError)
+		return nil, false
+	}
+	if poll == nil {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return nil, false
+	}
+	return poll, true
+}
+
+// pollResponse formats a poll with a tally of the votes per option. The
+// organizer also sees participants' emails.
+func pollResponse(poll *models.Poll, participants []models.PollParticipant, loc *time.Location, organizer bool) map[string]interface{} {
+	options := []map[string]interface{}{}
+	for _, option := range poll.Options {
+		tally := map[string]int{"yes": 0, "maybe": 0, "no": 0}
+		for i := range participants {
+			tally[participantChoice(&participants[i], option.ID)]++
+		}
+		options = append(options, map[string]interface{}{
+			"id":        option.ID,
+			"startTime": option.StartTime.In(loc).Format(time.RFC3339),
+			"endTime":   option.EndTime.In(loc).Format(time.RFC3339),
+			"yes":       tally["yes"],
+			"maybe":     tally["maybe"],
+			"no":        tally["no"],
+		})
+	}
+
+	voters := []map[string]interface{}{}
+	for i := range participants {
+		votes := map[string]string{}
+		for _, option := range poll.Options {
+			votes[strconv.FormatUint(uint64(option.ID), 10)] = participantChoice(&participants[i], option.ID)
+		}
+		voter := map[string]interface{}{
+			"name":  participants[i].Name,
+			"votes": votes,
+		}
+		if organizer {
+			voter["email"] = participants[i].Email
+		}
+		voters = append(voters, voter)
+	}
+
+	response := map[string]interface{}{
+		"title":         poll.Title,
+		"description":   poll.Description,
+		"location":      poll.Location,
+		"timeZone":      loc.String(),
+		"status":        poll.Status,
+		"deadline":      poll.Deadline,
+		"finalOptionId": poll.FinalOptionID,
+		"options":       options,
+		"participants":  voters,
+	}
+	if organizer {
+		response["id"] = poll.ID
+		response["eventId"] = poll.EventID
+	}
+	return response
+}
+
+// participantChoice is what a participant voted for an option; options
+// they didn't vote on count as no
+func participantChoice(participant *models.PollParticipant, optionID uint) string {
+	for _, vote := range participant.Votes {
+		if vote.OptionID == optionID {
+			return vote.Choice
+		}
+	}
+	return "no"
+}
+
+// pollsEnabled writes a 404 and returns false when polls are turned off
+func (h *Handler) pollsEnabled(w http.ResponseWriter) bool {
+	if h.Polls == nil {
+		http.Error(w, "Polls are not enabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	calendarapi "google.golang.org/api/calendar/v3"
+)
+
+// testPolls is a PollStore in memory
+type testPolls struct {
+	mu    sync.Mutex
+	polls []*models.Poll
+}
+
+func (s *testPolls) ListPolls(userID int) ([]models.Poll, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var polls []models.Poll
+	for _, poll := range s.polls {
+		if poll.UserID == userID {
+			polls = append(polls, *poll)
+		}
+	}
+	return polls, nil
+}
+
+func (s *testPolls) GetPoll(userID int, id uint) (*models.Poll, error) {
+	return s.find(func(poll *models.Poll) bool { return poll.UserID == userID && poll.ID == id })
+}
+
+func (s *testPolls) FindPollByToken(tokenHash string) (*models.Poll, error) {
+	return s.find(func(poll *models.Poll) bool { return poll.TokenHash == tokenHash })
+}
+
+func (s *testPolls) find(match func(*models.Poll) bool) (*models.Poll, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, poll := range s.polls {
+		if match(poll) {
+			found := *poll
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *testPolls) CreatePoll(poll *models.Poll) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	poll.ID = uint(len(s.polls) + 1)
+	for i := range poll.Options {
+		poll.Options[i].ID = uint(i + 1)
+		poll.Options[i].PollID = poll.ID
+	}
+	stored := *poll
+	s.polls = append(s.polls, &stored)
+	return nil
+}
+
+func (s *testPolls) UpdatePoll(poll *models.Poll) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, stored := range s.polls {
+		if stored.ID == poll.ID {
+			updated := *poll
+			s.polls[i] = &updated
+		}
+	}
+	return nil
+}
+
+func (s *testPolls) DeletePoll(userID int, id uint) error { return nil }
+
+func (s *testPolls) ListPollParticipants(pollID uint) ([]models.PollParticipant, error) {
+	return nil, nil
+}
+
+func (s *testPolls) GetPollParticipant(pollID uint, email string) (*models.PollParticipant, error) {
+	return nil, nil
+}
+
+func (s *testPolls) SavePollParticipant(participant *models.PollParticipant) error { return nil }
+
+func TestPollTokenIsStoredHashed(t *testing.T) {
+	h := newTestHandler()
+	polls := &testPolls{}
+	h.Polls = polls
+	router := newTestRouter(h)
+
+	rec := serve(router, 1, "POST", "/polls", `{"title":"Offsite","timeZone":"UTC","options":[
+		{"startTime":"2030-03-10T09:00:00Z","endTime":"2030-03-10T10:00:00Z"},
+		{"startTime":"2030-03-11T09:00:00Z","endTime":"2030-03-11T10:00:00Z"}]}`)
+	expectStatus(t, rec, http.StatusCreated)
+	url, _ := decodeJSON(t, rec)["url"].(string)
+	token := strings.TrimPrefix(url, "/vote/")
+	if token == "" || token == url {
+		t.Fatalf("url = %q, want the /vote/{token} link", url)
+	}
+
+	stored := polls.polls[0]
+	if stored.TokenHash != hashToken(token) {
+		t.Errorf("stored token hash = %q, want the hash of the link's token", stored.TokenHash)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		target string
+		status int
+	}{
+		{"results by token", 0, "/vote/" + token + "/results", http.StatusOK},
+		{"results by stored hash", 0, "/vote/" + stored.TokenHash + "/results", http.StatusNotFound},
+		{"organizer's view", 1, "/polls/1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, tt.userID, "GET", tt.target, "")
+			expectStatus(t, rec, tt.status)
+			if strings.Contains(rec.Body.String(), token) {
+				t.Errorf("response shows the poll's token: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+// blockingCalendar holds up creating events until release is closed
+type blockingCalendar struct {
+	calendar.CalendarProvider
+	creating chan struct{}
+	release  chan struct{}
+}
+
+func (p blockingCalendar) CreateEvent(ctx context.Context, event *calendarapi.Event, opts calendar.WriteOptions) (*calendarapi.Event, error) {
+	p.creating <- struct{}{}
+	<-p.release
+	return p.CalendarProvider.CreateEvent(ctx, event, opts)
+}
+
+// createTestPoll creates a poll of user 1 and returns its voting token
+func createTestPoll(t *testing.T, router http.Handler) string {
+	t.Helper()
+	rec := serve(router, 1, "POST", "/polls", `{"title":"Offsite","timeZone":"UTC","options":[
+		{"startTime":"2030-03-10T09:00:00Z","endTime":"2030-03-10T10:00:00Z"}]}`)
+	expectStatus(t, rec, http.StatusCreated)
+	url, _ := decodeJSON(t, rec)["url"].(string)
+	return strings.TrimPrefix(url, "/vote/")
+}
+
+func TestFinalizePollOnlyHoldsUpItsOwnVotes(t *testing.T) {
+	creating, release := make(chan struct{}), make(chan struct{})
+	memory := calendar.NewMemoryProviderFactory()
+	h := NewHandler(&testUsers{}, func(ctx context.Context, user *models.User) (calendar.CalendarProvider, error) {
+		provider, err := memory(ctx, user)
+		return blockingCalendar{provider, creating, release}, err
+	})
+	h.Polls = &testPolls{}
+	router := newTestRouter(h)
+
+	finalized := createTestPoll(t, router)
+	other := createTestPoll(t, router)
+
+	finalizing := make(chan int)
+	go func() {
+		finalizing <- serve(router, 1, "POST", "/polls/1/finalize", `{"optionId":1}`).Code
+	}()
+	<-creating
+
+	voted := make(chan int)
+	go func() {
+		voted <- serve(router, 0, "POST", "/vote/"+other, `{"name":"Bob","email":"bob@example.com","votes":{"1":"yes"}}`).Code
+	}()
+	select {
+	case status := <-voted:
+		if status != http.StatusCreated {
+			t.Errorf("vote on another poll: status = %d, want %d", status, http.StatusCreated)
+		}
+	case <-time.After(time.Second):
+		t.Error("vote on another poll waited for the poll being finalized")
+	}
+
+	late := make(chan int)
+	go func() {
+		late <- serve(router, 0, "POST", "/vote/"+finalized, `{"name":"Carol","email":"carol@example.com","votes":{"1":"yes"}}`).Code
+	}()
+	close(release)
+	if status := <-finalizing; status != http.StatusCreated {
+		t.Errorf("finalize: status = %d, want %d", status, http.StatusCreated)
+	}
+	if status := <-late; status != http.StatusConflict {
+		t.Errorf("vote during finalization: status = %d, want %d", status, http.StatusConflict)
+	}
+	select {
+	case status := <-voted:
+		t.Errorf("vote on another poll finished only after finalization, with status %d", status)
+	default:
+	}
+}
+
+func TestVotePollBodyLimit(t *testing.T) {
+	h := newTestHandler()
+	h.Polls = &testPolls{}
+	router := newTestRouter(h)
+	token := createTestPoll(t, router)
+
+	body := fmt.Sprintf(`{"name":%q,"email":"bob@example.com","votes":{"1":"yes"}}`, strings.Repeat("a", maxPublicBodySize))
+	rec := serve(router, 0, "POST", "/vote/"+token, body)
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,256 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goauthDemo/internal/netguard"
+	"goauthDemo/models"
+	"goauthDemo/notify"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxReminderRules bounds the reminder rules per user
+	maxReminderRules = 10
+	// maxReminderLead is the earliest a server reminder can be sent: a week
+	// before the event
+	maxReminderLead = 7 * 24 * 60
+	// reminderHistory is how many reminders /reminders/jobs lists
+	reminderHistory = 50
+)
+
+// ListReminderRules lists the signed-in user's server reminder rules
+func (h *Handler) ListReminderRules(w http.ResponseWriter, r *http.Request) {
+	if !h.remindersEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := h.Reminders.ListUserReminderRules(user.ID)
+	if err != nil {
+		log.Printf("Error listing reminder rules of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to list reminders", http.StatusInternalServerError)
+		return
+	}
+
+	formatted := []map[string]interface{}{}
+	for i := range rules {
+		formatted = append(formatted, reminderRuleResponse(&rules[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reminders": formatted,
+	})
+}
+
+// CreateReminderRule asks for a reminder of every event in the signed-in
+// user's default calendar, minutesBefore it starts. The channel is email
+// (target defaults to the user's address), webhook (target is a URL that
+// gets the meeting as JSON) or slack (target is an incoming webhook URL).
+func (h *Handler) CreateReminderRule(w http.ResponseWriter, r *http.Request) {
+	if !h.remindersEnabled(w) {
+		return
+	}
+
+	var request struct {
+		Channel       string `json:"channel"`
+		Target        string `json:"target"`
+		MinutesBefore int    `json:"minutesBefore"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if request.MinutesBefore < 0 || request.MinutesBefore > maxReminderLead {
+		http.Error(w, fmt.Sprintf("minutesBefore must be between 0 and %d", maxReminderLead), http.StatusBadRequest)
+		return
+	}
+	target, err := reminderTarget(r.Context(), request.Channel, strings.TrimSpace(request.Target), user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules, err := h.Reminders.ListUserReminderRules(user.ID)
+	if err != nil {
+		log.Printf("Error listing reminder rules of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to create reminder", http.StatusInternalServerError)
+		return
+	}
+	if len(rules) >= maxReminderRules {
+		http.Error(w, fmt.Sprintf("At most %d reminders are allowed", maxReminderRules), http.StatusBadRequest)
+		return
+	}
+
+	rule := &models.ReminderRule{
+		UserID:        user.ID,
+		Channel:       request.Channel,
+		Target:        target,
+		MinutesBefore: request.MinutesBefore,
+	}
+	if err := h.Reminders.CreateReminderRule(rule); err != nil {
+		log.Printf("Error saving reminder rule: %v", err)
+		http.Error(w, "Failed to create reminder", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d added a %s reminder %d minutes before events", user.ID, rule.Channel, rule.MinutesBefore)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/reminders/"+strconv.FormatUint(uint64(rule.ID), 10))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reminderRuleResponse(rule))
+}
+
+// DeleteReminderRule removes one of the signed-in user's reminder rules.
+// Reminders it planned but hasn't sent are dropped.
+func (h *Handler) DeleteReminderRule(w http.ResponseWriter, r *http.Request) {
+	if !h.remindersEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Reminder not found", http.StatusNotFound)
+		return
+	}
+	deleted, err := h.Reminders.DeleteReminderRule(user.ID, uint(id))
+	if err != nil {
+		log.Printf("Error deleting reminder rule %d: %v", id, err)
+		http.Error(w, "Failed to delete reminder", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Reminder not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Reminder deleted successfully!",
+	})
+}
+
+// ListReminderJobs lists the reminders planned and sent for the signed-in
+// user, latest first
+func (h *Handler) ListReminderJobs(w http.ResponseWriter, r *http.Request) {
+	if !h.remindersEnabled(w) {
+		return
+	}
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	jobs, err := h.Reminders.ListReminderJobs(user.ID, reminderHistory)
+	if err != nil {
+		log.Printf("Error listing reminders of user %d: %v", user.ID, err)
+		http.Error(w, "Failed to list reminders", http.StatusInternalServerError)
+		return
+	}
+
+	loc := userLocation(user)
+	formatted := []map[string]interface{}{}
+	for _, job := range jobs {
+		entry := map[string]interface{}{
+			"reminderId": job.RuleID,
+			"eventId":    job.EventID,
+			"title":      job.Title,
+			"startTime":  job.StartTime.In(loc).Format(time.RFC3339),
+			"sendAt":     job.SendAt.In(loc).Format(time.RFC3339),
+			"status":     job.Status,
+			"attempts":   job.Attempts,
+		}
+		if job.LastError != "" {
+			entry["error"] = job.LastError
+		}
+		if job.SentAt != nil {
+			entry["sentAt"] = job.SentAt.In(loc).Format(time.RFC3339)
+		}
+		formatted = append(formatted, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": formatted,
+	})
+}
+
+// reminderTarget validates where a reminder rule sends to. The server
+// posts to webhooks itself, so they must not point into our own network.
+func reminderTarget(ctx context.Context, channel, target string, user *models.User) (string, error) {
+	switch channel {
+	case notify.ChannelEmail:
+		if target == "" {
+			return user.Email, nil
+		}
+		address, err := mail.ParseAddress(target)
+		if err != nil {
+			return "", fmt.Errorf("invalid target: %v", err)
+		}
+		return address.Address, nil
+	case notify.ChannelWebhook, notify.ChannelSlack:
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			return "", fmt.Errorf("target must be an http(s) URL")
+		}
+		if channel == notify.ChannelSlack && (u.Scheme != "https" || u.Host != "hooks.slack.com") {
+			return "", fmt.Errorf("target must be a Slack incoming webhook URL (https://hooks.slack.com/...)")
+		}
+		if channel == notify.ChannelWebhook {
+			if err := netguard.CheckURL(ctx, target); errors.Is(err, netguard.ErrBlocked) {
+				return "", fmt.Errorf("target must be a publicly reachable URL")
+			} else if err != nil {
+				return "", fmt.Errorf("target: %v", err)
+			}
+		}
+		return target, nil
+	}
+	return "", fmt.Errorf("channel must be email, webhook or slack")
+}
+
+func reminderRuleResponse(rule *models.ReminderRule) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            rule.ID,
+		"channel":       rule.Channel,
+		"target":        rule.Target,
+		"minutesBefore": rule.MinutesBefore,
+		"createdAt":     rule.CreatedAt,
+	}
+}
+
+// remindersEnabled writes a 404 and returns false when server reminders
+// are turned off
+func (h *Handler) remindersEnabled(w http.ResponseWriter) bool {
+	if h.Reminders == nil {
+		http.Error(w, "Reminders are not enabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"fmt"
+	"goauthDemo/models"
+	"net/http"
+	"testing"
+)
+
+// testReminders is a ReminderStore in memory
+type testReminders struct {
+	rules []models.ReminderRule
+}
+
+func (s *testReminders) ListUserReminderRules(userID int) ([]models.ReminderRule, error) {
+	return s.rules, nil
+}
+
+func (s *testReminders) CreateReminderRule(rule *models.ReminderRule) error {
+	rule.ID = uint(len(s.rules) + 1)
+	s.rules = append(s.rules, *rule)
+	return nil
+}
+
+func (s *testReminders) DeleteReminderRule(userID int, id uint) (bool, error) {
+	return false, nil
+}
+
+func (s *testReminders) ListReminderJobs(userID int, limit int) ([]models.ReminderJob, error) {
+	return nil, nil
+}
+
+func TestCreateReminderRuleTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		target  string
+		status  int
+	}{
+		{"public webhook", "webhook", "https://8.8.8.8/hooks/reminders", http.StatusCreated},
+		{"loopback webhook", "webhook", "http://127.0.0.1:8080/admin", http.StatusBadRequest},
+		{"localhost webhook", "webhook", "http://localhost/hook", http.StatusBadRequest},
+		{"private webhook", "webhook", "http://10.0.0.5/hook", http.StatusBadRequest},
+		{"metadata webhook", "webhook", "http://169.254.169.254/latest/meta-data", http.StatusBadRequest},
+		{"IPv6 loopback webhook", "webhook", "http://[::1]/hook", http.StatusBadRequest},
+		{"not http", "webhook", "ftp://8.8.8.8/hook", http.StatusBadRequest},
+		{"slack", "slack", "https://hooks.slack.com/services/T000/B000/XXXX", http.StatusCreated},
+		{"not slack", "slack", "https://8.8.8.8/services/T000", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler()
+			reminders := &testReminders{}
+			h.Reminders = reminders
+
+			body := fmt.Sprintf(`{"channel":%q,"target":%q,"minutesBefore":15}`, tt.channel, tt.target)
+			rec := serve(newTestRouter(h), 1, "POST", "/reminders", body)
+			expectStatus(t, rec, tt.status)
+			if created := len(reminders.rules) == 1; created != (tt.status == http.StatusCreated) {
+				t.Errorf("rule stored = %v, want %v", created, tt.status == http.StatusCreated)
+			}
+		})
+	}
+}
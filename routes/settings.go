@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"goauthDemo/calendar"
+	"goauthDemo/internal/netguard"
+	"log"
+	"net/http"
+)
+
+// GetCalendarBackend reports which calendar the signed-in user's meetings go to
+func (h *Handler) GetCalendarBackend(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	backend := user.CalendarBackend
+	if backend == "" {
+		backend = user.Provider
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backend":  backend,
+		"url":      user.CalDAVURL,
+		"username": user.CalDAVUsername,
+	})
+}
+
+// SetCalendarBackend switches the signed-in user between the calendar of
+// their sign-in provider and a CalDAV server
+func (h *Handler) SetCalendarBackend(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Backend  string `json:"backend"`
+		URL      string `json:"url"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch request.Backend {
+	case "", "default":
+		// Back to the sign-in provider's calendar
+		request.Backend, request.URL, request.Username, request.Password = "", "", "", ""
+	case "caldav":
+		// The server connects to this URL, so it must not point into our
+		// own network
+		if err := netguard.CheckURL(r.Context(), request.URL); err != nil {
+			if errors.Is(err, netguard.ErrBlocked) {
+				http.Error(w, "url must be a publicly reachable CalDAV server", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "url must be the http(s) address of a CalDAV calendar collection", http.StatusBadRequest)
+			return
+		}
+
+		// Make sure the calendar is reachable before switching over. The
+		// details stay in the log: they describe a server the user picked.
+		provider := calendar.NewCalDAVProvider(request.URL, request.Username, request.Password, user.Email)
+		if err := provider.CheckConnection(r.Context()); err != nil {
+			log.Printf("CalDAV check failed for user %d: %v", user.ID, err)
+			message := "Unable to connect to CalDAV calendar"
+			if errors.Is(err, calendar.ErrForbidden) {
+				message += ": check the username and password"
+			}
+			http.Error(w, message, http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Invalid backend: must be default or caldav", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Users.UpdateCalendarBackend(user.ID, request.Backend, request.URL, request.Username, request.Password); err != nil {
+		log.Printf("Error saving calendar backend: %v", err)
+		http.Error(w, "Failed to save calendar backend", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d switched calendar backend to %q", user.ID, request.Backend)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Calendar backend updated successfully!",
+	})
+}
+
+// GetTimeZone reports the zone the signed-in user's meetings are scheduled
+// and listed in
+func (h *Handler) GetTimeZone(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"timeZone": user.TimeZone,
+	})
+}
+
+// SetTimeZone changes the signed-in user's time zone
+func (h *Handler) SetTimeZone(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		TimeZone string `json:"timeZone"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if _, err := calendar.LoadTimeZone(request.TimeZone); err != nil {
+		http.Error(w, "Invalid timeZone: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Users.UpdateUserTimeZone(user.ID, request.TimeZone); err != nil {
+		log.Printf("Error saving time zone: %v", err)
+		http.Error(w, "Failed to save time zone", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d switched time zone to %s", user.ID, request.TimeZone)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Time zone updated successfully!",
+	})
+}
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSetCalendarBackend(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		contains string
+	}{
+		{"back to default", `{"backend":"default"}`, http.StatusOK, "updated"},
+		{"unknown backend", `{"backend":"exchange"}`, http.StatusBadRequest, "Invalid backend"},
+		{"not a URL", `{"backend":"caldav","url":"calendar"}`, http.StatusBadRequest, "http(s) address"},
+		{"loopback", `{"backend":"caldav","url":"http://127.0.0.1:5232/alice/"}`, http.StatusBadRequest, "publicly reachable"},
+		{"localhost", `{"backend":"caldav","url":"http://localhost/alice/"}`, http.StatusBadRequest, "publicly reachable"},
+		{"cloud metadata", `{"backend":"caldav","url":"http://169.254.169.254/latest/"}`, http.StatusBadRequest, "publicly reachable"},
+		{"private network", `{"backend":"caldav","url":"https://10.0.0.5/dav/"}`, http.StatusBadRequest, "publicly reachable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(newTestHandler())
+			rec := serve(router, 1, "PUT", "/calendar-backend", tt.body)
+			expectStatus(t, rec, tt.status)
+			if !strings.Contains(rec.Body.String(), tt.contains) {
+				t.Errorf("body %q doesn't contain %q", rec.Body.String(), tt.contains)
+			}
+
+			// Rejected settings leave the default calendar in place
+			backend := decodeJSON(t, serve(router, 1, "GET", "/calendar-backend", ""))["backend"]
+			if tt.status != http.StatusOK && backend != "" {
+				t.Errorf("backend = %v after a rejected change", backend)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"goauthDemo/calendar"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSuggestions bounds the maxResults of /meetings/suggest
+	maxSuggestions = 50
+	// maxMeetingDuration bounds the durationMinutes of /meetings/suggest
+	maxMeetingDuration = 24 * time.Hour
+)
+
+// SuggestMeetingTimes proposes slots in which the signed-in user and every
+// attendee are free, within everyone's working hours in their own zones
+func (h *Handler) SuggestMeetingTimes(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Attendees       []string `json:"attendees"`
+		DurationMinutes int      `json:"durationMinutes"`
+		TimeMin         string   `json:"timeMin"`
+		TimeMax         string   `json:"timeMax"`
+		// TimeZones maps attendee emails to IANA zones; attendees without
+		// one are assumed to share the organizer's zone
+		TimeZones    map[string]string `json:"timeZones"`
+		WorkingHours *struct {
+			Start string   `json:"start"`
+			End   string   `json:"end"`
+			Days  []string `json:"days"`
+		} `json:"workingHours"`
+		BufferMinutes    int `json:"bufferMinutes"`
+		MinNoticeMinutes int `json:"minNoticeMinutes"`
+		MaxResults       int `json:"maxResults"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	duration := time.Duration(request.DurationMinutes) * time.Minute
+	if duration <= 0 || duration > maxMeetingDuration {
+		http.Error(w, "durationMinutes must be between 1 and 1440", http.StatusBadRequest)
+		return
+	}
+	if request.BufferMinutes < 0 || request.MinNoticeMinutes < 0 {
+		http.Error(w, "bufferMinutes and minNoticeMinutes can't be negative", http.StatusBadRequest)
+		return
+	}
+	if request.MaxResults < 0 || request.MaxResults > maxSuggestions {
+		http.Error(w, fmt.Sprintf("Invalid maxResults: must be between 1 and %d", maxSuggestions), http.StatusBadRequest)
+		return
+	}
+	if len(request.Attendees)+1 > maxFreeBusyCalendars {
+		http.Error(w, fmt.Sprintf("At most %d attendees are supported", maxFreeBusyCalendars-1), http.StatusBadRequest)
+		return
+	}
+
+	hours := calendar.DefaultWorkingHours
+	if request.WorkingHours != nil {
+		days := hours.Days
+		if request.WorkingHours.Days != nil {
+			days = nil
+			for _, name := range request.WorkingHours.Days {
+				day, ok := parseWeekday(name)
+				if !ok {
+					http.Error(w, fmt.Sprintf("Invalid working day %q", name), http.StatusBadRequest)
+					return
+				}
+				days = append(days, day)
+			}
+		}
+		var err error
+		hours, err = calendar.ParseWorkingHours(request.WorkingHours.Start, request.WorkingHours.End, days)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, provider, ok := h.userCalendar(w, r)
+	if !ok {
+		return
+	}
+	loc := userLocation(user)
+
+	// Search the next week by default, like /upcoming-meetings
+	now := time.Now().In(loc)
+	timeMin, err := parseTimeParam(request.TimeMin, now, loc)
+	if err != nil {
+		http.Error(w, "Invalid timeMin: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeMax, err := parseTimeParam(request.TimeMax, timeMin.AddDate(0, 0, 7), loc)
+	if err != nil {
+		http.Error(w, "Invalid timeMax: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !timeMax.After(timeMin) {
+		http.Error(w, "timeMax must be after timeMin", http.StatusBadRequest)
+		return
+	}
+	if timeMax.Sub(timeMin) > maxFreeBusyWindow {
+		http.Error(w, "The requested window may span at most 62 days", http.StatusBadRequest)
+		return
+	}
+
+	participants := []calendar.Participant{{Calendar: user.Email, Location: loc}}
+	for _, email := range request.Attendees {
+		if strings.EqualFold(email, user.Email) {
+			continue
+		}
+		participantLoc := loc
+		if name, ok := request.TimeZones[email]; ok {
+			participantLoc, err = calendar.LoadTimeZone(name)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid time zone for %s: %v", email, err), http.StatusBadRequest)
+				return
+			}
+		}
+		participants = append(participants, calendar.Participant{Calendar: email, Location: participantLoc})
+	}
+
+	calendars := make([]string, 0, len(participants))
+	for _, participant := range participants {
+		calendars = append(calendars, participant.Calendar)
+	}
+
+	log.Printf("Suggesting %s meeting times for user %d with %v", duration, user.ID, calendars)
+
+	buffer := time.Duration(request.BufferMinutes) * time.Minute
+	busy, err := provider.FreeBusy(r.Context(), timeMin.Add(-buffer), timeMax.Add(buffer), calendars)
+	if err != nil {
+		log.Printf("Error querying free/busy: %v", err)
+		http.Error(w, "Failed to query free/busy: "+err.Error(), calendarErrorStatus(err))
+		return
+	}
+
+	// Attendees whose calendars can't be read are assumed free, but
+	// reported so the organizer knows the suggestions may clash for them
+	unavailable := []string{}
+	for i, participant := range participants {
+		periods, ok := busy[participant.Calendar]
+		if !ok {
+			unavailable = append(unavailable, participant.Calendar)
+			continue
+		}
+		for _, period := range periods {
+			interval, err := calendar.ParseTimePeriod(period)
+			if err != nil {
+				continue
+			}
+			participants[i].Busy = append(participants[i].Busy, interval)
+		}
+	}
+
+	suggestions := calendar.SuggestTimes(participants, calendar.SuggestOptions{
+		Duration:     duration,
+		WindowStart:  timeMin,
+		WindowEnd:    timeMax,
+		WorkingHours: hours,
+		Buffer:       buffer,
+		MinNotice:    time.Duration(request.MinNoticeMinutes) * time.Minute,
+		MaxResults:   request.MaxResults,
+		Now:          now,
+	})
+
+	formatted := []map[string]interface{}{}
+	for _, suggestion := range suggestions {
+		formatted = append(formatted, map[string]interface{}{
+			"startTime": suggestion.Start.In(loc).Format(time.RFC3339),
+			"endTime":   suggestion.End.In(loc).Format(time.RFC3339),
+			"score":     suggestion.Score,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"suggestions": formatted,
+		"timeZone":    loc.String(),
+		"unavailable": unavailable,
+	})
+}
+
+// parseWeekday reads a weekday name such as "monday" or "mon"
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
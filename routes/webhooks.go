@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"goauthDemo/calendar"
+	"log"
+	"net/http"
+	"time"
+)
+
+// GoogleCalendarWebhook receives Google Calendar push notifications and
+// brings the cache of the changed calendar up to date. Notifications are
+// matched to a registered channel by X-Goog-Channel-ID and must carry its
+// X-Goog-Channel-Token; those of channels past their expiration are
+// ignored. To try it locally, post the headers of a stored
+// channel with X-Goog-Resource-State set to "exists".
+func (h *Handler) GoogleCalendarWebhook(w http.ResponseWriter, r *http.Request) {
+	if h.Watches == nil {
+		http.Error(w, "Push notifications are not enabled", http.StatusNotFound)
+		return
+	}
+
+	channelID := r.Header.Get("X-Goog-Channel-ID")
+	state := r.Header.Get("X-Goog-Resource-State")
+	if channelID == "" || state == "" {
+		http.Error(w, "Missing X-Goog-Channel-ID or X-Goog-Resource-State header", http.StatusBadRequest)
+		return
+	}
+
+	channel, err := h.Watches.GetWatchChannel(channelID)
+	if err != nil {
+		log.Printf("Error loading watch channel %s: %v", channelID, err)
+		http.Error(w, "Failed to load channel", http.StatusInternalServerError)
+		return
+	}
+	if channel == nil {
+		log.Printf("Notification for unknown watch channel %s", channelID)
+		http.Error(w, "Unknown channel", http.StatusNotFound)
+		return
+	}
+
+	token := r.Header.Get("X-Goog-Channel-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(channel.Token)) != 1 {
+		log.Printf("Notification for watch channel %s with wrong token", channelID)
+		http.Error(w, "Invalid channel token", http.StatusForbidden)
+		return
+	}
+	if resourceID := r.Header.Get("X-Goog-Resource-ID"); resourceID != "" && resourceID != channel.ResourceID {
+		http.Error(w, "Resource doesn't match channel", http.StatusForbidden)
+		return
+	}
+	if channel.Expiration.Before(time.Now()) {
+		// The channel was replaced or has lapsed; acknowledge so Google stops retrying
+		log.Printf("Notification for expired watch channel %s", channelID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch state {
+	case "sync":
+		// Google confirms every new channel with a sync message
+		w.WriteHeader(http.StatusOK)
+		return
+	case "exists", "not_exists":
+	default:
+		http.Error(w, "Unknown resource state "+state, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Users.GetUserByID(channel.UserID)
+	if err != nil {
+		log.Printf("Error loading user %d of watch channel %s: %v", channel.UserID, channelID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	provider, err := h.Calendars(r.Context(), user)
+	if err == nil && channel.CalendarID != calendar.PrimaryCalendar {
+		provider, err = provider.WithCalendar(r.Context(), channel.CalendarID)
+	}
+	if err != nil {
+		log.Printf("Error opening calendar %s of user %d: %v", channel.CalendarID, user.ID, err)
+		http.Error(w, "Failed to open calendar", calendarErrorStatus(err))
+		return
+	}
+
+	cached, ok := provider.(*calendar.CachedProvider)
+	if !ok {
+		// Nothing is cached for this calendar
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	log.Printf("Calendar %s of user %d changed (message %s), syncing", channel.CalendarID, user.ID, r.Header.Get("X-Goog-Message-Number"))
+	if err := cached.Sync(r.Context()); err != nil {
+		// Google retries failed notifications; until then listings sync themselves
+		cached.MarkStale()
+		log.Printf("Error syncing calendar %s of user %d: %v", channel.CalendarID, user.ID, err)
+		http.Error(w, "Failed to sync calendar", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,167 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"goauthDemo/calendar"
+	"goauthDemo/models"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingSyncer is an in-memory calendar that counts its syncs
+type countingSyncer struct {
+	*calendar.MemoryProvider
+	syncs  int
+	broken bool
+}
+
+func (s *countingSyncer) SyncEvents(ctx context.Context, syncToken string) (*calendar.SyncResult, error) {
+	if s.broken {
+		return nil, errors.New("provider unavailable")
+	}
+	s.syncs++
+	return &calendar.SyncResult{NextSyncToken: "next"}, nil
+}
+
+// testEventCache is an EventCache that only keeps the sync state
+type testEventCache struct {
+	mu    sync.Mutex
+	state *models.SyncState
+}
+
+func (c *testEventCache) GetSyncState(userID int, calendarID string) (*models.SyncState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state, nil
+}
+
+func (c *testEventCache) ReplaceEvents(userID int, calendarID string, events []models.CachedEvent, syncToken string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state = &models.SyncState{SyncToken: syncToken, SyncedAt: time.Now()}
+	return nil
+}
+
+func (c *testEventCache) ApplyEventChanges(userID int, calendarID string, changed []models.CachedEvent, deleted []string, syncToken string) error {
+	return c.ReplaceEvents(userID, calendarID, nil, syncToken)
+}
+
+func (c *testEventCache) ListCachedEvents(userID int, calendarID string, timeMin, timeMax time.Time) ([]models.CachedEvent, error) {
+	return nil, nil
+}
+
+func (c *testEventCache) MarkCalendarStale(userID int, calendarID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == nil {
+		c.state = &models.SyncState{}
+	}
+	c.state.Stale = true
+	return nil
+}
+
+// testWatches holds two channels of user 1's primary calendar: ch1, and
+// ch0 which has expired
+type testWatches struct{}
+
+func (testWatches) GetWatchChannel(channelID string) (*models.WatchChannel, error) {
+	expiration := time.Now().Add(24 * time.Hour)
+	switch channelID {
+	case "ch1":
+	case "ch0":
+		expiration = time.Now().Add(-time.Hour)
+	default:
+		return nil, nil
+	}
+	return &models.WatchChannel{UserID: 1, CalendarID: calendar.PrimaryCalendar, ChannelID: channelID, ResourceID: "res1", Token: "channel-secret", Expiration: expiration}, nil
+}
+
+func (testWatches) ListWatchChannels(userID int, calendarID string) ([]models.WatchChannel, error) {
+	return nil, nil
+}
+
+func (testWatches) ListExpiringWatchChannels(before time.Time) ([]models.WatchChannel, error) {
+	return nil, nil
+}
+
+func (testWatches) SaveWatchChannel(channel *models.WatchChannel) error { return nil }
+
+func (testWatches) DeleteWatchChannel(channelID string) error { return nil }
+
+// notification sends a push notification with the given headers
+func notification(h *Handler, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/webhooks/google-calendar", nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	h.GoogleCalendarWebhook(rec, req)
+	return rec
+}
+
+func TestGoogleCalendarWebhook(t *testing.T) {
+	valid := func(state string) map[string]string {
+		return map[string]string{
+			"X-Goog-Channel-ID":     "ch1",
+			"X-Goog-Channel-Token":  "channel-secret",
+			"X-Goog-Resource-ID":    "res1",
+			"X-Goog-Resource-State": state,
+		}
+	}
+	with := func(headers map[string]string, key, value string) map[string]string {
+		headers[key] = value
+		return headers
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		broken  bool
+		status  int
+		syncs   int
+		stale   bool
+	}{
+		{"changed calendar", valid("exists"), false, http.StatusOK, 1, false},
+		{"deleted resource", valid("not_exists"), false, http.StatusOK, 1, false},
+		{"channel confirmation", valid("sync"), false, http.StatusOK, 0, false},
+		{"missing headers", map[string]string{}, false, http.StatusBadRequest, 0, false},
+		{"unknown channel", with(valid("exists"), "X-Goog-Channel-ID", "ch2"), false, http.StatusNotFound, 0, false},
+		{"wrong token", with(valid("exists"), "X-Goog-Channel-Token", "guess"), false, http.StatusForbidden, 0, false},
+		{"missing token", with(valid("exists"), "X-Goog-Channel-Token", ""), false, http.StatusForbidden, 0, false},
+		{"other resource", with(valid("exists"), "X-Goog-Resource-ID", "res2"), false, http.StatusForbidden, 0, false},
+		{"expired channel", with(valid("exists"), "X-Goog-Channel-ID", "ch0"), false, http.StatusOK, 0, false},
+		{"unknown state", valid("moved"), false, http.StatusBadRequest, 0, false},
+		{"sync fails", valid("exists"), true, http.StatusInternalServerError, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syncer := &countingSyncer{MemoryProvider: calendar.NewMemoryProvider("user1@example.com"), broken: tt.broken}
+			cache := &testEventCache{}
+			factory := calendar.NewCachingFactory(func(ctx context.Context, user *models.User) (calendar.CalendarProvider, error) {
+				return syncer, nil
+			}, cache, time.Minute)
+			h := NewHandler(&testUsers{}, factory)
+			h.Watches = testWatches{}
+
+			rec := notification(h, tt.headers)
+			expectStatus(t, rec, tt.status)
+			if syncer.syncs != tt.syncs {
+				t.Errorf("synced %d times, want %d", syncer.syncs, tt.syncs)
+			}
+			stale := cache.state != nil && cache.state.Stale
+			if stale != tt.stale {
+				t.Errorf("calendar stale = %v, want %v", stale, tt.stale)
+			}
+		})
+	}
+}
+
+func TestGoogleCalendarWebhookDisabled(t *testing.T) {
+	rec := notification(newTestHandler(), map[string]string{"X-Goog-Channel-ID": "ch1", "X-Goog-Resource-State": "exists"})
+	expectStatus(t, rec, http.StatusNotFound)
+}